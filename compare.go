@@ -0,0 +1,519 @@
+package dbdiffer
+
+import "strings"
+
+// Compare finds out what has to be done to upgrade the old schema to the new one
+func Compare(old, new *Schema) *Result {
+	result := Result{
+		Drop:   []Table{},
+		Create: []Table{},
+		Change: []Table{},
+		Rename: []TableRename{},
+	}
+
+	oldtablespos := make(map[string]int, len(old.Tables))
+	for pos, table := range old.Tables {
+		oldtablespos[table.Name] = pos
+	}
+	newtablespos := make(map[string]int, len(new.Tables))
+	for pos, table := range new.Tables {
+		newtablespos[table.Name] = pos
+	}
+
+	//table
+	for _, olddetail := range old.Tables {
+		//table is not exist in new database, drop it
+		if _, exist := newtablespos[olddetail.Name]; !exist {
+			result.Drop = append(result.Drop, olddetail)
+		}
+	}
+	for _, newdetail := range new.Tables {
+		//create tables, create fields, create indexes
+		if pos, exist := oldtablespos[newdetail.Name]; !exist {
+			result.Create = append(result.Create, newdetail)
+		} else {
+			change := CompareTable(old.Tables[pos], newdetail)
+			if !change.IsEmpty() {
+				result.Change = append(result.Change, change)
+			}
+		}
+	}
+
+	detecttablerenames(&result)
+
+	result.Views = CompareViews(old.Views, new.Views)
+	result.Triggers = CompareTriggers(old.Triggers, new.Triggers)
+	result.Routines = CompareRoutines(old.Routines, new.Routines)
+	result.Events = CompareEvents(old.Events, new.Events)
+
+	return &result
+}
+
+// CompareViews finds out the views to drop, create and replace
+func CompareViews(oldviews, newviews []View) ResultViews {
+	result := ResultViews{
+		Drop:   []View{},
+		Create: []View{},
+		Change: []View{},
+		Old:    []View{},
+	}
+	newviewspos := make(map[string]int, len(newviews))
+	for pos, view := range newviews {
+		newviewspos[view.Name] = pos
+	}
+	oldviewspos := make(map[string]int, len(oldviews))
+	for pos, view := range oldviews {
+		oldviewspos[view.Name] = pos
+	}
+	for _, oldview := range oldviews {
+		if _, exist := newviewspos[oldview.Name]; !exist {
+			result.Drop = append(result.Drop, oldview)
+		}
+	}
+	for _, newview := range newviews {
+		if pos, exist := oldviewspos[newview.Name]; !exist {
+			result.Create = append(result.Create, newview)
+		} else if !oldviews[pos].Equal(newview) {
+			result.Change = append(result.Change, newview)
+			result.Old = append(result.Old, oldviews[pos])
+		}
+	}
+	return result
+}
+
+// CompareTable finds out the changes between two definitions of a table,
+// the returned table only holds table options when they are changed.
+func CompareTable(olddetail, newdetail Table) Table {
+	change := Table{
+		Name:        newdetail.Name,
+		Fields:      ResultFields{},
+		Indexes:     ResultIndexes{},
+		Constraints: ResultConstraints{},
+	}
+	if !olddetail.Equal(newdetail) {
+		change = Table{
+			Name:           newdetail.Name,
+			Engine:         newdetail.Engine,
+			Version:        newdetail.Version,
+			RowFormat:      newdetail.RowFormat,
+			Options:        newdetail.Options,
+			Comment:        newdetail.Comment,
+			Collation:      newdetail.Collation,
+			OptionsChanged: true,
+		}
+	}
+
+	// the size of the table to change
+	change.Rows, change.DataLength = olddetail.Rows, olddetail.DataLength
+	old := olddetail
+	change.Old = &old
+
+	newindexes := newdetail.Indexes.Create
+	newindexespos := make(map[string]int, len(newindexes))
+	for pos, index := range newindexes {
+		newindexespos[index.KeyName] = pos
+	}
+	oldindexes := olddetail.Indexes.Create
+	oldindexespos := make(map[string]int, len(oldindexes))
+	for pos, index := range oldindexes {
+		oldindexespos[index.KeyName] = pos
+	}
+
+	for _, oldindex := range oldindexes {
+		if pos, exist := newindexespos[oldindex.KeyName]; !exist {
+			// drop index
+			change.Indexes.Drop = append(change.Indexes.Drop, oldindex)
+		} else {
+			// alter index
+			if oldindex.Equal(newindexes[pos]) {
+				continue
+			}
+			change.Indexes.Drop = append(change.Indexes.Drop, oldindex)
+			change.Indexes.Add = append(change.Indexes.Add, newindexes[pos])
+		}
+	}
+	for _, newindex := range newindexes {
+		if _, exist := oldindexespos[newindex.KeyName]; !exist {
+			// add index
+			change.Indexes.Add = append(change.Indexes.Add, newindex)
+		}
+	}
+	change.Indexes.Engine = newdetail.Engine
+
+	newfields := newdetail.Fields.Create
+	newfieldspos := make(map[string]int, len(newfields))
+	for pos, field := range newfields {
+		newfieldspos[field.Field] = pos
+	}
+	oldfields := olddetail.Fields.Create
+	oldfieldspos := make(map[string]int, len(oldfields))
+	for pos, field := range oldfields {
+		oldfieldspos[field.Field] = pos
+	}
+
+	for _, oldfield := range oldfields {
+		if pos, exist := newfieldspos[oldfield.Field]; !exist {
+			// drop field
+			change.Fields.Drop = append(change.Fields.Drop, oldfield)
+		} else {
+			// alter field
+			if oldfield.Equal(newfields[pos]) {
+				continue
+			}
+			if oldfield.Virtual() != newfields[pos].Virtual() {
+				// mysql cannot turn a column into a virtual one or back, it is dropped and added again
+				change.Fields.Drop = append(change.Fields.Drop, oldfield)
+				change.Fields.Add = append(change.Fields.Add, newfields[pos])
+				continue
+			}
+			change.Fields.Change = append(change.Fields.Change, FieldChange{Old: oldfield, New: newfields[pos]})
+		}
+	}
+
+	for _, newfield := range newfields {
+		if _, exist := oldfieldspos[newfield.Field]; !exist {
+			// add field
+			change.Fields.Add = append(change.Fields.Add, newfield)
+		}
+	}
+
+	newconstraints := newdetail.Constraints.Create
+	newconstraintspos := make(map[string]int, len(newconstraints))
+	for pos, constraint := range newconstraints {
+		newconstraintspos[constraint.Name] = pos
+	}
+	oldconstraints := olddetail.Constraints.Create
+	oldconstraintspos := make(map[string]int, len(oldconstraints))
+	for pos, constraint := range oldconstraints {
+		oldconstraintspos[constraint.Name] = pos
+	}
+
+	for _, oldconstraint := range oldconstraints {
+		if pos, exist := newconstraintspos[oldconstraint.Name]; !exist {
+			// drop constraint
+			change.Constraints.Drop = append(change.Constraints.Drop, oldconstraint)
+		} else {
+			// alter constraint
+			if oldconstraint.Equal(newconstraints[pos]) {
+				continue
+			}
+			change.Constraints.Drop = append(change.Constraints.Drop, oldconstraint)
+			change.Constraints.Add = append(change.Constraints.Add, newconstraints[pos])
+		}
+	}
+	for _, newconstraint := range newconstraints {
+		if _, exist := oldconstraintspos[newconstraint.Name]; !exist {
+			// add constraint
+			change.Constraints.Add = append(change.Constraints.Add, newconstraint)
+		}
+	}
+
+	change.Partitions = ComparePartitions(olddetail.Partitions.Create, newdetail.Partitions.Create)
+
+	detectrenames(olddetail, newdetail, &change)
+	renamedindexes(&change)
+
+	return change
+}
+
+// CompareOrder finds out the columns to move, so that columns of the tables in both schemas end up in the order of the new schema.
+// The longest run of columns that are already in order stays, the other columns are moved,
+// as well as added columns following a moved one. Moved columns are no longer in Fields.Change, they are changed as they move.
+func CompareOrder(old, new *Schema, result *Result) {
+	renamed := make(map[string]string, len(result.Rename))
+	for _, rename := range result.Rename {
+		renamed[rename.New.Name] = rename.Old.Name
+	}
+	changepos := make(map[string]int, len(result.Change))
+	for pos, table := range result.Change {
+		changepos[table.Name] = pos
+	}
+	for _, newtable := range new.Tables {
+		oldname := newtable.Name
+		if name, exist := renamed[oldname]; exist {
+			oldname = name
+		}
+		oldtable, exist := old.Table(oldname)
+		if !exist {
+			continue
+		}
+		change := Table{Name: newtable.Name, Old: &oldtable}
+		pos, changed := changepos[newtable.Name]
+		if changed {
+			change = result.Change[pos]
+		}
+		moves := movedfields(oldtable, newtable, change.Fields)
+		if len(moves) == 0 {
+			continue
+		}
+		moved := make(map[string]bool, len(moves))
+		for _, field := range moves {
+			moved[field.Field] = true
+		}
+		fields := make([]FieldChange, 0, len(change.Fields.Change))
+		for _, field := range change.Fields.Change {
+			if !moved[field.New.Field] {
+				fields = append(fields, field)
+			}
+		}
+		change.Fields.Change = fields
+		change.Fields.Move = moves
+		if changed {
+			result.Change[pos] = change
+		} else {
+			result.Change = append(result.Change, change)
+		}
+	}
+}
+
+func movedfields(oldtable, newtable Table, fields ResultFields) []Field {
+	dropped := make(map[string]bool, len(fields.Drop))
+	for _, field := range fields.Drop {
+		dropped[field.Field] = true
+	}
+	added := make(map[string]bool, len(fields.Add))
+	for _, field := range fields.Add {
+		added[field.Field] = true
+	}
+	renamed := make(map[string]string, len(fields.Rename))
+	for _, rename := range fields.Rename {
+		renamed[rename.Old.Field] = rename.New.Field
+	}
+	newfields := newtable.Fields.Create
+	newfieldspos := make(map[string]int, len(newfields))
+	for pos, field := range newfields {
+		newfieldspos[field.Field] = pos
+	}
+
+	// positions in the new table of the kept columns, in the old order
+	positions := make([]int, 0, len(oldtable.Fields.Create))
+	for _, field := range oldtable.Fields.Create {
+		if dropped[field.Field] {
+			continue
+		}
+		name := field.Field
+		if newname, exist := renamed[name]; exist {
+			name = newname
+		}
+		if pos, exist := newfieldspos[name]; exist && !added[name] {
+			positions = append(positions, pos)
+		}
+	}
+	keep := increasing(positions)
+
+	moves := make([]Field, 0)
+	move := make(map[int]bool)
+	for pos, field := range newfields {
+		if added[field.Field] {
+			// added columns are put after the column before them, which has to be in place first
+			move[pos] = pos > 0 && move[pos-1]
+		} else {
+			move[pos] = !keep[pos]
+		}
+		if move[pos] {
+			moves = append(moves, field)
+		}
+	}
+	return moves
+}
+
+// increasing returns the values of the longest increasing subsequence
+func increasing(values []int) map[int]bool {
+	length := make([]int, len(values))
+	prev := make([]int, len(values))
+	best := -1
+	for i := range values {
+		length[i], prev[i] = 1, -1
+		for j := 0; j < i; j++ {
+			if values[j] < values[i] && length[j]+1 > length[i] {
+				length[i], prev[i] = length[j]+1, j
+			}
+		}
+		if best == -1 || length[i] > length[best] {
+			best = i
+		}
+	}
+	result := make(map[int]bool, len(values))
+	for i := best; i != -1; i = prev[i] {
+		result[values[i]] = true
+	}
+	return result
+}
+
+// ComparePartitions finds out how to turn the old partitioning of a table into the new one
+func ComparePartitions(oldpartition, newpartition *Partition) ResultPartitions {
+	result := ResultPartitions{}
+	switch {
+	case oldpartition == nil && newpartition == nil:
+		return result
+	case newpartition == nil:
+		result.Remove = true
+		return result
+	case oldpartition == nil || !oldpartition.SameScheme(*newpartition):
+		result.Create = newpartition
+		return result
+	}
+
+	oldpartitions, newpartitions := oldpartition.Partitions, newpartition.Partitions
+	method := strings.ToUpper(newpartition.Method)
+	if !strings.HasPrefix(method, "RANGE") && !strings.HasPrefix(method, "LIST") {
+		// rows of hash and key partitions move whenever partitions change, so the table is partitioned again
+		if len(oldpartitions) != len(newpartitions) {
+			result.Create = newpartition
+			return result
+		}
+		for pos := range oldpartitions {
+			if !oldpartitions[pos].Equal(newpartitions[pos]) {
+				result.Create = newpartition
+				return result
+			}
+		}
+		return result
+	}
+
+	newpartitionspos := make(map[string]int, len(newpartitions))
+	for pos, partition := range newpartitions {
+		newpartitionspos[partition.Name] = pos
+	}
+	oldpartitionspos := make(map[string]int, len(oldpartitions))
+	for pos, partition := range oldpartitions {
+		oldpartitionspos[partition.Name] = pos
+	}
+	kept := make([]PartitionDefinition, 0, len(oldpartitions))
+	for _, partition := range oldpartitions {
+		if _, exist := newpartitionspos[partition.Name]; !exist {
+			result.Drop = append(result.Drop, partition)
+		} else {
+			kept = append(kept, partition)
+		}
+	}
+
+	if strings.HasPrefix(method, "LIST") {
+		// values may move between changed partitions, so they are reorganized together
+		reorganize := PartitionReorganize{}
+		for _, partition := range newpartitions {
+			if pos, exist := oldpartitionspos[partition.Name]; !exist {
+				result.Add = append(result.Add, partition)
+			} else if !oldpartitions[pos].Equal(partition) {
+				reorganize.Old = append(reorganize.Old, oldpartitions[pos])
+				reorganize.New = append(reorganize.New, partition)
+			}
+		}
+		if len(reorganize.Old) > 0 {
+			result.Reorganize = append(result.Reorganize, reorganize)
+		}
+		return result
+	}
+
+	// range partitions are ordered by their boundaries, new ones after the last kept partition are added,
+	// the kept partitions from the first difference on are reorganized into the new ones
+	start := 0
+	for start < len(newpartitions) && start < len(kept) && kept[start].Equal(newpartitions[start]) {
+		start++
+	}
+	if start == len(newpartitions) {
+		return result
+	}
+	if start == len(kept) {
+		result.Add = append(result.Add, newpartitions[start:]...)
+	} else {
+		result.Reorganize = append(result.Reorganize, PartitionReorganize{Old: kept[start:], New: newpartitions[start:]})
+	}
+	return result
+}
+
+// CompareTriggers finds out the triggers to drop, create and replace
+func CompareTriggers(oldtriggers, newtriggers []Trigger) ResultTriggers {
+	result := ResultTriggers{
+		Drop:   []Trigger{},
+		Create: []Trigger{},
+		Change: []Trigger{},
+		Old:    []Trigger{},
+	}
+	newtriggerspos := make(map[string]int, len(newtriggers))
+	for pos, trigger := range newtriggers {
+		newtriggerspos[trigger.Name] = pos
+	}
+	oldtriggerspos := make(map[string]int, len(oldtriggers))
+	for pos, trigger := range oldtriggers {
+		oldtriggerspos[trigger.Name] = pos
+	}
+	for _, oldtrigger := range oldtriggers {
+		if _, exist := newtriggerspos[oldtrigger.Name]; !exist {
+			result.Drop = append(result.Drop, oldtrigger)
+		}
+	}
+	for _, newtrigger := range newtriggers {
+		if pos, exist := oldtriggerspos[newtrigger.Name]; !exist {
+			result.Create = append(result.Create, newtrigger)
+		} else if !oldtriggers[pos].Equal(newtrigger) {
+			result.Change = append(result.Change, newtrigger)
+			result.Old = append(result.Old, oldtriggers[pos])
+		}
+	}
+	return result
+}
+
+// CompareRoutines finds out the routines to drop, create and replace
+func CompareRoutines(oldroutines, newroutines []Routine) ResultRoutines {
+	result := ResultRoutines{
+		Drop:   []Routine{},
+		Create: []Routine{},
+		Change: []Routine{},
+		Old:    []Routine{},
+	}
+	newroutinespos := make(map[string]int, len(newroutines))
+	for pos, routine := range newroutines {
+		newroutinespos[routine.Key()] = pos
+	}
+	oldroutinespos := make(map[string]int, len(oldroutines))
+	for pos, routine := range oldroutines {
+		oldroutinespos[routine.Key()] = pos
+	}
+	for _, oldroutine := range oldroutines {
+		if _, exist := newroutinespos[oldroutine.Key()]; !exist {
+			result.Drop = append(result.Drop, oldroutine)
+		}
+	}
+	for _, newroutine := range newroutines {
+		if pos, exist := oldroutinespos[newroutine.Key()]; !exist {
+			result.Create = append(result.Create, newroutine)
+		} else if !oldroutines[pos].Equal(newroutine) {
+			result.Change = append(result.Change, newroutine)
+			result.Old = append(result.Old, oldroutines[pos])
+		}
+	}
+	return result
+}
+
+// CompareEvents finds out the events to drop, create and alter
+func CompareEvents(oldevents, newevents []Event) ResultEvents {
+	result := ResultEvents{
+		Drop:   []Event{},
+		Create: []Event{},
+		Change: []Event{},
+		Old:    []Event{},
+	}
+	neweventspos := make(map[string]int, len(newevents))
+	for pos, event := range newevents {
+		neweventspos[event.Name] = pos
+	}
+	oldeventspos := make(map[string]int, len(oldevents))
+	for pos, event := range oldevents {
+		oldeventspos[event.Name] = pos
+	}
+	for _, oldevent := range oldevents {
+		if _, exist := neweventspos[oldevent.Name]; !exist {
+			result.Drop = append(result.Drop, oldevent)
+		}
+	}
+	for _, newevent := range newevents {
+		if pos, exist := oldeventspos[newevent.Name]; !exist {
+			result.Create = append(result.Create, newevent)
+		} else if !oldevents[pos].Equal(newevent) {
+			result.Change = append(result.Change, newevent)
+			result.Old = append(result.Old, oldevents[pos])
+		}
+	}
+	return result
+}
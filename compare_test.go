@@ -0,0 +1,361 @@
+package dbdiffer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func strptr(s string) *string {
+	return &s
+}
+
+func testschemas() (*Schema, *Schema) {
+	old := &Schema{Tables: []Table{
+		{
+			Name:   "user",
+			Engine: "InnoDB",
+			Fields: ResultFields{Create: []Field{
+				{Field: "id", Type: "int(11)", Null: "NO", Extra: "auto_increment"},
+				{Field: "name", Type: "varchar(32)", Null: "NO", Default: strptr("")},
+				{Field: "nickname", Type: "varchar(32)", Null: "YES"},
+			}},
+			Indexes: ResultIndexes{Create: []Index{
+				{Table: "user", KeyName: "PRIMARY", ColumnName: []string{"id"}},
+				{Table: "user", NonUnique: 1, KeyName: "idx_name", ColumnName: []string{"name"}},
+			}},
+		},
+		{Name: "legacy", Engine: "InnoDB"},
+		{Name: "same", Engine: "InnoDB", Fields: ResultFields{Create: []Field{{Field: "id", Type: "int(11)"}}}},
+	}}
+	new := &Schema{Tables: []Table{
+		{
+			Name:    "user",
+			Engine:  "InnoDB",
+			Comment: "users",
+			Fields: ResultFields{Create: []Field{
+				{Field: "id", Type: "int(11)", Null: "NO", Extra: "auto_increment"},
+				{Field: "name", Type: "varchar(64)", Null: "NO", Default: strptr("")},
+				{Field: "email", Type: "varchar(128)", Null: "YES", After: "name"},
+			}},
+			Indexes: ResultIndexes{Create: []Index{
+				{Table: "user", KeyName: "PRIMARY", ColumnName: []string{"id"}},
+				{Table: "user", NonUnique: 1, KeyName: "idx_name", ColumnName: []string{"name", "email"}},
+			}},
+		},
+		{Name: "tag", Engine: "InnoDB", Fields: ResultFields{Create: []Field{{Field: "id", Type: "int(11)"}}}},
+		{Name: "same", Engine: "InnoDB", Fields: ResultFields{Create: []Field{{Field: "id", Type: "int(11)"}}}},
+	}}
+	return old, new
+}
+
+func TestCompare(t *testing.T) {
+	old, new := testschemas()
+	res := Compare(old, new)
+
+	if len(res.Drop) != 1 || res.Drop[0].Name != "legacy" {
+		t.Errorf("unexpected drop %+v", res.Drop)
+	}
+	if len(res.Create) != 1 || res.Create[0].Name != "tag" || len(res.Create[0].Fields.Create) != 1 {
+		t.Errorf("unexpected create %+v", res.Create)
+	}
+	if len(res.Change) != 1 {
+		t.Fatalf("unexpected change %+v", res.Change)
+	}
+	change := res.Change[0]
+	if change.Name != "user" || change.Comment != "users" || len(change.Fields.Create) != 0 {
+		t.Errorf("unexpected table change %+v", change)
+	}
+	if len(change.Fields.Drop) != 1 || change.Fields.Drop[0].Field != "nickname" {
+		t.Errorf("unexpected dropped fields %+v", change.Fields.Drop)
+	}
+	if len(change.Fields.Add) != 1 || change.Fields.Add[0].Field != "email" {
+		t.Errorf("unexpected added fields %+v", change.Fields.Add)
+	}
+	if len(change.Fields.Change) != 1 || change.Fields.Change[0].New.Type != "varchar(64)" {
+		t.Errorf("unexpected changed fields %+v", change.Fields.Change)
+	}
+	if len(change.Indexes.Drop) != 1 || len(change.Indexes.Add) != 1 || change.Indexes.Add[0].KeyName != "idx_name" {
+		t.Errorf("unexpected indexes %+v", change.Indexes)
+	}
+}
+
+func TestCompareEqual(t *testing.T) {
+	_, new := testschemas()
+	if res := Compare(new, new); !res.IsEmpty() {
+		t.Fatalf("expect no difference, got %+v", res)
+	}
+}
+
+func TestSchemaInspect(t *testing.T) {
+	_, new := testschemas()
+	s, err := new.Inspect("us")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Tables) != 1 || s.Tables[0].Name != "user" {
+		t.Fatalf("unexpected tables %+v", s.Tables)
+	}
+	if _, exist := new.Table("tag"); !exist {
+		t.Fatal("expect table tag")
+	}
+}
+
+func TestCompareConstraint(t *testing.T) {
+	fk := Constraint{Name: "post_ibfk_1", Table: "post", Type: ForeignKey, Columns: []string{"user_id"}, RefTable: "user", RefColumns: []string{"id"}}
+	old := &Schema{Tables: []Table{
+		{Name: "post", Constraints: ResultConstraints{Create: []Constraint{fk}}},
+	}}
+	cascade := fk
+	cascade.OnDelete = "CASCADE"
+	added := Constraint{Name: "post_ibfk_2", Table: "post", Type: ForeignKey, Columns: []string{"tag_id"}, RefTable: "tag", RefColumns: []string{"id"}}
+	new := &Schema{Tables: []Table{
+		{Name: "post", Constraints: ResultConstraints{Create: []Constraint{cascade, added}}},
+	}}
+
+	res := Compare(old, new)
+	if len(res.Change) != 1 {
+		t.Fatalf("unexpected change %+v", res.Change)
+	}
+	c := res.Change[0].Constraints
+	if len(c.Drop) != 1 || c.Drop[0].Name != "post_ibfk_1" {
+		t.Errorf("unexpected dropped constraints %+v", c.Drop)
+	}
+	if len(c.Add) != 2 || c.Add[0].OnDelete != "CASCADE" || c.Add[1].Name != "post_ibfk_2" {
+		t.Errorf("unexpected added constraints %+v", c.Add)
+	}
+
+	// RESTRICT and NO ACTION are the same rule
+	restrict := fk
+	restrict.OnDelete, restrict.OnUpdate = "RESTRICT", "NO ACTION"
+	new.Tables[0].Constraints.Create = []Constraint{restrict}
+	if res := Compare(old, new); !res.IsEmpty() {
+		t.Errorf("expect no change, got %+v", res)
+	}
+}
+
+func TestCompareViews(t *testing.T) {
+	old := &Schema{Views: []View{
+		{Name: "active_user", Definition: "select `id` AS `id` from `user` where `status` = 'on'"},
+		{Name: "legacy_user", Definition: "select `id` AS `id` from `user`"},
+		{Name: "named_user", Definition: "select `id` AS `id`, `name` AS `name` from `user`"},
+	}}
+	new := &Schema{Views: []View{
+		// only layout and defaults differ
+		{Name: "active_user", Definition: "SELECT `id` AS `id`\n  FROM `user`\n WHERE `status` = 'on';", Algorithm: "UNDEFINED", CheckOption: "NONE"},
+		{Name: "named_user", Definition: "select `id` AS `id`, `name` AS `name` from `user` where `name` <> ''"},
+		{Name: "recent_user", Definition: "select `id` AS `id` from `active_user`"},
+	}}
+	res := Compare(old, new)
+	if len(res.Views.Drop) != 1 || res.Views.Drop[0].Name != "legacy_user" {
+		t.Errorf("unexpected dropped views %+v", res.Views.Drop)
+	}
+	if len(res.Views.Create) != 1 || res.Views.Create[0].Name != "recent_user" {
+		t.Errorf("unexpected created views %+v", res.Views.Create)
+	}
+	if len(res.Views.Change) != 1 || res.Views.Change[0].Name != "named_user" {
+		t.Errorf("unexpected changed views %+v", res.Views.Change)
+	}
+
+	// string literals are compared as they are
+	new.Views[0].Definition = "select `id` AS `id` from `user` where `status` = 'ON'"
+	if res := Compare(old, new); len(res.Views.Change) != 2 {
+		t.Errorf("expect literal change to be detected, got %+v", res.Views.Change)
+	}
+}
+
+func TestNormalizeView(t *testing.T) {
+	same := [][2]string{
+		{"select id from user where status = 'on' and id > 10", "select `user`.`id` AS `id` from `user` where ((`user`.`status` = 'on') and (`user`.`id` > 10))"},
+		{"select name from app.user u where not deleted = 1", "select `u`.`name` AS `name` from `user` `u` where (not((`u`.`deleted` = 1)))"},
+		{"select a + b * c as x from t", "select (`t`.`a` + (`t`.`b` * `t`.`c`)) AS `x` from `t`"},
+		{"select id from t where a = 1 or b = 2 or c = 3", "select `t`.`id` AS `id` from `t` where ((`t`.`a` = 1) or ((`t`.`b` = 2) or (`t`.`c` = 3)))"},
+		{"select a - b - c as x from t", "select ((`t`.`a` - `t`.`b`) - `t`.`c`) AS `x` from `t`"},
+		{"select if(a = 1, b, c) as x from t where id in (1, 2)", "select if((`t`.`a` = 1),`t`.`b`,`t`.`c`) AS `x` from `t` where (`t`.`id` in (1,2))"},
+		{"select t1.id from t1 join t2 on t1.id = t2.id", "select `t1`.`id` AS `id` from (`t1` join `t2` on((`t1`.`id` = `t2`.`id`)))"},
+	}
+	for _, c := range same {
+		if normalizeview(c[0]) != normalizeview(c[1]) {
+			t.Errorf("expect %q and %q to be the same, got %q and %q", c[0], c[1], normalizeview(c[0]), normalizeview(c[1]))
+		}
+	}
+	different := [][2]string{
+		{"select id from t where (x = 1 or y = 2) and z = 3", "select id from t where x = 1 or (y = 2 and z = 3)"},
+		{"select (a + b) * c from t", "select a + b * c from t"},
+		{"select a - (b - c) from t", "select a - b - c from t"},
+		{"select not (a or b) from t", "select not a or b from t"},
+		{"select t1.id from t1 join t2 on t1.id = t2.id", "select t2.id from t1 join t2 on t1.id = t2.id"},
+		{"select id from t where id in (select id from t1)", "select id from t where id in (select id from t2)"},
+	}
+	for _, c := range different {
+		if normalizeview(c[0]) == normalizeview(c[1]) {
+			t.Errorf("expect %q and %q to differ, both are %q", c[0], c[1], normalizeview(c[0]))
+		}
+	}
+}
+
+func TestPlanViews(t *testing.T) {
+	result := &Result{Views: ResultViews{
+		Drop: []View{
+			{Name: "a", Definition: "select `id` from `b`"},
+			{Name: "b", Definition: "select `id` from `user`"},
+		},
+		Create: []View{
+			{Name: "x", Definition: "select id from y join z on y.id = z.id"},
+			{Name: "z", Definition: "select 'x' as id from user"},
+		},
+		Change: []View{
+			{Name: "y", Definition: "select `id` from `z`"},
+		},
+	}}
+	plan := NewPlan(result)
+	names := func(views []View) string {
+		s := make([]string, len(views))
+		for i, view := range views {
+			s[i] = view.Name
+		}
+		return strings.Join(s, ",")
+	}
+	if drop := names(plan.DropViews); drop != "a,b" {
+		t.Errorf("unexpected drop order %s", drop)
+	}
+	if create := names(plan.CreateViews); create != "z,y,x" {
+		t.Errorf("unexpected create order %s", create)
+	}
+}
+
+func TestComparePartitions(t *testing.T) {
+	ranges := func(bounds ...string) *Partition {
+		p := &Partition{Method: "RANGE", Expression: "`id`"}
+		for i, bound := range bounds {
+			p.Partitions = append(p.Partitions, PartitionDefinition{Name: fmt.Sprintf("p%d", i), Values: "LESS THAN (" + bound + ")"})
+		}
+		return p
+	}
+	old := ranges("10", "20")
+
+	if res := ComparePartitions(old, ranges("10", "20")); !res.IsEmpty() {
+		t.Errorf("expect no change, got %+v", res)
+	}
+	// quotes and spaces are ignored
+	same := &Partition{Method: "range", Expression: "id", Partitions: old.Partitions}
+	if res := ComparePartitions(old, same); !res.IsEmpty() {
+		t.Errorf("expect no change, got %+v", res)
+	}
+	if res := ComparePartitions(old, nil); !res.Remove {
+		t.Errorf("expect partitioning removed, got %+v", res)
+	}
+	if res := ComparePartitions(nil, old); res.Create != old {
+		t.Errorf("expect table partitioned, got %+v", res)
+	}
+	if res := ComparePartitions(old, &Partition{Method: "HASH", Expression: "id", Partitions: []PartitionDefinition{{Name: "p0"}}}); res.Create == nil {
+		t.Errorf("expect table partitioned again, got %+v", res)
+	}
+
+	res := ComparePartitions(old, ranges("10", "20", "30"))
+	if len(res.Add) != 1 || res.Add[0].Name != "p2" || len(res.Reorganize) != 0 {
+		t.Errorf("expect partition added, got %+v", res)
+	}
+
+	// a new boundary between kept partitions splits the partition after it
+	split := ranges("10", "15", "20")
+	split.Partitions[1].Name, split.Partitions[2].Name = "p15", "p1"
+	res = ComparePartitions(old, split)
+	if len(res.Add) != 0 || len(res.Reorganize) != 1 || len(res.Reorganize[0].Old) != 1 || res.Reorganize[0].Old[0].Name != "p1" || len(res.Reorganize[0].New) != 2 {
+		t.Errorf("expect partition reorganized, got %+v", res)
+	}
+
+	res = ComparePartitions(old, &Partition{Method: "RANGE", Expression: "id", Partitions: old.Partitions[1:]})
+	if len(res.Drop) != 1 || res.Drop[0].Name != "p0" || len(res.Reorganize) != 0 {
+		t.Errorf("expect partition dropped, got %+v", res)
+	}
+
+	lists := &Partition{Method: "LIST", Expression: "region", Partitions: []PartitionDefinition{
+		{Name: "east", Values: "IN (1,2)"},
+		{Name: "west", Values: "IN (3)"},
+	}}
+	changed := &Partition{Method: "LIST", Expression: "region", Partitions: []PartitionDefinition{
+		{Name: "east", Values: "IN (1)"},
+		{Name: "west", Values: "IN (2, 3)"},
+		{Name: "north", Values: "IN (4)"},
+	}}
+	res = ComparePartitions(lists, changed)
+	if len(res.Add) != 1 || res.Add[0].Name != "north" || len(res.Reorganize) != 1 || len(res.Reorganize[0].Old) != 2 {
+		t.Errorf("expect list partitions reorganized together, got %+v", res)
+	}
+}
+
+func TestCompareGenerated(t *testing.T) {
+	old := &Schema{Tables: []Table{{Name: "item", Fields: ResultFields{Create: []Field{
+		{Field: "total", Type: "int", Null: "YES", Extra: "VIRTUAL GENERATED", Expression: "(`price` * `qty`)"},
+		{Field: "tax", Type: "int", Null: "YES", Extra: "VIRTUAL GENERATED", Expression: "price / 10"},
+	}}}}}
+	new := &Schema{Tables: []Table{{Name: "item", Fields: ResultFields{Create: []Field{
+		{Field: "total", Type: "int", Null: "YES", Extra: "VIRTUAL GENERATED", Expression: "price * qty"},
+		{Field: "tax", Type: "int", Null: "YES", Extra: "STORED GENERATED", Expression: "price / 10"},
+	}}}}}
+	res := Compare(old, new)
+	if len(res.Change) != 1 {
+		t.Fatalf("unexpected change %+v", res.Change)
+	}
+	// a virtual column becoming stored is dropped and added again
+	fields := res.Change[0].Fields
+	if len(fields.Change) != 0 || len(fields.Drop) != 1 || len(fields.Add) != 1 || fields.Add[0].Field != "tax" {
+		t.Errorf("unexpected fields %+v", fields)
+	}
+}
+
+func TestCompareIndexParts(t *testing.T) {
+	// indexes read without key parts, like from older snapshots, have a part for each column
+	old := Index{Table: "post", NonUnique: 1, KeyName: "idx_title", ColumnName: []string{"title", "id"}, Collation: "A"}
+	new := old
+	new.Parts = []IndexPart{{Column: "title", Collation: "A"}, {Column: "id", Collation: "A"}}
+	if !old.Equal(new) {
+		t.Errorf("expect %+v equal to %+v", old, new)
+	}
+	new.Parts = []IndexPart{{Column: "title", SubPart: 32, Collation: "A"}, {Column: "id", Collation: "A"}}
+	if old.Equal(new) {
+		t.Error("expect prefix length to differ")
+	}
+	new.Parts = []IndexPart{{Column: "title", Collation: "A"}, {Column: "id", Collation: "D"}}
+	if old.Equal(new) {
+		t.Error("expect descending key part to differ")
+	}
+	new.Parts, new.Visible = nil, "NO"
+	if old.Equal(new) {
+		t.Error("expect invisible index to differ")
+	}
+}
+
+func TestCompareOrder(t *testing.T) {
+	old := &Schema{Tables: []Table{{Name: "user", Fields: ResultFields{Create: []Field{
+		{Field: "id", Type: "int(11)"},
+		{Field: "name", Type: "varchar(32)", After: "id"},
+		{Field: "email", Type: "varchar(64)", After: "name"},
+	}}}}}
+	new := &Schema{Tables: []Table{{Name: "user", Fields: ResultFields{Create: []Field{
+		{Field: "id", Type: "int(11)"},
+		{Field: "email", Type: "varchar(128)", After: "id"},
+		{Field: "name", Type: "varchar(32)", After: "email"},
+	}}}}}
+	res := Compare(old, new)
+	if len(res.Change) != 1 || len(res.Change[0].Fields.Change) != 1 {
+		t.Fatalf("unexpected change %+v", res.Change)
+	}
+	CompareOrder(old, new, res)
+	fields := res.Change[0].Fields
+	if len(fields.Move) != 1 || fields.Move[0].Field != "email" || fields.Move[0].Type != "varchar(128)" || len(fields.Change) != 0 {
+		t.Errorf("expect email moved along with its change, got %+v", fields)
+	}
+
+	// tables only differing in column order are changed too
+	new.Tables[0].Fields.Create[1].Type = "varchar(64)"
+	res = Compare(old, new)
+	if !res.IsEmpty() {
+		t.Fatalf("expect no change, got %+v", res)
+	}
+	CompareOrder(old, new, res)
+	if len(res.Change) != 1 || len(res.Change[0].Fields.Move) != 1 {
+		t.Errorf("unexpected change %+v", res.Change)
+	}
+}
@@ -0,0 +1,309 @@
+package dbdiffer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Loss is data that is lost when a result is applied
+type Loss struct {
+	Table  string
+	Column string // empty when more than a column is lost
+	Reason string
+	Rows   int64 // approximate number of rows of the table, 0 when unknown
+}
+
+func (l Loss) String() string {
+	subject := "table " + l.Table
+	if l.Column != "" {
+		subject = "column " + l.Table + "." + l.Column
+	}
+	return subject + ": " + l.Reason + rows(l.Rows)
+}
+
+// Losses finds out the data a result loses: dropped tables, columns and partitions,
+// and columns changed in a way their values may not survive, see LossyChange
+func Losses(result *Result) []Loss {
+	losses := make([]Loss, 0)
+	for _, table := range result.Drop {
+		losses = append(losses, Loss{Table: table.Name, Reason: "table is dropped", Rows: table.Rows})
+	}
+	for _, table := range result.Change {
+		for _, field := range table.Fields.Drop {
+			if field.Expression == "" {
+				// generated columns are computed from other columns
+				losses = append(losses, Loss{Table: table.Name, Column: field.Field, Reason: "column is dropped", Rows: table.Rows})
+			}
+		}
+		for _, rename := range table.Fields.Rename {
+			old := rename.Old
+			old.Field = rename.New.Field
+			if reason := LossyChange(old, rename.New); reason != "" {
+				losses = append(losses, Loss{Table: table.Name, Column: rename.New.Field, Reason: reason, Rows: table.Rows})
+			}
+		}
+		for _, change := range table.Fields.Change {
+			if reason := LossyChange(change.Old, change.New); reason != "" {
+				losses = append(losses, Loss{Table: table.Name, Column: change.New.Field, Reason: reason, Rows: table.Rows})
+			}
+		}
+		for _, field := range table.Fields.Move {
+			// moved columns are changed as they move
+			if old, exist := table.OldField(field.Field); exist {
+				if reason := LossyChange(old, field); reason != "" {
+					losses = append(losses, Loss{Table: table.Name, Column: field.Field, Reason: reason, Rows: table.Rows})
+				}
+			}
+		}
+		for _, partition := range table.Partitions.Drop {
+			losses = append(losses, Loss{Table: table.Name, Reason: "partition " + partition.Name + " is dropped", Rows: table.Rows})
+		}
+	}
+	return losses
+}
+
+// LossyChange tells why values of a column may be lost or changed when its definition changes from old to new,
+// or returns an empty string when they are kept. Types are narrowed when they hold smaller numbers,
+// fewer characters or less precision, changes between kinds of types, like from text to numbers, are taken as lossy.
+func LossyChange(old, new Field) string {
+	if lossytype(old.Type, new.Type) {
+		return "type is narrowed from " + old.Type + " to " + new.Type
+	}
+	if old.Null == "YES" && new.Null == "NO" && new.Default == nil && new.Expression == "" {
+		return "NULL values are not allowed anymore and there is no default"
+	}
+	if oldcharset, newcharset := charset(old.Collation), charset(new.Collation); lossycharset(oldcharset, newcharset) {
+		return "character set is downgraded from " + oldcharset + " to " + newcharset
+	}
+	return ""
+}
+
+// columntype is a column type like varchar(255), decimal(10,2) or int unsigned
+type columntype struct {
+	name     string
+	args     []string
+	unsigned bool
+}
+
+func parsetype(s string) columntype {
+	s = strings.ToLower(strings.TrimSpace(s))
+	t := columntype{}
+	if start := strings.Index(s, "("); start >= 0 {
+		end := strings.LastIndex(s, ")")
+		if end < start {
+			end = len(s)
+		}
+		t.name = strings.TrimSpace(s[:start])
+		for _, arg := range strings.Split(s[start+1:end], ",") {
+			t.args = append(t.args, strings.TrimSpace(arg))
+		}
+		if end < len(s) {
+			s = t.name + s[end+1:]
+		} else {
+			s = t.name
+		}
+	}
+	words := strings.Fields(s)
+	name := make([]string, 0, len(words))
+	for _, word := range words {
+		switch word {
+		case "unsigned":
+			t.unsigned = true
+		case "zerofill", "signed":
+		default:
+			name = append(name, word)
+		}
+	}
+	t.name = strings.Join(name, " ")
+	if alias, exist := typealiases[t.name]; exist {
+		t.name = alias
+	}
+	return t
+}
+
+// arg returns the argument at pos as a number, or def when it is not given
+func (t columntype) arg(pos int, def int64) int64 {
+	if pos >= len(t.args) {
+		return def
+	}
+	n, err := strconv.ParseInt(t.args[pos], 10, 64)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+var typealiases = map[string]string{
+	"integer":           "int",
+	"int4":              "int",
+	"int8":              "bigint",
+	"int2":              "smallint",
+	"bool":              "tinyint",
+	"boolean":           "tinyint",
+	"character varying": "varchar",
+	"character":         "char",
+	"bpchar":            "char",
+	"numeric":           "decimal",
+	"dec":               "decimal",
+	"double precision":  "double",
+	"real":              "float",
+	"float4":            "float",
+	"float8":            "double",
+}
+
+// bytes of integer types, characters of string types and bytes of binary types, for types without a length
+var typesizes = map[string]int64{
+	"tinyint":    1,
+	"smallint":   2,
+	"mediumint":  3,
+	"int":        4,
+	"bigint":     8,
+	"float":      4,
+	"double":     8,
+	"tinytext":   255,
+	"text":       65535,
+	"mediumtext": 16777215,
+	"longtext":   4294967295,
+	"tinyblob":   255,
+	"blob":       65535,
+	"mediumblob": 16777215,
+	"longblob":   4294967295,
+}
+
+var typefamilies = map[string]string{
+	"tinyint":    "integer",
+	"smallint":   "integer",
+	"mediumint":  "integer",
+	"int":        "integer",
+	"bigint":     "integer",
+	"float":      "float",
+	"double":     "float",
+	"decimal":    "decimal",
+	"char":       "string",
+	"varchar":    "string",
+	"tinytext":   "string",
+	"text":       "string",
+	"mediumtext": "string",
+	"longtext":   "string",
+	"binary":     "binary",
+	"varbinary":  "binary",
+	"tinyblob":   "binary",
+	"blob":       "binary",
+	"mediumblob": "binary",
+	"longblob":   "binary",
+	"enum":       "enum",
+	"set":        "enum",
+}
+
+// lossytype tells if values of the old type may not fit in the new one
+func lossytype(oldtype, newtype string) bool {
+	old, new := parsetype(oldtype), parsetype(newtype)
+	if old.name == "" || new.name == "" {
+		return false
+	}
+	family := typefamilies[old.name]
+	if family != typefamilies[new.name] {
+		return true
+	}
+	switch family {
+	case "integer":
+		if old.unsigned != new.unsigned {
+			// negative numbers are lost, or the upper half of unsigned ones when the new type is not larger
+			return new.unsigned || typesizes[new.name] <= typesizes[old.name]
+		}
+		return typesizes[new.name] < typesizes[old.name]
+	case "float":
+		return typesizes[new.name] < typesizes[old.name] || (!old.unsigned && new.unsigned)
+	case "decimal":
+		// digits before and after the point, decimal is decimal(10,0)
+		precision, scale := old.arg(0, 10), old.arg(1, 0)
+		newprecision, newscale := new.arg(0, 10), new.arg(1, 0)
+		return newscale < scale || newprecision-newscale < precision-scale || (!old.unsigned && new.unsigned)
+	case "string", "binary":
+		return length(new) < length(old)
+	case "enum":
+		// values of enum and set are kept when none of them is removed
+		values := make(map[string]bool, len(new.args))
+		for _, value := range new.args {
+			values[value] = true
+		}
+		for _, value := range old.args {
+			if !values[value] {
+				return true
+			}
+		}
+		return old.name != new.name
+	}
+	// other types are the same when their names are, arguments like bit(8) or datetime(6) may only grow
+	if old.name != new.name {
+		return !temporalwidened(old, new)
+	}
+	for pos := range old.args {
+		if new.arg(pos, 0) < old.arg(pos, 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// length returns the number of characters or bytes a string or binary type holds
+func length(t columntype) int64 {
+	if size, exist := typesizes[t.name]; exist {
+		return size
+	}
+	switch t.name {
+	case "char", "binary":
+		return t.arg(0, 1)
+	}
+	// varchar without a length, like in postgres, has no limit
+	return t.arg(0, typesizes["longtext"])
+}
+
+// temporalwidened tells if a date, time or timestamp is turned into a type holding all of its values
+func temporalwidened(old, new columntype) bool {
+	if old.name == new.name {
+		return false
+	}
+	switch old.name + " to " + new.name {
+	case "date to datetime", "timestamp to datetime", "date to timestamp without time zone", "timestamp without time zone to timestamp with time zone":
+		return new.arg(0, 0) >= old.arg(0, 0)
+	}
+	return false
+}
+
+// charset returns the character set of a mysql collation like utf8mb4_0900_ai_ci
+func charset(collation *string) string {
+	if collation == nil {
+		return ""
+	}
+	return strings.SplitN(*collation, "_", 2)[0]
+}
+
+// unicodecharsets hold any character, utf8 is utf8mb3 which holds no 4 byte characters
+var unicodecharsets = map[string]bool{"utf8mb4": true, "utf16": true, "utf16le": true, "utf32": true}
+
+var charsets = map[string]bool{
+	"ascii": true, "latin1": true, "latin2": true, "latin5": true, "latin7": true, "utf8": true, "utf8mb3": true, "utf8mb4": true,
+	"utf16": true, "utf16le": true, "utf32": true, "ucs2": true, "gbk": true, "gb2312": true, "gb18030": true, "big5": true,
+	"sjis": true, "ujis": true, "euckr": true, "cp1250": true, "cp1251": true, "cp1256": true, "cp1257": true, "binary": true,
+}
+
+// lossycharset tells if characters of the old mysql character set may not be held by the new one
+func lossycharset(old, new string) bool {
+	if old == new || !charsets[old] || !charsets[new] || old == "ascii" || unicodecharsets[new] {
+		return false
+	}
+	if (new == "utf8" || new == "utf8mb3") && !unicodecharsets[old] {
+		return false
+	}
+	return true
+}
+
+// rows tells the approximate number of rows of a table, when it is known
+func rows(n int64) string {
+	if n <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (about %d rows)", n)
+}
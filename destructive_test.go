@@ -0,0 +1,78 @@
+package dbdiffer
+
+import "testing"
+
+func TestLossyChange(t *testing.T) {
+	utf8mb4, utf8, latin1 := "utf8mb4_0900_ai_ci", "utf8_general_ci", "latin1_swedish_ci"
+	for _, c := range []struct {
+		old, new Field
+		lossy    bool
+	}{
+		{Field{Type: "varchar(255)"}, Field{Type: "varchar(50)"}, true},
+		{Field{Type: "varchar(50)"}, Field{Type: "varchar(255)"}, false},
+		{Field{Type: "varchar(255)"}, Field{Type: "text"}, false},
+		{Field{Type: "text"}, Field{Type: "varchar(255)"}, true},
+		{Field{Type: "character varying(64)"}, Field{Type: "character varying(32)"}, true},
+		{Field{Type: "bigint"}, Field{Type: "int"}, true},
+		{Field{Type: "int(11)"}, Field{Type: "int(10)"}, false},
+		{Field{Type: "int"}, Field{Type: "integer"}, false},
+		{Field{Type: "int unsigned"}, Field{Type: "bigint"}, false},
+		{Field{Type: "int unsigned"}, Field{Type: "int"}, true},
+		{Field{Type: "int"}, Field{Type: "bigint unsigned"}, true},
+		{Field{Type: "decimal(10,2)"}, Field{Type: "decimal(12,2)"}, false},
+		{Field{Type: "decimal(10,2)"}, Field{Type: "decimal(10,1)"}, true},
+		{Field{Type: "double"}, Field{Type: "float"}, true},
+		{Field{Type: "enum('a','b')"}, Field{Type: "enum('a','b','c')"}, false},
+		{Field{Type: "enum('a','b')"}, Field{Type: "enum('a')"}, true},
+		{Field{Type: "datetime"}, Field{Type: "date"}, true},
+		{Field{Type: "date"}, Field{Type: "datetime"}, false},
+		{Field{Type: "datetime(6)"}, Field{Type: "datetime"}, true},
+		{Field{Type: "varchar(16)"}, Field{Type: "int"}, true},
+		{Field{Type: "int", Null: "YES"}, Field{Type: "int", Null: "NO"}, true},
+		{Field{Type: "int", Null: "YES"}, Field{Type: "int", Null: "NO", Default: strptr("0")}, false},
+		{Field{Type: "text", Collation: &utf8mb4}, Field{Type: "text", Collation: &latin1}, true},
+		{Field{Type: "text", Collation: &utf8mb4}, Field{Type: "text", Collation: &utf8}, true},
+		{Field{Type: "text", Collation: &latin1}, Field{Type: "text", Collation: &utf8}, false},
+	} {
+		if reason := LossyChange(c.old, c.new); (reason != "") != c.lossy {
+			t.Errorf("%s %s to %s %s: expect lossy %v, got %q", c.old.Type, c.old.Null, c.new.Type, c.new.Null, c.lossy, reason)
+		}
+	}
+}
+
+func TestLosses(t *testing.T) {
+	old := &Schema{Tables: []Table{
+		{
+			Name: "user",
+			Rows: 1000,
+			Fields: ResultFields{Create: []Field{
+				{Field: "id", Type: "bigint", Null: "NO"},
+				{Field: "name", Type: "varchar(255)", Null: "NO"},
+				{Field: "legacy", Type: "text", Null: "YES"},
+			}},
+		},
+		{Name: "obsolete", Rows: 42},
+	}}
+	new := &Schema{Tables: []Table{{
+		Name: "user",
+		Fields: ResultFields{Create: []Field{
+			{Field: "id", Type: "bigint", Null: "NO"},
+			{Field: "name", Type: "varchar(50)", Null: "NO"},
+		}},
+	}}}
+
+	losses := Losses(Compare(old, new))
+	expect := []string{
+		"table obsolete: table is dropped (about 42 rows)",
+		"column user.legacy: column is dropped (about 1000 rows)",
+		"column user.name: type is narrowed from varchar(255) to varchar(50) (about 1000 rows)",
+	}
+	if len(losses) != len(expect) {
+		t.Fatalf("unexpected losses %+v", losses)
+	}
+	for i := range expect {
+		if losses[i].String() != expect[i] {
+			t.Errorf("expect %q, got %q", expect[i], losses[i].String())
+		}
+	}
+}
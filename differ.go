@@ -1,7 +1,15 @@
+// Package dbdiffer diffs the structure of two databases and generates the statements upgrading the old one to the new one.
+//
+// Drivers read a Schema with an Inspector, Compare turns two schemas into a Result, and a Differ generates
+// the statements of a result. A dropped and a created table with the same or nearly the same fields and indexes
+// and a similar name are taken as a rename, likewise a dropped and an added column with the same definition, position
+// and a similar name, Renames lists the ones that are not detected. Result.Reverse undoes a result, GenerateDown turns it into a rollback script,
+// and Losses tells what a result drops or converts.
 package dbdiffer
 
 import (
 	"reflect"
+	"strings"
 )
 
 var DriverList []string = []string{}
@@ -9,108 +17,844 @@ var DriverList []string = []string{}
 type Differ interface {
 	Close() error
 	Diff(prefix string) (*Result, error)
-	Generate(*Result) ([]string, error)
+	Generate(*Result) ([]Statement, error)
+	GenerateDown(*Result) ([]Statement, error)
 }
 
 type Result struct {
-	Drop   []Table
-	Create []Table
-	Change []Table
+	Drop     []Table
+	Create   []Table
+	Change   []Table
+	Rename   []TableRename
+	Views    ResultViews
+	Triggers ResultTriggers
+	Routines ResultRoutines
+	Events   ResultEvents
 }
 
 func (r Result) IsEmpty() bool {
-	return len(r.Drop) == 0 && len(r.Create) == 0 && len(r.Change) == 0
+	return len(r.Drop) == 0 && len(r.Create) == 0 && len(r.Change) == 0 && len(r.Rename) == 0 && r.Views.IsEmpty() && r.Triggers.IsEmpty() && r.Routines.IsEmpty() && r.Events.IsEmpty()
+}
+
+// TableRename is a table renamed from the Old definition to the New one,
+// what else changed in the table is in Result.Change under the new name
+type TableRename struct {
+	Old Table
+	New Table
 }
 
 type ResultFields struct {
 	Create []Field // used for creating table
 	Drop   []Field
-	Change []Field
+	Change []FieldChange
 	Add    []Field
+	Rename []FieldChange
+	Move   []Field // fields to put after their After field, in the order of the new table, set by CompareOrder
 }
 
 func (f ResultFields) IsEmpty() bool {
-	return len(f.Create) == 0 && len(f.Drop) == 0 && len(f.Change) == 0 && len(f.Add) == 0
+	return len(f.Create) == 0 && len(f.Drop) == 0 && len(f.Change) == 0 && len(f.Add) == 0 && len(f.Rename) == 0 && len(f.Move) == 0
+}
+
+// FieldChange is a field changed from the Old definition to the New one
+type FieldChange struct {
+	Old Field
+	New Field
 }
 
 type ResultIndexes struct {
 	Create []Index // used for creating table
 	Add    []Index
 	Drop   []Index
+	Engine string // engine of a changed table, which tells the default index type of added indexes
 }
 
 func (f ResultIndexes) IsEmpty() bool {
 	return len(f.Create) == 0 && len(f.Drop) == 0 && len(f.Add) == 0
 }
 
+type ResultConstraints struct {
+	Create []Constraint // used for creating table
+	Add    []Constraint
+	Drop   []Constraint
+}
+
+func (c ResultConstraints) IsEmpty() bool {
+	return len(c.Create) == 0 && len(c.Drop) == 0 && len(c.Add) == 0
+}
+
+type ResultPartitions struct {
+	Create     *Partition // used for creating table, on a changed table it partitions the table again
+	Remove     bool       // partitioning of a changed table is removed
+	Drop       []PartitionDefinition
+	Add        []PartitionDefinition
+	Reorganize []PartitionReorganize
+}
+
+func (p ResultPartitions) IsEmpty() bool {
+	return p.Create == nil && !p.Remove && len(p.Drop) == 0 && len(p.Add) == 0 && len(p.Reorganize) == 0
+}
+
+// PartitionReorganize replaces partitions of a changed table with new ones holding the same rows
+type PartitionReorganize struct {
+	Old []PartitionDefinition
+	New []PartitionDefinition
+}
+
+type ResultViews struct {
+	Drop   []View
+	Create []View
+	Change []View // holds the new definition, views are replaced as a whole
+	Old    []View // the old definitions of changed views, in the order of Change
+}
+
+func (v ResultViews) IsEmpty() bool {
+	return len(v.Drop) == 0 && len(v.Create) == 0 && len(v.Change) == 0
+}
+
+type ResultTriggers struct {
+	Drop   []Trigger
+	Create []Trigger
+	Change []Trigger // holds the new definition, triggers are dropped and created again
+	Old    []Trigger // the old definitions of changed triggers, in the order of Change
+}
+
+func (t ResultTriggers) IsEmpty() bool {
+	return len(t.Drop) == 0 && len(t.Create) == 0 && len(t.Change) == 0
+}
+
+type ResultRoutines struct {
+	Drop   []Routine
+	Create []Routine
+	Change []Routine // holds the new definition, routines are dropped and created again
+	Old    []Routine // the old definitions of changed routines, in the order of Change
+}
+
+func (r ResultRoutines) IsEmpty() bool {
+	return len(r.Drop) == 0 && len(r.Create) == 0 && len(r.Change) == 0
+}
+
+type ResultEvents struct {
+	Drop   []Event
+	Create []Event
+	Change []Event // holds the new definition, events are altered in place
+	Old    []Event // the old definitions of changed events, in the order of Change
+}
+
+func (e ResultEvents) IsEmpty() bool {
+	return len(e.Drop) == 0 && len(e.Create) == 0 && len(e.Change) == 0
+}
+
 type Table struct {
-	Name      string
-	Engine    string
-	Version   string
-	RowFormat string
-	Options   string
-	Comment   string
-	Collation string
-	Fields    ResultFields
-	Indexes   ResultIndexes
+	Name           string
+	Engine         string
+	Version        string
+	RowFormat      string
+	Options        string
+	Comment        string
+	Collation      string
+	Rows           int64 // approximate number of rows, not compared
+	DataLength     int64 // approximate size of the data in bytes, not compared
+	Fields         ResultFields
+	Indexes        ResultIndexes
+	Constraints    ResultConstraints
+	Partitions     ResultPartitions
+	SQL            []string `json:",omitempty"` // statements creating the table, its indexes and triggers as the database reports them, not compared
+	OptionsChanged bool     `json:",omitempty"` // the options of a changed table are changed to the ones above, empty ones included
+	Old            *Table   `json:",omitempty"` // the whole old definition of a changed table, to undo the change with
 }
 
+// Equal compares the options of tables. Options read from schema files may not be known,
+// an empty version, row format or collation is taken as the same as any, see samecollation.
 func (t Table) Equal(t2 Table) bool {
 	return t.Name == t2.Name &&
 		t.Engine == t2.Engine &&
-		t.Version == t2.Version &&
-		t.RowFormat == t2.RowFormat &&
+		sameoption(t.Version, t2.Version) &&
+		sameoption(t.RowFormat, t2.RowFormat) &&
 		t.Options == t2.Options &&
 		t.Comment == t2.Comment &&
-		t.Collation == t2.Collation
+		samecollation(t.Collation, t2.Collation)
+}
+
+// sameoption treats an option that is not known the same as any
+func sameoption(s, s2 string) bool {
+	return s == "" || s2 == "" || strings.EqualFold(s, s2)
+}
+
+// samecollation treats a collation that is not known the same as any, and a character set alone,
+// which stands for its default collation, the same as any collation of the character set
+func samecollation(c, c2 string) bool {
+	if c == "" || c2 == "" || c == c2 {
+		return true
+	}
+	charset, collate := splitcollation(c)
+	charset2, collate2 := splitcollation(c2)
+	return charset == charset2 && (collate == "" || collate2 == "")
+}
+
+// splitcollation returns the character set of a collation like utf8mb4_general_ci, and the rest of it
+func splitcollation(c string) (string, string) {
+	parts := strings.SplitN(strings.ToLower(c), "_", 2)
+	if parts[0] == "utf8mb3" {
+		// utf8 is called utf8mb3 by mysql 8.0.30 and later
+		parts[0] = "utf8"
+	}
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// OldField returns the old definition of a field of a changed table, by the name it had
+func (t Table) OldField(name string) (Field, bool) {
+	if t.Old == nil {
+		return Field{}, false
+	}
+	for _, field := range t.Old.Fields.Create {
+		if field.Field == name {
+			return field, true
+		}
+	}
+	return Field{}, false
 }
 
 func (t Table) IsEmpty() bool {
-	return t.Engine == "" && t.Version == "" && t.RowFormat == "" && t.Options == "" && t.Comment == "" && t.Collation == "" &&
-		t.Fields.IsEmpty() && t.Indexes.IsEmpty()
+	return !t.OptionsChanged && t.Engine == "" && t.Version == "" && t.RowFormat == "" && t.Options == "" && t.Comment == "" && t.Collation == "" &&
+		t.Fields.IsEmpty() && t.Indexes.IsEmpty() && t.Constraints.IsEmpty() && t.Partitions.IsEmpty()
 }
 
 type Field struct {
-	Field     string
-	Type      string
-	Collation *string
-	Null      string
-	Key       string
-	Default   *string
-	Extra     string
-	Comment   string
-	After     string
+	Field      string
+	Type       string
+	Collation  *string
+	Null       string
+	Key        string
+	Default    *string
+	Extra      string
+	Expression string // expression of a generated column
+	Comment    string
+	After      string
 }
 
 func (f Field) Equal(f2 Field) bool {
 	return f.Field == f2.Field &&
-		f.Type == f2.Type &&
-		((f.Collation == nil && f2.Collation == nil) || *f.Collation == *f2.Collation) &&
+		sametype(f.Type, f2.Type) &&
+		((f.Collation == nil && f2.Collation == nil) || (f.Collation != nil && f2.Collation != nil && samecollation(*f.Collation, *f2.Collation))) &&
 		f.Null == f2.Null &&
 		// f.Key == f2.Key &&
 		((f.Default == nil && f2.Default == nil) || (f.Default != nil && f2.Default != nil && *f.Default == *f2.Default)) &&
 		f.Extra == f2.Extra &&
+		normalizeexpression(f.Expression) == normalizeexpression(f2.Expression) &&
 		f.Comment == f2.Comment
 }
 
+// sametype compares column types. Mysql 8.0.19 and later only show the display width of integers
+// for tinyint(1) and zerofill columns, earlier versions always show it, so other widths are not compared.
+func sametype(t, t2 string) bool {
+	return integertype(t) == integertype(t2)
+}
+
+// integertype leaves out the display width of an integer type
+func integertype(t string) string {
+	lower := strings.ToLower(t)
+	if strings.HasPrefix(lower, "tinyint(1)") || strings.Contains(lower, "zerofill") {
+		return t
+	}
+	for _, integer := range []string{"tinyint", "smallint", "mediumint", "int", "bigint"} {
+		if !strings.HasPrefix(lower, integer+"(") {
+			continue
+		}
+		if end := strings.Index(t, ")"); end > 0 {
+			return t[:len(integer)] + t[end+1:]
+		}
+	}
+	return t
+}
+
+// Virtual tells if the field is a generated column that is not stored
+func (f Field) Virtual() bool {
+	return strings.Contains(f.Extra, "VIRTUAL GENERATED")
+}
+
 type Index struct {
 	Table        string
 	NonUnique    int
 	KeyName      string
-	ColumnName   []string
-	Collation    string
+	ColumnName   []string // columns, or expressions of functional key parts
+	Collation    string   // collation of the first key part
 	IndexType    string
 	Comment      string
 	IndexComment string
+	Parts        []IndexPart // details of each key part, derived from ColumnName when empty
+	Visible      string      // YES or NO
+	Parser       string      // full-text parser of a FULLTEXT index, like ngram
 }
 
 func (i Index) Equal(i2 Index) bool {
+	parts, parts2 := i.KeyParts(), i2.KeyParts()
+	if len(parts) != len(parts2) {
+		return false
+	}
+	for pos := range parts {
+		if !parts[pos].Equal(parts2[pos]) {
+			return false
+		}
+	}
 	return i.Table == i2.Table &&
 		i.NonUnique == i2.NonUnique &&
 		i.KeyName == i2.KeyName &&
-		reflect.DeepEqual(i.ColumnName, i2.ColumnName) &&
 		i.Collation == i2.Collation &&
 		i.IndexType == i2.IndexType &&
 		i.Comment == i2.Comment &&
-		i.IndexComment == i2.IndexComment
+		i.IndexComment == i2.IndexComment &&
+		option(i.Visible, "YES") == option(i2.Visible, "YES") &&
+		i.Parser == i2.Parser
+}
+
+// KeyParts returns the key parts of the index, indexes read without them have a part for each column
+func (i Index) KeyParts() []IndexPart {
+	if len(i.Parts) > 0 {
+		return i.Parts
+	}
+	parts := make([]IndexPart, len(i.ColumnName))
+	for pos, column := range i.ColumnName {
+		parts[pos] = IndexPart{Column: column}
+	}
+	if len(parts) > 0 {
+		parts[0].Collation = i.Collation
+	}
+	return parts
+}
+
+type IndexPart struct {
+	Column     string // empty for a functional key part
+	SubPart    int    // length of a column prefix, 0 for the whole column
+	Expression string // expression of a functional key part
+	Collation  string // A for ascending, D for descending, empty when not sorted
+}
+
+func (p IndexPart) Equal(p2 IndexPart) bool {
+	return p.Column == p2.Column &&
+		p.SubPart == p2.SubPart &&
+		normalizeexpression(p.Expression) == normalizeexpression(p2.Expression) &&
+		option(p.Collation, "A") == option(p2.Collation, "A")
+}
+
+// ForeignKey and Check are the types of constraints
+const (
+	ForeignKey string = "FOREIGN KEY"
+	Check      string = "CHECK"
+)
+
+type Constraint struct {
+	Name       string
+	Table      string
+	Type       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+	OnUpdate   string
+	OnDelete   string
+	Expression string // the condition of a check constraint
+	Enforced   string // YES or NO for a check constraint
+}
+
+func (c Constraint) Equal(c2 Constraint) bool {
+	return c.Name == c2.Name &&
+		c.Table == c2.Table &&
+		c.Type == c2.Type &&
+		reflect.DeepEqual(c.Columns, c2.Columns) &&
+		c.RefTable == c2.RefTable &&
+		reflect.DeepEqual(c.RefColumns, c2.RefColumns) &&
+		referentialaction(c.OnUpdate) == referentialaction(c2.OnUpdate) &&
+		referentialaction(c.OnDelete) == referentialaction(c2.OnDelete) &&
+		normalizeexpression(c.Expression) == normalizeexpression(c2.Expression) &&
+		option(c.Enforced, "YES") == option(c2.Enforced, "YES")
+}
+
+// normalizeexpression drops quotes of identifiers and parentheses around the whole expression,
+// databases show expressions with both added to what is written
+func normalizeexpression(s string) string {
+	s = normalizedefinition(strings.Replace(s, "`", "", -1))
+	for strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		depth := 0
+		for i := 0; i < len(s); i++ {
+			if s[i] == '(' {
+				depth++
+			} else if s[i] == ')' {
+				depth--
+				if depth == 0 && i < len(s)-1 {
+					// the first parenthesis closes before the end, like (a) and (b)
+					return s
+				}
+			}
+		}
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	return s
+}
+
+// referentialaction treats the default NO ACTION the same as RESTRICT
+func referentialaction(s string) string {
+	if s == "" || s == "NO ACTION" {
+		return "RESTRICT"
+	}
+	return s
+}
+
+// Partition is the partitioning of a table
+type Partition struct {
+	Method        string // RANGE, LIST, HASH or KEY, RANGE and LIST may have COLUMNS, HASH and KEY may be LINEAR
+	Expression    string // the expression or columns partitioned by
+	SubMethod     string // HASH or KEY, may be LINEAR
+	SubExpression string
+	Partitions    []PartitionDefinition
+}
+
+// SameScheme tells if two partitionings split rows the same way, regardless of their partitions
+func (p Partition) SameScheme(p2 Partition) bool {
+	return strings.EqualFold(p.Method, p2.Method) &&
+		normalizepartition(p.Expression) == normalizepartition(p2.Expression) &&
+		strings.EqualFold(p.SubMethod, p2.SubMethod) &&
+		normalizepartition(p.SubExpression) == normalizepartition(p2.SubExpression)
+}
+
+type PartitionDefinition struct {
+	Name          string
+	Values        string // like LESS THAN (100), LESS THAN MAXVALUE or IN (1, 2), empty for HASH and KEY
+	Comment       string
+	SubPartitions []string // names of sub partitions
+}
+
+func (d PartitionDefinition) Equal(d2 PartitionDefinition) bool {
+	return d.Name == d2.Name &&
+		normalizepartition(d.Values) == normalizepartition(d2.Values) &&
+		d.Comment == d2.Comment &&
+		strings.Join(d.SubPartitions, ",") == strings.Join(d2.SubPartitions, ",")
+}
+
+// normalizepartition ignores quotes of identifiers and spaces after commas, which mysql leaves out
+func normalizepartition(s string) string {
+	return strings.Replace(normalizeexpression(s), ", ", ",", -1)
+}
+
+type View struct {
+	Name        string
+	Definition  string // the SELECT statement
+	Algorithm   string // UNDEFINED, MERGE or TEMPTABLE
+	Security    string // DEFINER or INVOKER
+	CheckOption string // NONE, CASCADED or LOCAL
+}
+
+func (v View) Equal(v2 View) bool {
+	return v.Name == v2.Name &&
+		normalizeview(v.Definition) == normalizeview(v2.Definition) &&
+		option(v.Algorithm, "UNDEFINED") == option(v2.Algorithm, "UNDEFINED") &&
+		option(v.Security, "DEFINER") == option(v2.Security, "DEFINER") &&
+		option(v.CheckOption, "NONE") == option(v2.CheckOption, "NONE")
+}
+
+type Trigger struct {
+	Name      string
+	Table     string
+	Timing    string // BEFORE or AFTER
+	Event     string // INSERT, UPDATE or DELETE
+	Statement string // the body run for each row
+}
+
+func (t Trigger) Equal(t2 Trigger) bool {
+	return t.Name == t2.Name &&
+		t.Table == t2.Table &&
+		strings.EqualFold(t.Timing, t2.Timing) &&
+		strings.EqualFold(t.Event, t2.Event) &&
+		normalizedefinition(t.Statement) == normalizedefinition(t2.Statement)
+}
+
+// Procedure and Function are the types of routines
+const (
+	Procedure string = "PROCEDURE"
+	Function  string = "FUNCTION"
+)
+
+type Routine struct {
+	Name          string
+	Type          string // PROCEDURE or FUNCTION
+	Parameters    string // the parameter list without parentheses
+	Returns       string // the return type of functions
+	Deterministic bool
+	DataAccess    string // CONTAINS SQL, NO SQL, READS SQL DATA or MODIFIES SQL DATA
+	Security      string // DEFINER or INVOKER
+	Definer       string // the account like `user`@`host`
+	Comment       string
+	Body          string
+}
+
+// Key tells routines apart, a procedure and a function can have the same name
+func (r Routine) Key() string {
+	return r.Type + " " + r.Name
+}
+
+func (r Routine) Equal(r2 Routine) bool {
+	return r.Name == r2.Name &&
+		r.Type == r2.Type &&
+		normalizedefinition(r.Parameters) == normalizedefinition(r2.Parameters) &&
+		normalizedefinition(r.Returns) == normalizedefinition(r2.Returns) &&
+		r.Deterministic == r2.Deterministic &&
+		option(r.DataAccess, "CONTAINS SQL") == option(r2.DataAccess, "CONTAINS SQL") &&
+		option(r.Security, "DEFINER") == option(r2.Security, "DEFINER") &&
+		r.Definer == r2.Definer &&
+		r.Comment == r2.Comment &&
+		normalizedefinition(r.Body) == normalizedefinition(r2.Body)
+}
+
+// Event is a scheduled event, run either once At a time or Every interval
+type Event struct {
+	Name         string
+	At           string // the time of a one time event, like '2024-01-01 00:00:00'
+	Every        string // the interval of a recurring event, like 1 DAY
+	Starts       string // the first time of a recurring event, empty for when it is created
+	Ends         string
+	Status       string // ENABLED, DISABLED or SLAVESIDE_DISABLED
+	OnCompletion string // PRESERVE or NOT PRESERVE
+	Definer      string // the account like `user`@`host`
+	Comment      string
+	Body         string
+}
+
+func (e Event) Equal(e2 Event) bool {
+	return e.Name == e2.Name &&
+		e.At == e2.At &&
+		strings.EqualFold(e.Every, e2.Every) &&
+		// an event without a start starts when it is created, which is recorded as its start
+		(e.Starts == "" || e2.Starts == "" || e.Starts == e2.Starts) &&
+		e.Ends == e2.Ends &&
+		option(e.Status, "ENABLED") == option(e2.Status, "ENABLED") &&
+		option(e.OnCompletion, "NOT PRESERVE") == option(e2.OnCompletion, "NOT PRESERVE") &&
+		e.Definer == e2.Definer &&
+		e.Comment == e2.Comment &&
+		normalizedefinition(e.Body) == normalizedefinition(e2.Body)
+}
+
+// normalizedefinition collapses whitespace outside of quotes and lowercases keywords,
+// so that definitions only differing in layout are taken as the same
+func normalizedefinition(s string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// string literals and quoted identifiers are kept as they are
+			end := i + 1
+			for end < len(s) && s[end] != c {
+				if s[end] == '\\' && c != '`' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				end = len(s) - 1
+			}
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteString(s[i : end+1])
+			i = end
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			space = true
+		default:
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			if c >= 'A' && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			b.WriteByte(c)
+		}
+	}
+	return strings.TrimSuffix(b.String(), ";")
+}
+
+// normalizeview puts definitions of views in a form in which the one written in a schema file and the one shown by mysql are the same.
+// Mysql quotes identifiers, qualifies columns with their tables and tables with their schemas, aliases columns with their names
+// and puts conditions in parentheses. So quotes, schema qualifiers and such aliases are dropped, tables only qualify columns when
+// the view selects from more than one table, and parentheses are only kept where they change what the expression means.
+func normalizeview(s string) string {
+	s = normalizedefinition(strings.Replace(s, "`", "", -1))
+	toks := make([]string, 0)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != c {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				end = len(s) - 1
+			}
+			toks = append(toks, s[i:end+1])
+			i = end + 1
+		case isword(c):
+			end := i
+			for end < len(s) && isword(s[end]) {
+				end++
+			}
+			toks = append(toks, s[i:end])
+			i = end
+		case c == ' ':
+			i++
+		case strings.HasPrefix(s[i:], "<=>"):
+			toks = append(toks, s[i:i+3])
+			i += 3
+		case i+1 < len(s) && symbols[s[i:i+2]]:
+			toks = append(toks, s[i:i+2])
+			i += 2
+		default:
+			toks = append(toks, s[i:i+1])
+			i++
+		}
+	}
+
+	unqualified := make([]string, 0, len(toks))
+	for i := 0; i < len(toks); i++ {
+		if identifier(toks[i]) && i+2 < len(toks) && toks[i+1] == "." && identifier(toks[i+2]) &&
+			(i+4 < len(toks) && toks[i+3] == "." && identifier(toks[i+4]) || i > 0 && (toks[i-1] == "from" || toks[i-1] == "join")) {
+			// a schema qualifier of a column or table
+			i++
+			continue
+		}
+		unqualified = append(unqualified, toks[i])
+	}
+	single := singletable(unqualified)
+	toks = make([]string, 0, len(unqualified))
+	for i := 0; i < len(unqualified); i++ {
+		tok := unqualified[i]
+		if single[tok] && i+2 < len(unqualified) && unqualified[i+1] == "." && identifier(unqualified[i+2]) {
+			// the table of a column of a view selecting from a single table
+			i++
+			continue
+		}
+		if tok == "as" && i > 0 && i+1 < len(unqualified) && unqualified[i+1] == unqualified[i-1] {
+			// a column aliased with its own name
+			i++
+			continue
+		}
+		toks = append(toks, tok)
+	}
+
+	var b strings.Builder
+	last := byte(0)
+	for _, tok := range parentheses(toks) {
+		if isword(last) && isword(tok[0]) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(tok)
+		last = tok[len(tok)-1]
+	}
+	return b.String()
+}
+
+// symbols are the operators of two characters
+var symbols = map[string]bool{"<=": true, ">=": true, "<>": true, "!=": true, "||": true, "&&": true, "<<": true, ">>": true, ":=": true}
+
+// precedences of mysql operators, see https://dev.mysql.com/doc/refman/8.0/en/operator-precedence.html
+var precedences = map[string]int{
+	":=": 0, "or": 1, "||": 1, "xor": 2, "and": 3, "&&": 3, "not": 4,
+	"=": 5, "<=>": 5, ">=": 5, "<=": 5, "<>": 5, "!=": 5, "<": 5, ">": 5,
+	"is": 5, "like": 5, "escape": 5, "rlike": 5, "regexp": 5, "in": 5, "between": 5, "sounds": 5,
+	"|": 6, "&": 7, "<<": 8, ">>": 8, "+": 9, "-": 9, "*": 10, "/": 10, "%": 10, "div": 10, "mod": 10, "^": 11,
+	"!": 12, "~": 12, "collate": 13,
+}
+
+// expressions are the keywords followed by an expression, so that parentheses after them only group it
+var expressions = map[string]bool{"select": true, "distinct": true, "where": true, "on": true, "having": true, "when": true, "then": true, "else": true, "case": true, "by": true}
+
+// identifier tells whether the token is a name, not a number, literal or keyword
+func identifier(tok string) bool {
+	_, operator := precedences[tok]
+	return isword(tok[0]) && (tok[0] < '0' || tok[0] > '9') && !operator && !expressions[tok] && tok != "from" && tok != "join" && tok != "as"
+}
+
+// operand tells whether the token ends an operand, after which an operator is binary
+func operand(tok string) bool {
+	_, operator := precedences[tok]
+	return tok == ")" || tok[0] == '\'' || tok[0] == '"' || isword(tok[0]) && !operator && !expressions[tok]
+}
+
+// precedence returns the precedence of the token as an operator following prev, or -1 when it is not one.
+// Symbols that are not known are taken as operators of the lowest precedence.
+func precedence(prev, tok string) int {
+	switch {
+	case tok == "not" && (prev == "is" || prev != "" && operand(prev)):
+		// is not, not like, not in and not between compare
+		return 5
+	case (tok == "-" || tok == "+") && (prev == "" || !operand(prev)):
+		// unary minus and plus
+		return 12
+	}
+	if p, exist := precedences[tok]; exist {
+		return p
+	}
+	if isword(tok[0]) || tok[0] == '\'' || tok[0] == '"' || tok == "(" || tok == ")" || tok == "," || tok == "." {
+		return -1
+	}
+	return 0
+}
+
+// singletable returns the name and alias of the only table a view selects from, or nothing when it selects from more
+func singletable(toks []string) map[string]bool {
+	from := -1
+	for i, tok := range toks {
+		switch tok {
+		case "select":
+			if from >= 0 {
+				// subqueries and unions take columns of other tables
+				return nil
+			}
+		case "from":
+			from = i
+		}
+	}
+	if from < 0 {
+		return nil
+	}
+	names := make(map[string]bool)
+	for _, tok := range toks[from+1:] {
+		switch {
+		case tok == "where" || tok == "group" || tok == "having" || tok == "order" || tok == "limit" || tok == "window":
+			return names
+		case tok == "," || tok == "join" || tok == "(":
+			return nil
+		case identifier(tok):
+			names[tok] = true
+		}
+	}
+	return names
+}
+
+// parentheses drops the parentheses that group what the precedence of operators groups anyway,
+// like the ones mysql puts around every condition
+func parentheses(toks []string) []string {
+	out := make([]string, 0, len(toks))
+	for i := 0; i < len(toks); i++ {
+		if toks[i] != "(" {
+			out = append(out, toks[i])
+			continue
+		}
+		end, depth := i+1, 1
+		for ; end < len(toks); end++ {
+			if toks[end] == "(" {
+				depth++
+			} else if toks[end] == ")" {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		if end == len(toks) {
+			// not balanced, taken as it is
+			return append(out, toks[i:]...)
+		}
+		inner := parentheses(toks[i+1 : end])
+		left, prev := "", ""
+		if len(out) > 0 {
+			left = out[len(out)-1]
+		}
+		if len(out) > 1 {
+			prev = out[len(out)-2]
+		}
+		right := ""
+		if end+1 < len(toks) {
+			right = toks[end+1]
+		}
+		if redundant(prev, left, inner, right) {
+			out = append(out, inner...)
+		} else {
+			out = append(append(append(out, "("), inner...), ")")
+		}
+		i = end
+	}
+	return out
+}
+
+// redundant tells whether parentheses around inner, between the tokens left and right, can be dropped
+func redundant(prev, left string, inner []string, right string) bool {
+	if len(inner) == 0 || inner[0] == "select" || inner[0] == "with" {
+		return false
+	}
+	leftprecedence := 0
+	switch {
+	case left == "" || left == "(" || left == "," || left == "from" || expressions[left]:
+		// the joins of from are grouped from the left anyway
+	case left == "in":
+		// a list of values
+		return false
+	default:
+		leftprecedence = precedence(prev, left)
+		if leftprecedence < 0 {
+			// arguments of a function, or a derived table
+			return false
+		}
+	}
+	rightprecedence := 0
+	if right != "" {
+		if p := precedence(")", right); p > 0 {
+			rightprecedence = p
+		}
+	}
+
+	// the operators taking the rest of inner as their operands bind the least
+	least, operator, between := 100, "", false
+	depth, prev := 0, ""
+	for _, tok := range inner {
+		switch tok {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		case ",":
+			if depth == 0 {
+				// a list of values
+				return false
+			}
+		}
+		p := precedence(prev, tok)
+		prev = tok
+		if depth > 0 || p < 0 {
+			continue
+		}
+		switch {
+		case tok == "between":
+			between = true
+		case tok == "and" && between:
+			// the upper bound of between
+			between = false
+			continue
+		}
+		if p < least {
+			least, operator = p, tok
+		} else if p == least && tok != operator {
+			operator = ""
+		}
+	}
+	if least < rightprecedence {
+		return false
+	}
+	// and and or are associative, a and (b and c) is the same as a and b and c
+	return least > leftprecedence || least == leftprecedence && operator == left && (left == "and" || left == "or")
+}
+
+// option treats an empty option the same as its default
+func option(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return strings.ToUpper(s)
 }
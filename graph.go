@@ -0,0 +1,103 @@
+package dbdiffer
+
+// Graph is a dependency graph between named objects, like tables referencing each other by foreign keys
+type Graph struct {
+	nodes []string
+	pos   map[string]int
+	deps  map[string][]string
+}
+
+// NewGraph creates an empty graph
+func NewGraph() *Graph {
+	return &Graph{
+		nodes: []string{},
+		pos:   map[string]int{},
+		deps:  map[string][]string{},
+	}
+}
+
+// AddNode adds an object to the graph, adding the same object again has no effect
+func (g *Graph) AddNode(name string) {
+	if _, exist := g.pos[name]; exist {
+		return
+	}
+	g.pos[name] = len(g.nodes)
+	g.nodes = append(g.nodes, name)
+}
+
+// AddEdge records that an object depends on another one.
+// Dependencies on objects that are not in the graph and on the object itself are ignored when sorting.
+func (g *Graph) AddEdge(name, dependency string) {
+	g.AddNode(name)
+	g.deps[name] = append(g.deps[name], dependency)
+}
+
+// Sort orders the objects so that each one comes after its dependencies,
+// objects that do not depend on each other keep the order they are added in.
+// When a cycle leaves no object ready, the first object of the cycle is taken,
+// so callers have to split out whatever ties it to the objects that come later.
+func (g *Graph) Sort() []string {
+	indegree := make(map[string]int, len(g.nodes))
+	dependents := make(map[string][]string, len(g.nodes))
+	for _, name := range g.nodes {
+		seen := map[string]bool{}
+		for _, dependency := range g.deps[name] {
+			if _, exist := g.pos[dependency]; !exist || dependency == name || seen[dependency] {
+				continue
+			}
+			seen[dependency] = true
+			indegree[name]++
+			dependents[dependency] = append(dependents[dependency], name)
+		}
+	}
+
+	sorted := make([]string, 0, len(g.nodes))
+	done := make(map[string]bool, len(g.nodes))
+	for len(sorted) < len(g.nodes) {
+		next := ""
+		for _, name := range g.nodes {
+			if !done[name] && indegree[name] == 0 {
+				next = name
+				break
+			}
+		}
+		if next == "" {
+			// cycle, break it at the first remaining object that is part of one
+			for _, name := range g.nodes {
+				if !done[name] && g.cyclic(name, done) {
+					next = name
+					break
+				}
+			}
+		}
+		done[next] = true
+		sorted = append(sorted, next)
+		for _, dependent := range dependents[next] {
+			indegree[dependent]--
+		}
+	}
+	return sorted
+}
+
+// cyclic tells whether an object can reach itself through dependencies that are not sorted yet
+func (g *Graph) cyclic(name string, done map[string]bool) bool {
+	visited := map[string]bool{}
+	stack := []string{name}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, dependency := range g.deps[current] {
+			if _, exist := g.pos[dependency]; !exist || done[dependency] || dependency == current {
+				continue
+			}
+			if dependency == name {
+				return true
+			}
+			if !visited[dependency] {
+				visited[dependency] = true
+				stack = append(stack, dependency)
+			}
+		}
+	}
+	return false
+}
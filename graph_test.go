@@ -0,0 +1,78 @@
+package dbdiffer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGraphSort(t *testing.T) {
+	g := NewGraph()
+	g.AddNode("comment")
+	g.AddNode("post")
+	g.AddNode("user")
+	g.AddNode("tag")
+	g.AddEdge("comment", "post")
+	g.AddEdge("comment", "user")
+	g.AddEdge("post", "user")
+	g.AddEdge("post", "missing")
+	g.AddEdge("user", "user")
+	if sorted := strings.Join(g.Sort(), ","); sorted != "user,post,comment,tag" {
+		t.Errorf("unexpected order %s", sorted)
+	}
+
+	// a and b reference each other, c only depends on the cycle
+	g = NewGraph()
+	g.AddEdge("c", "a")
+	g.AddEdge("a", "b")
+	g.AddEdge("b", "a")
+	if sorted := strings.Join(g.Sort(), ","); sorted != "a,c,b" {
+		t.Errorf("unexpected order %s", sorted)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	fk := func(table, ref string) Constraint {
+		return Constraint{Name: table + "_ibfk_1", Table: table, Type: ForeignKey, Columns: []string{ref + "_id"}, RefTable: ref, RefColumns: []string{"id"}}
+	}
+	res := &Result{
+		Drop: []Table{
+			{Name: "a", Constraints: ResultConstraints{Create: []Constraint{fk("a", "b")}}},
+			{Name: "b", Constraints: ResultConstraints{Create: []Constraint{fk("b", "a")}}},
+			{Name: "c", Constraints: ResultConstraints{Create: []Constraint{fk("c", "a")}}},
+		},
+		Create: []Table{
+			{Name: "post", Constraints: ResultConstraints{Create: []Constraint{fk("post", "user")}}},
+			{Name: "user", Constraints: ResultConstraints{Create: []Constraint{fk("user", "profile")}}},
+			{Name: "tag", Constraints: ResultConstraints{Create: []Constraint{fk("tag", "category")}}},
+		},
+		Change: []Table{{Name: "profile"}},
+	}
+	plan := NewPlan(res)
+
+	names := func(tables []Table) string {
+		s := make([]string, 0, len(tables))
+		for _, table := range tables {
+			s = append(s, table.Name)
+		}
+		return strings.Join(s, ",")
+	}
+	if names(plan.Drop) != "c,b,a" {
+		t.Errorf("unexpected drop order %s", names(plan.Drop))
+	}
+	if len(plan.DropConstraints) != 1 || plan.DropConstraints[0].Table != "a" {
+		t.Errorf("unexpected dropped constraints %+v", plan.DropConstraints)
+	}
+	if names(plan.Create) != "user,post,tag" {
+		t.Errorf("unexpected create order %s", names(plan.Create))
+	}
+	// user references the changed profile table, tag references an existing one
+	if len(plan.Create[0].Constraints.Create) != 0 || len(plan.Create[1].Constraints.Create) != 1 || len(plan.Create[2].Constraints.Create) != 1 {
+		t.Errorf("unexpected inline constraints %+v", plan.Create)
+	}
+	if len(plan.AddConstraints) != 1 || plan.AddConstraints[0].Table != "user" {
+		t.Errorf("unexpected added constraints %+v", plan.AddConstraints)
+	}
+	if len(res.Create[1].Constraints.Create) != 1 {
+		t.Errorf("result is modified %+v", res.Create)
+	}
+}
@@ -0,0 +1,218 @@
+package mysql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sillydong/dbdiffer"
+)
+
+// Version is a mysql server version, like 8.0.29
+type Version [3]int
+
+// ParseVersion reads a version like 5.7, 8.0 or 8.0.29, suffixes like -log are ignored
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	s = strings.SplitN(strings.TrimSpace(s), "-", 2)[0]
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return v, fmt.Errorf("invalid mysql version %q", s)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return v, fmt.Errorf("invalid mysql version %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+func (v Version) less(v2 Version) bool {
+	for i := range v {
+		if v[i] != v2[i] {
+			return v[i] < v2[i]
+		}
+	}
+	return false
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// operations of ALTER TABLE clauses, which tell how mysql can run them
+const (
+	addindex     = "add index"
+	addfulltext  = "add fulltext index"
+	addspatial   = "add spatial index"
+	dropindex    = "drop index"
+	addprimary   = "add primary key"
+	dropprimary  = "drop primary key"
+	addcolumn    = "add column"
+	addvirtual   = "add virtual column"
+	addstored    = "add stored column"
+	addserial    = "add auto_increment column"
+	dropcolumn   = "drop column"
+	dropvirtual  = "drop virtual column"
+	renamecolumn = "rename column"
+	movecolumn   = "move column"
+	changecolumn = "change column"
+	// changes of a column definition that run without a copy
+	changecomment = "change column comment"
+	changedefault = "change column default"
+	widenvarchar  = "widen varchar column"
+)
+
+// rule is how mysql runs an operation since a version
+type rule struct {
+	operation string
+	since     Version
+	algorithm string // INSTANT, INPLACE or COPY
+	lock      string // NONE or SHARED, INSTANT takes no lock
+	rebuild   bool
+}
+
+// rules follow the online DDL tables of the mysql manual, the last rule of an operation
+// the version is at least at applies. Changes of column definitions other than the ones of
+// changeoperation are taken as needing a copy.
+var rules = []rule{
+	{addindex, Version{5, 6, 0}, "INPLACE", "NONE", false},
+	{addfulltext, Version{5, 6, 0}, "INPLACE", "SHARED", true},
+	{addspatial, Version{5, 7, 0}, "INPLACE", "SHARED", false},
+	{dropindex, Version{5, 6, 0}, "INPLACE", "NONE", false},
+	{addprimary, Version{5, 6, 0}, "INPLACE", "NONE", true},
+	{dropprimary, Version{5, 6, 0}, "COPY", "SHARED", true},
+	{addcolumn, Version{5, 6, 0}, "INPLACE", "NONE", true},
+	{addcolumn, Version{8, 0, 29}, "INSTANT", "", false},
+	{addvirtual, Version{5, 7, 0}, "INPLACE", "NONE", false},
+	{addvirtual, Version{8, 0, 12}, "INSTANT", "", false},
+	{addstored, Version{5, 7, 0}, "COPY", "SHARED", true},
+	{addserial, Version{5, 6, 0}, "INPLACE", "SHARED", true},
+	{dropcolumn, Version{5, 6, 0}, "INPLACE", "NONE", true},
+	{dropcolumn, Version{8, 0, 29}, "INSTANT", "", false},
+	{dropvirtual, Version{5, 7, 0}, "INPLACE", "NONE", false},
+	{dropvirtual, Version{8, 0, 12}, "INSTANT", "", false},
+	{renamecolumn, Version{5, 6, 0}, "INPLACE", "NONE", false},
+	{renamecolumn, Version{8, 0, 28}, "INSTANT", "", false},
+	{movecolumn, Version{5, 6, 0}, "INPLACE", "NONE", true},
+	{changecolumn, Version{5, 6, 0}, "COPY", "SHARED", true},
+	{changecomment, Version{5, 6, 0}, "INPLACE", "NONE", false},
+	{changedefault, Version{5, 6, 0}, "INPLACE", "NONE", false},
+	{changedefault, Version{8, 0, 0}, "INSTANT", "", false},
+	{widenvarchar, Version{5, 7, 0}, "INPLACE", "NONE", false},
+}
+
+// changeoperation tells the operation changing the definition of a column from old to new.
+// Comments and defaults only change metadata, a varchar is widened in place as long as its length
+// is stored in as many bytes, other changes copy the table.
+func changeoperation(old, new dbdiffer.Field) string {
+	old.After = new.After
+	metadata := old
+	metadata.Comment, metadata.Default = new.Comment, new.Default
+	if metadata.Equal(new) {
+		if old.Comment != new.Comment {
+			return changecomment
+		}
+		return changedefault
+	}
+	widened := old
+	widened.Type = new.Type
+	if !widened.Equal(new) {
+		return changecolumn
+	}
+	oldlength, newlength := varcharlength(old.Type), varcharlength(new.Type)
+	if oldlength == 0 || newlength <= oldlength {
+		return changecolumn
+	}
+	// lengths of up to 255 bytes take one byte, longer ones two
+	bytes := 4
+	if new.Collation != nil {
+		if n, exist := charsetbytes[charset(*new.Collation)]; exist {
+			bytes = n
+		}
+	}
+	if (oldlength*bytes > 255) != (newlength*bytes > 255) {
+		return changecolumn
+	}
+	return widenvarchar
+}
+
+// charsetbytes are the most bytes a character takes in a character set, unknown ones are taken as 4
+var charsetbytes = map[string]int{
+	"ascii": 1, "latin1": 1, "latin2": 1, "binary": 1,
+	"gbk": 2, "ucs2": 2, "utf8": 3, "utf8mb3": 3, "utf8mb4": 4,
+}
+
+// varcharlength returns the length of a varchar type, or 0 for other types
+func varcharlength(t string) int {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if !strings.HasPrefix(t, "varchar(") || !strings.HasSuffix(t, ")") {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(t[len("varchar(") : len(t)-1]))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+var algorithms = map[string]int{"INSTANT": 0, "INPLACE": 1, "COPY": 2}
+
+// planalter finds out the least algorithm and lock all operations of a statement run with,
+// and whether the statement rebuilds the table. Operations without a rule for the version are copied.
+func planalter(version Version, operations []string) (algorithm, lock string, rebuild bool) {
+	primary := false
+	for _, operation := range operations {
+		if operation == addprimary {
+			primary = true
+		}
+	}
+	algorithm = "INSTANT"
+	for _, operation := range operations {
+		if operation == dropprimary && primary {
+			// the primary key is replaced in place
+			operation = addprimary
+		}
+		r := rule{operation: operation, algorithm: "COPY", lock: "SHARED", rebuild: true}
+		for _, candidate := range rules {
+			if candidate.operation == operation && !version.less(candidate.since) {
+				r = candidate
+			}
+		}
+		if algorithms[r.algorithm] > algorithms[algorithm] {
+			algorithm = r.algorithm
+		}
+		if r.lock == "SHARED" || (r.lock == "NONE" && lock == "") {
+			lock = r.lock
+		}
+		rebuild = rebuild || r.rebuild
+	}
+	if algorithm == "INSTANT" {
+		lock = ""
+	}
+	return algorithm, lock, rebuild
+}
+
+// stricter returns the one of the operations that needs the stricter algorithm and lock, or rebuilds the table
+func stricter(version Version, operation, other string) string {
+	algorithm, lock, rebuild := planalter(version, []string{operation, other})
+	if a, l, r := planalter(version, []string{operation}); a == algorithm && l == lock && r == rebuild {
+		return operation
+	}
+	return other
+}
+
+// sqlalgorithm returns the ALGORITHM and LOCK clauses of the statement, and a comment telling whether it rebuilds the table
+func sqlalgorithm(version Version, operations []string) (string, string) {
+	algorithm, lock, rebuild := planalter(version, operations)
+	sql := ", ALGORITHM=" + algorithm
+	if lock != "" {
+		sql += ", LOCK=" + lock
+	}
+	if rebuild {
+		return sql, " -- rebuilds the table"
+	}
+	return sql, " -- does not rebuild the table"
+}
@@ -1,9 +1,24 @@
+// Package mysql diffs mysql databases, schema files of CREATE statements like mysqldump --no-data writes them,
+// and snapshots of either.
+//
+// Along with tables it diffs views by their definitions, triggers by their timing, event, table and body,
+// routines by their parameters, characteristics, definer and body, and events by their schedule, status and body.
+// Changed views are replaced after tables are changed, changed triggers and routines are dropped and created again,
+// changed events are altered. CHECK constraints are read from mysql 8.0.16. Partitioned tables are partitioned again
+// when the method or expression changes, range and list partitions are added, dropped and reorganized otherwise.
+// Generated columns turning virtual or back are dropped and added again, as mysql cannot change them in place.
+// Indexes are compared by each key part, including prefix lengths, descending and functional key parts.
+//
+// Options change how statements are generated: WithDefiner, WithColumnOrder, WithCombinedAlter,
+// WithOnlineSchemaChange and WithVersion.
 package mysql
 
 import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 
 	"github.com/go-sql-driver/mysql"
@@ -17,50 +32,132 @@ func init() {
 }
 
 type Driver struct {
-	newDb *sql.DB
-	oldDb *sql.DB
+	new     dbdiffer.Inspector
+	old     dbdiffer.Inspector
+	definer *string
+	order   bool
+	combine bool
+	osc     *OnlineSchemaChange
+	version *Version
+	renames dbdiffer.Renames
 }
 
+// Option configures a Driver
+type Option func(*Driver)
+
+// WithDefiner creates routines and events with the given DEFINER, like `app`@`%`, instead of the one they are read with,
+// so that definers differing between environments are not taken as changes.
+// An empty definer leaves DEFINER out, they are then defined by the account running the statements.
+func WithDefiner(definer string) Option {
+	return func(d *Driver) {
+		d.definer = &definer
+	}
+}
+
+// WithColumnOrder also moves columns so that they are in the order of the new database,
+// without it columns keep their positions and only added columns are put in place.
+func WithColumnOrder() Option {
+	return func(d *Driver) {
+		d.order = true
+	}
+}
+
+// WithRenames applies renames to the result of Diff, before columns are moved by WithColumnOrder,
+// so that renamed columns are moved rather than dropped and added again.
+func WithRenames(renames dbdiffer.Renames) Option {
+	return func(d *Driver) {
+		d.renames = renames
+	}
+}
+
+// WithCombinedAlter changes each table with a single ALTER TABLE, so that a large table is rebuilt once,
+// instead of a statement for each index and column.
+func WithCombinedAlter() Option {
+	return func(d *Driver) {
+		d.combine = true
+	}
+}
+
+// WithVersion adds ALGORITHM and LOCK to ALTER TABLE statements, the ones the mysql server of the version runs them with
+// while allowing as many concurrent queries as it can, so that statements fail rather than copy tables unexpectedly.
+// A comment after each statement tells whether it rebuilds the table.
+func WithVersion(version Version) Option {
+	return func(d *Driver) {
+		d.version = &version
+	}
+}
+
+// GhOst and PtOnlineSchemaChange are the supported online schema change tools
+const (
+	GhOst                string = "gh-ost"
+	PtOnlineSchemaChange string = "pt-online-schema-change"
+)
+
+// OnlineSchemaChange changes large tables with an online schema change tool instead of ALTER TABLE
+type OnlineSchemaChange struct {
+	Tool      string // GhOst or PtOnlineSchemaChange
+	Host      string // host of the old database, defaults to the one of the old DSN
+	Port      string // port of the old database, defaults to the one of the old DSN
+	Socket    string // unix socket of the old database instead of host and port, defaults to the one of the old DSN
+	User      string // user of the old database, defaults to the one of the old DSN
+	Database  string // database of the changed tables, defaults to the one of the old DSN
+	Threshold int64  // tables with at least so many bytes of data are changed with the tool
+}
+
+// WithOnlineSchemaChange generates a command line of the tool for each large table to change,
+// holding the changes of its indexes and columns. Foreign keys and partitions are still changed with ALTER TABLE.
+// The commands connect to the old database, the password is not written, the tools ask for it with --ask-pass
+// when the old DSN has one. Connection arguments neither given nor read from the old DSN, like when it is a file,
+// are left out and the tools fall back to their defaults, gh-ost does not connect through a socket.
+func WithOnlineSchemaChange(osc OnlineSchemaChange) Option {
+	return func(d *Driver) {
+		d.osc = &osc
+	}
+}
+
+// FilePrefix marks a DSN as a path to a file, either CREATE TABLE statements like file://schema.sql
+// or a snapshot like file://snapshot.json
+const FilePrefix string = dbdiffer.FilePrefix
+
 // New creates a new Driver driver.
 // The DSN is documented here: https://github.com/go-sql-driver/mysql#dsn-data-source-name
-func New(newDsn, oldDsn string) (dbdiffer.Differ, error) {
-	parsedNewDSN, err := mysql.ParseDSN(newDsn)
+// Either DSN can also be a schema file or a snapshot prefixed with file://
+func New(newDsn, oldDsn string, options ...Option) (dbdiffer.Differ, error) {
+	newInspector, oldInspector, err := dbdiffer.OpenInspectors(Open, newDsn, oldDsn)
 	if err != nil {
 		return nil, err
 	}
+	return NewFromInspectors(newInspector, oldInspector, options...), nil
+}
 
-	parsedNewDSN.MultiStatements = true
-	newDb, err := sql.Open("mysql", parsedNewDSN.FormatDSN())
-	if err != nil {
-		return nil, err
-	}
-	if err := newDb.Ping(); err != nil {
-		return nil, err
+// Open returns an inspector of the DSN, which accepts the same values as New
+func Open(dsn string) (dbdiffer.Inspector, error) {
+	if strings.HasPrefix(dsn, FilePrefix) {
+		path := strings.TrimPrefix(dsn, FilePrefix)
+		if strings.HasSuffix(strings.ToLower(path), ".json") {
+			return dbdiffer.LoadDriverSnapshot(path, MySQL)
+		}
+		return ParseFile(path)
 	}
 
-	parsedOldDSN, err := mysql.ParseDSN(oldDsn)
+	parsedDSN, err := mysql.ParseDSN(dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	parsedOldDSN.MultiStatements = true
-	oldDb, err := sql.Open("mysql", parsedOldDSN.FormatDSN())
+	parsedDSN.MultiStatements = true
+	db, err := sql.Open("mysql", parsedDSN.FormatDSN())
 	if err != nil {
 		return nil, err
 	}
-	if err := oldDb.Ping(); err != nil {
+	if err := db.Ping(); err != nil {
 		return nil, err
 	}
-
-	d := &Driver{
-		newDb: newDb,
-		oldDb: oldDb,
-	}
-	return d, nil
+	return &inspector{db: db, config: parsedDSN}, nil
 }
 
 // NewFromDB returns a mysql driver from a sql.DB
-func NewFromDB(newDb, oldDb *sql.DB) (dbdiffer.Differ, error) {
+func NewFromDB(newDb, oldDb *sql.DB, options ...Option) (dbdiffer.Differ, error) {
 	if _, ok := newDb.Driver().(*mysql.MySQLDriver); !ok {
 		return nil, errors.New("new database instance is not using the MySQL driver")
 	}
@@ -76,244 +173,520 @@ func NewFromDB(newDb, oldDb *sql.DB) (dbdiffer.Differ, error) {
 		return nil, err
 	}
 
+	return NewFromInspectors(NewInspector(newDb), NewInspector(oldDb), options...), nil
+}
+
+// NewFromInspectors returns a mysql driver comparing structures from any inspectors,
+// inspectors implementing io.Closer are closed with the driver.
+func NewFromInspectors(newInspector, oldInspector dbdiffer.Inspector, options ...Option) dbdiffer.Differ {
 	d := &Driver{
-		newDb: newDb,
-		oldDb: oldDb,
+		new: newInspector,
+		old: oldInspector,
+	}
+	for _, option := range options {
+		option(d)
 	}
-	return d, nil
+	return d
 }
 
 // Close closes the connection to the Driver server.
 func (d *Driver) Close() error {
-	err := d.newDb.Close()
-	if err != nil {
-		return err
-	}
-
-	err = d.oldDb.Close()
-	if err != nil {
-		return err
-	}
-	return nil
+	return dbdiffer.CloseInspectors(d.new, d.old)
 }
 
 func (d *Driver) Diff(prefix string) (diff *dbdiffer.Result, err error) {
 	//retrive new database structure
-	newtables, newtablespos, err := tables(d.newDb, prefix)
+	newschema, err := d.new.Inspect(prefix)
 	if err != nil {
 		return nil, err
 	}
-	newtablefields := make(map[string][]dbdiffer.Field, len(newtables))
-	newtablefieldspos := make(map[string]map[string]int, len(newtables))
-	newtableindexes := make(map[string][]dbdiffer.Index, len(newtables))
-	newtableindexespos := make(map[string]map[string]int, len(newtables))
-	for _, table := range newtables {
-		newtablefields[table.Name], newtablefieldspos[table.Name], err = fields(d.newDb, table.Name)
-		if err != nil {
-			return nil, err
-		}
-		newtableindexes[table.Name], newtableindexespos[table.Name], err = indexes(d.newDb, table.Name)
-		if err != nil {
-			return nil, err
-		}
-	}
 
 	//retrive old database structure
-	oldtables, oldtablespos, err := tables(d.oldDb, prefix)
+	oldschema, err := d.old.Inspect(prefix)
 	if err != nil {
 		return nil, err
 	}
-	oldtablefields := make(map[string][]dbdiffer.Field, len(oldtables))
-	oldtablefieldspos := make(map[string]map[string]int, len(oldtables))
-	oldtableindexes := make(map[string][]dbdiffer.Index, len(oldtables))
-	oldtableindexespos := make(map[string]map[string]int, len(oldtables))
-	for _, table := range oldtables {
-		oldtablefields[table.Name], oldtablefieldspos[table.Name], err = fields(d.oldDb, table.Name)
-		if err != nil {
-			return nil, err
-		}
-		oldtableindexes[table.Name], oldtableindexespos[table.Name], err = indexes(d.oldDb, table.Name)
-		if err != nil {
-			return nil, err
+
+	if d.definer != nil {
+		for _, schema := range []*dbdiffer.Schema{newschema, oldschema} {
+			for pos := range schema.Routines {
+				schema.Routines[pos].Definer = *d.definer
+			}
+			for pos := range schema.Events {
+				schema.Events[pos].Definer = *d.definer
+			}
 		}
 	}
 
-	//compare
-	result := dbdiffer.Result{
-		Drop:   []dbdiffer.Table{},
-		Create: []dbdiffer.Table{},
-		Change: []dbdiffer.Table{},
+	result := dbdiffer.Compare(oldschema, newschema)
+	if err := d.renames.Apply(result); err != nil {
+		return nil, err
 	}
-
-	//table
-	for _, olddetail := range oldtables {
-		//table is not exist in new database, drop it
-		if _, exist := newtablespos[olddetail.Name]; !exist {
-			result.Drop = append(result.Drop, olddetail)
-		}
+	if d.order {
+		dbdiffer.CompareOrder(oldschema, newschema, result)
 	}
-	for _, newdetail := range newtables {
-		//create tables, create fields, create indexes
-		if _, exist := oldtablespos[newdetail.Name]; !exist {
-			newdetail.Fields.Create = newtablefields[newdetail.Name]
-			newdetail.Indexes.Create = newtableindexes[newdetail.Name]
-			result.Create = append(result.Create, newdetail)
-		} else {
-			//diff tables
-			change := dbdiffer.Table{
-				Name:    newdetail.Name,
-				Fields:  dbdiffer.ResultFields{},
-				Indexes: dbdiffer.ResultIndexes{},
-			}
-			olddetail := oldtables[oldtablespos[newdetail.Name]]
-			if !olddetail.Equal(newdetail) {
-				change = newdetail
-			}
-
-			newindexes := newtableindexes[newdetail.Name]
-			newindexespos := newtableindexespos[newdetail.Name]
-			oldindexes := oldtableindexes[olddetail.Name]
-			oldindexespos := oldtableindexespos[olddetail.Name]
-
-			for _, oldindex := range oldindexes {
-				if pos, exist := newindexespos[oldindex.KeyName]; !exist {
-					// drop index
-					change.Indexes.Drop = append(change.Indexes.Drop, oldindex)
-				} else {
-					// alter index
-					if oldindex.Equal(newindexes[pos]) {
-						continue
-					}
-					change.Indexes.Drop = append(change.Indexes.Drop, oldindex)
-					change.Indexes.Add = append(change.Indexes.Add, newindexes[pos])
-				}
-			}
-			for _, newindex := range newindexes {
-				if _, exist := oldindexespos[newindex.KeyName]; !exist {
-					// add index
-					change.Indexes.Add = append(change.Indexes.Add, newindex)
-				}
-			}
+	return result, nil
+}
 
-			newfields := newtablefields[newdetail.Name]
-			newfieldspos := newtablefieldspos[newdetail.Name]
-			oldfields := oldtablefields[olddetail.Name]
-			oldfieldspos := oldtablefieldspos[olddetail.Name]
+// clause is a change of ALTER TABLE, with the operation telling how mysql runs it
+type clause struct {
+	sql         string
+	operation   string
+	kind        string
+	name        string // the column or index changed
+	destructive bool
+}
 
-			for _, oldfield := range oldfields {
-				if pos, exist := newfieldspos[oldfield.Field]; !exist {
-					// drop field
-					change.Fields.Drop = append(change.Fields.Drop, oldfield)
-				} else {
-					// alter field
-					if oldfield.Equal(newfields[pos]) {
-						continue
-					}
-					change.Fields.Change = append(change.Fields.Change, newfields[pos])
-				}
-			}
+// defaultversion is the version ALTER TABLE statements are planned for when it is not given, to tell whether they rebuild tables
+var defaultversion = Version{5, 7, 0}
 
-			for _, newfield := range newfields {
-				if _, exist := oldfieldspos[newfield.Field]; !exist {
-					// add field
-					change.Fields.Add = append(change.Fields.Add, newfield)
-				}
+// plannedversion returns the version ALTER TABLE statements are planned for
+func (d *Driver) plannedversion() Version {
+	if d.version != nil {
+		return *d.version
+	}
+	return defaultversion
+}
+
+// alter returns the ALTER TABLE statement of the clauses, planning ALGORITHM and LOCK when the server version is known
+func (d *Driver) alter(table string, clauses ...clause) dbdiffer.Statement {
+	sqls := make([]string, 0, len(clauses))
+	operations := make([]string, 0, len(clauses))
+	descriptions := make([]string, 0, len(clauses))
+	destructive := false
+	for _, c := range clauses {
+		sqls = append(sqls, c.sql)
+		operations = append(operations, c.operation)
+		descriptions = append(descriptions, c.kind+" "+c.name)
+		destructive = destructive || c.destructive
+	}
+	statement := dbdiffer.NewStatement("ALTER TABLE `"+table+"` "+strings.Join(sqls, ", "), dbdiffer.AlterTable, table, table+": "+strings.Join(descriptions, ", "))
+	if len(clauses) == 1 {
+		statement = dbdiffer.NewStatement(statement.SQL, clauses[0].kind, table, table+"."+clauses[0].name)
+	}
+	statement.Destructive = destructive
+	_, _, statement.RebuildsTable = planalter(d.plannedversion(), operations)
+	if d.version == nil {
+		statement.SQL += ";"
+		return statement
+	}
+	algorithm, comment := sqlalgorithm(*d.version, operations)
+	statement.SQL += algorithm + ";" + comment
+	return statement
+}
+
+// onlineschemachange returns the command line changing the table with the online schema change tool
+func (d *Driver) onlineschemachange(table string, clauses []clause) dbdiffer.Statement {
+	osc, askpass := d.connection()
+	sqls := make([]string, 0, len(clauses))
+	destructive := false
+	for _, c := range clauses {
+		sqls = append(sqls, c.sql)
+		destructive = destructive || c.destructive
+	}
+	alter := shellquote(strings.Join(sqls, ", "))
+	// the tool copies the table to change it
+	statement := dbdiffer.NewStatement("", dbdiffer.AlterTable, table, table+" with "+d.osc.Tool)
+	statement.Destructive, statement.RebuildsTable = destructive, true
+	if osc.Tool == PtOnlineSchemaChange {
+		dsn := make([]string, 0, 6)
+		for _, arg := range [][2]string{{"h", osc.Host}, {"P", osc.Port}, {"S", osc.Socket}, {"u", osc.User}, {"D", osc.Database}, {"t", table}} {
+			if arg[1] != "" {
+				dsn = append(dsn, arg[0]+"="+arg[1])
 			}
+		}
+		command := PtOnlineSchemaChange
+		if askpass {
+			command += " --ask-pass"
+		}
+		statement.SQL = command + " --alter " + alter + " " + shellquote(strings.Join(dsn, ",")) + " --execute"
+		return statement
+	}
+	command := GhOst
+	for _, arg := range [][2]string{{"host", osc.Host}, {"port", osc.Port}, {"user", osc.User}, {"database", osc.Database}} {
+		if arg[1] != "" {
+			command += " --" + arg[0] + "=" + shellquote(arg[1])
+		}
+	}
+	if askpass {
+		command += " --ask-pass"
+	}
+	statement.SQL = command + " --table=" + shellquote(table) + " --alter=" + alter + " --execute"
+	return statement
+}
 
-			if !change.IsEmpty() {
-				result.Change = append(result.Change, change)
+// connection returns the online schema change with the connection arguments left empty taken from the old DSN,
+// and whether the DSN has a password
+func (d *Driver) connection() (OnlineSchemaChange, bool) {
+	osc := *d.osc
+	i, ok := d.old.(*inspector)
+	if !ok || i.config == nil {
+		return osc, false
+	}
+	config := i.config
+	if osc.Host == "" && osc.Socket == "" {
+		if config.Net == "unix" {
+			osc.Socket = config.Addr
+		} else if host, port, err := net.SplitHostPort(config.Addr); err == nil {
+			osc.Host = host
+			if osc.Port == "" {
+				osc.Port = port
 			}
 		}
 	}
+	if osc.User == "" {
+		osc.User = config.User
+	}
+	if osc.Database == "" {
+		osc.Database = config.DBName
+	}
+	return osc, config.Passwd != ""
+}
 
-	return &result, nil
+func shellquote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
 }
 
-func (d *Driver) Generate(result *dbdiffer.Result) ([]string, error) {
-	sqls := make([]string, 0)
+// Generate returns the statements of the result. Triggers, routines and events whose body holds more than one statement
+// are run as they are through a driver, the mysql client needs them wrapped by Delimit.
+func (d *Driver) Generate(result *dbdiffer.Result) ([]dbdiffer.Statement, error) {
+	statements := make([]dbdiffer.Statement, 0)
 	if result.IsEmpty() {
-		return sqls, nil
+		return statements, nil
 	}
-	if len(result.Drop) > 0 {
-		for _, table := range result.Drop {
-			sqls = append(sqls, "DROP TABLE IF EXISTS `"+table.Name+"`;")
+	// tables are renamed first, changes of renamed tables are under the new name
+	for _, rename := range result.Rename {
+		statements = append(statements, dbdiffer.NewStatement("RENAME TABLE `"+rename.Old.Name+"` TO `"+rename.New.Name+"`;", dbdiffer.RenameTable, rename.New.Name, rename.Old.Name+" to "+rename.New.Name))
+	}
+	plan := dbdiffer.NewPlan(result)
+	// foreign keys are dropped first, so that tables, indexes and columns they rely on can be dropped
+	for _, table := range result.Change {
+		for _, constraint := range table.Constraints.Drop {
+			statements = append(statements, dbdiffer.NewStatement("ALTER TABLE `"+constraint.Table+"` "+sqldropconstraint(constraint)+";", dbdiffer.DropConstraint, constraint.Table, constraint.Table+"."+constraint.Name))
 		}
 	}
-	if len(result.Create) > 0 {
-		for _, table := range result.Create {
-			sql := "CREATE TABLE IF NOT EXISTS `" + table.Name + "` ("
-			fieldstr := make([]string, 0)
-			for _, field := range table.Fields.Create {
-				fieldstr = append(fieldstr, "`"+field.Field+"` "+field.Type+sqlnull(field.Null)+sqldefault(field.Type, field.Default)+sqlextra(field.Extra)+sqlcomment(field.Comment))
-			}
-			for _, index := range table.Indexes.Create {
-				if index.KeyName == "PRIMARY" {
-					fieldstr = append(fieldstr, " PRIMARY KEY (`"+strings.Join(index.ColumnName, "`, `")+"`)")
-				} else {
-					fieldstr = append(fieldstr, sqluniq(index.NonUnique)+" `"+index.KeyName+"` (`"+strings.Join(index.ColumnName, "`, `")+"`)")
-				}
+	for _, constraint := range plan.DropConstraints {
+		statements = append(statements, dbdiffer.NewStatement("ALTER TABLE `"+constraint.Table+"` DROP FOREIGN KEY `"+constraint.Name+"`;", dbdiffer.DropConstraint, constraint.Table, constraint.Table+"."+constraint.Name))
+	}
+	// triggers are dropped before the tables and columns they use
+	for _, trigger := range result.Triggers.Drop {
+		statements = append(statements, dbdiffer.NewStatement("DROP TRIGGER IF EXISTS `"+trigger.Name+"`;", dbdiffer.DropTrigger, trigger.Table, trigger.Name))
+	}
+	for _, trigger := range result.Triggers.Change {
+		statements = append(statements, dbdiffer.NewStatement("DROP TRIGGER IF EXISTS `"+trigger.Name+"`;", dbdiffer.DropTrigger, trigger.Table, trigger.Name))
+	}
+	// views are dropped before the tables they select from
+	for _, view := range plan.DropViews {
+		statements = append(statements, dbdiffer.NewStatement("DROP VIEW IF EXISTS `"+view.Name+"`;", dbdiffer.DropView, view.Name, view.Name))
+	}
+	for _, table := range plan.Drop {
+		statement := dbdiffer.NewStatement("DROP TABLE IF EXISTS `"+table.Name+"`;", dbdiffer.DropTable, table.Name, table.Name)
+		statement.Destructive = true
+		statements = append(statements, statement)
+	}
+	for _, table := range plan.Create {
+		sql := "CREATE TABLE IF NOT EXISTS `" + table.Name + "` ("
+		fieldstr := make([]string, 0)
+		for _, field := range table.Fields.Create {
+			fieldstr = append(fieldstr, "`"+field.Field+"` "+field.Type+sqlgenerated(field)+sqlnull(field.Null)+sqldefault(field.Type, field.Default)+sqlextra(field.Extra)+sqlcomment(field.Comment))
+		}
+		for _, index := range table.Indexes.Create {
+			if index.KeyName == "PRIMARY" {
+				fieldstr = append(fieldstr, " PRIMARY KEY "+sqlindexparts(index)+sqlindextype(index.IndexType, table.Engine))
+			} else {
+				fieldstr = append(fieldstr, sqlindex(index, table.Engine))
 			}
-			chars := strings.Split(table.Collation, "_")
-			sql += strings.Join(fieldstr, ", ") + ") ENGINE = " + table.Engine + " DEFAULT CHARSET = " + chars[0] + ";"
-			sqls = append(sqls, sql)
 		}
+		for _, constraint := range table.Constraints.Create {
+			fieldstr = append(fieldstr, sqlconstraint(constraint))
+		}
+		sql += strings.Join(fieldstr, ", ") + ") ENGINE = " + table.Engine
+		if table.Collation != "" {
+			// without a character set the table gets the default of the database
+			sql += " DEFAULT CHARSET = " + charset(table.Collation)
+		}
+		if table.Partitions.Create != nil {
+			sql += " " + sqlpartition(table.Partitions.Create)
+		}
+		statements = append(statements, dbdiffer.NewStatement(sql+";", dbdiffer.CreateTable, table.Name, table.Name))
 	}
 	if len(result.Change) > 0 {
 		for _, table := range result.Change {
-			if table.Engine != "" || table.RowFormat != "" || table.Comment != "" || table.Collation != "" {
+			if table.OptionsChanged || table.Engine != "" || table.RowFormat != "" || table.Comment != "" || table.Collation != "" {
 				// table structure has changed
+				// options that are not known are left as they are
 				sql := "ALTER TABLE `" + table.Name + "`"
-				sql += " ENGIINE = '" + table.Engine + "'"
-				sql += " ROWFORMAT = '" + table.RowFormat + "'"
-				sql += " COMMENT = '" + table.Comment + "'"
-				chars := strings.Split(table.Collation, "_")
-				sql += " DEFAULT CHARACTER SET " + chars[0] + " COLLATE " + table.Collation
-
-				sqls = append(sqls, sql+";")
-			}
-			if len(table.Indexes.Drop) > 0 {
-				for _, index := range table.Indexes.Drop {
-					if index.KeyName == "PRIMARY" {
-						sqls = append(sqls, "ALTER TABLE `"+index.Table+"` DROP PRIMARY KEY;")
-					} else {
-						sqls = append(sqls, "ALTER TABLE `"+index.Table+"` DROP INDEX `"+index.KeyName+"`;")
-					}
+				if table.Engine != "" {
+					sql += " ENGINE = " + table.Engine
+				}
+				if table.RowFormat != "" {
+					sql += " ROW_FORMAT = " + strings.ToUpper(table.RowFormat)
+				}
+				sql += " COMMENT = '" + escape(table.Comment) + "'"
+				if table.Collation != "" {
+					sql += " DEFAULT CHARACTER SET " + charset(table.Collation) + sqlcollate(table.Collation)
+				}
+
+				statement := dbdiffer.NewStatement(sql+";", dbdiffer.AlterTable, table.Name, table.Name)
+				// changing the engine or row format copies the table
+				statement.RebuildsTable = table.Old == nil || table.Old.Engine != table.Engine || (table.RowFormat != "" && table.Old.RowFormat != table.RowFormat)
+				statements = append(statements, statement)
+			}
+			// clauses are in the order they work in, indexes are dropped before their columns and added after them
+			clauses := make([]clause, 0)
+			for _, index := range table.Indexes.Drop {
+				if index.KeyName == "PRIMARY" {
+					clauses = append(clauses, clause{"DROP PRIMARY KEY", dropprimary, dbdiffer.DropIndex, index.KeyName, false})
+				} else {
+					clauses = append(clauses, clause{"DROP INDEX `" + index.KeyName + "`", dropindex, dbdiffer.DropIndex, index.KeyName, false})
 				}
 			}
-			if len(table.Fields.Drop) > 0 {
-				for _, field := range table.Fields.Drop {
-					sqls = append(sqls, "ALTER TABLE `"+table.Name+"` DROP `"+field.Field+"`;")
+			for _, field := range table.Fields.Drop {
+				operation := dropcolumn
+				if field.Virtual() {
+					operation = dropvirtual
 				}
+				// generated columns are computed again from other columns
+				clauses = append(clauses, clause{"DROP `" + field.Field + "`", operation, dbdiffer.DropColumn, field.Field, field.Expression == ""})
 			}
-			if len(table.Fields.Add) > 0 {
-				for _, field := range table.Fields.Add {
-					sqls = append(sqls, "ALTER TABLE `"+table.Name+"` ADD `"+field.Field+"` "+field.Type+sqlcol(field.Collation)+sqlnull(field.Null)+sqldefault(field.Type, field.Default)+sqlextra(field.Extra)+sqlcomment(field.Comment)+after(field.After)+";")
+			for _, rename := range table.Fields.Rename {
+				field := rename.New
+				operation := renamecolumn
+				renamed := rename.Old
+				renamed.Field, renamed.Comment = field.Field, field.Comment
+				if !renamed.Equal(field) {
+					operation = changecolumn
 				}
+				clauses = append(clauses, clause{"CHANGE `" + rename.Old.Field + "` `" + field.Field + "` " + field.Type + sqlcol(field.Collation) + sqlgenerated(field) + sqlnull(field.Null) + sqldefault(field.Type, field.Default) + sqlextra(field.Extra) + sqlcomment(field.Comment), operation, dbdiffer.RenameColumn, rename.Old.Field + " to " + field.Field, dbdiffer.LossyChange(renamed, field) != ""})
 			}
-			if len(table.Fields.Change) > 0 {
-				for _, field := range table.Fields.Change {
-					sqls = append(sqls, "ALTER TABLE `"+table.Name+"` CHANGE `"+field.Field+"` `"+field.Field+"` "+field.Type+sqlcol(field.Collation)+sqlnull(field.Null)+sqldefault(field.Type, field.Default)+sqlextra(field.Extra)+sqlcomment(field.Comment)+";")
+			for _, field := range table.Fields.Add {
+				operation := addcolumn
+				switch {
+				case field.Virtual():
+					operation = addvirtual
+				case strings.Contains(field.Extra, "STORED GENERATED"):
+					operation = addstored
+				case strings.Contains(field.Extra, "auto_increment"):
+					operation = addserial
 				}
+				clauses = append(clauses, clause{"ADD `" + field.Field + "` " + field.Type + sqlcol(field.Collation) + sqlgenerated(field) + sqlnull(field.Null) + sqldefault(field.Type, field.Default) + sqlextra(field.Extra) + sqlcomment(field.Comment) + after(field.After), operation, dbdiffer.AddColumn, field.Field, false})
 			}
-			if len(table.Indexes.Add) > 0 {
-				for _, index := range table.Indexes.Add {
-					if index.KeyName == "PRIMARY" {
-						sqls = append(sqls, "ALTER TABLE `"+index.Table+"` ADD PRIMARY KEY (`"+strings.Join(index.ColumnName, "`, `")+"`);")
-					} else {
-						sqls = append(sqls, "ALTER TABLE `"+index.Table+"` ADD "+sqluniq(index.NonUnique)+" `"+index.KeyName+"` (`"+strings.Join(index.ColumnName, "`, `")+"`);")
-					}
+			// columns are moved in the order of the new table, after added columns are in place
+			for _, field := range table.Fields.Move {
+				old, exist := table.OldField(field.Field)
+				operation := movecolumn
+				if exist {
+					// the column may be changed while it is moved
+					operation = stricter(d.plannedversion(), movecolumn, changeoperation(old, field))
 				}
+				clauses = append(clauses, clause{"CHANGE `" + field.Field + "` `" + field.Field + "` " + field.Type + sqlcol(field.Collation) + sqlgenerated(field) + sqlnull(field.Null) + sqldefault(field.Type, field.Default) + sqlextra(field.Extra) + sqlcomment(field.Comment) + after(field.After), operation, dbdiffer.MoveColumn, field.Field, exist && dbdiffer.LossyChange(old, field) != ""})
 			}
+			for _, change := range table.Fields.Change {
+				field := change.New
+				clauses = append(clauses, clause{"CHANGE `" + field.Field + "` `" + field.Field + "` " + field.Type + sqlcol(field.Collation) + sqlgenerated(field) + sqlnull(field.Null) + sqldefault(field.Type, field.Default) + sqlextra(field.Extra) + sqlcomment(field.Comment), changeoperation(change.Old, field), dbdiffer.ChangeColumn, field.Field, dbdiffer.LossyChange(change.Old, field) != ""})
+			}
+			for _, index := range table.Indexes.Add {
+				switch {
+				case index.KeyName == "PRIMARY":
+					clauses = append(clauses, clause{"ADD PRIMARY KEY " + sqlindexparts(index) + sqlindextype(index.IndexType, table.Indexes.Engine), addprimary, dbdiffer.AddIndex, index.KeyName, false})
+				case index.IndexType == "FULLTEXT":
+					clauses = append(clauses, clause{"ADD " + sqlindex(index, table.Indexes.Engine), addfulltext, dbdiffer.AddIndex, index.KeyName, false})
+				case index.IndexType == "SPATIAL":
+					clauses = append(clauses, clause{"ADD " + sqlindex(index, table.Indexes.Engine), addspatial, dbdiffer.AddIndex, index.KeyName, false})
+				default:
+					clauses = append(clauses, clause{"ADD " + sqlindex(index, table.Indexes.Engine), addindex, dbdiffer.AddIndex, index.KeyName, false})
+				}
+			}
+			switch {
+			case len(clauses) == 0:
+			case d.osc != nil && table.DataLength >= d.osc.Threshold:
+				statements = append(statements, d.onlineschemachange(table.Name, clauses))
+			case d.combine:
+				statements = append(statements, d.alter(table.Name, clauses...))
+			default:
+				for _, c := range clauses {
+					statements = append(statements, d.alter(table.Name, c))
+				}
+			}
+			// partitions are changed on their own, as mysql does not take them along with other changes
+			if table.Partitions.Remove {
+				statement := dbdiffer.NewStatement("ALTER TABLE `"+table.Name+"` REMOVE PARTITIONING;", dbdiffer.PartitionTable, table.Name, table.Name)
+				statement.RebuildsTable = true
+				statements = append(statements, statement)
+			}
+			if table.Partitions.Create != nil {
+				statement := dbdiffer.NewStatement("ALTER TABLE `"+table.Name+"` "+sqlpartition(table.Partitions.Create)+";", dbdiffer.PartitionTable, table.Name, table.Name)
+				statement.RebuildsTable = true
+				statements = append(statements, statement)
+			}
+			if len(table.Partitions.Drop) > 0 {
+				statement := dbdiffer.NewStatement("ALTER TABLE `"+table.Name+"` DROP PARTITION "+partitionnames(table.Partitions.Drop)+";", dbdiffer.DropPartition, table.Name, table.Name+" "+partitionnames(table.Partitions.Drop))
+				statement.Destructive = true
+				statements = append(statements, statement)
+			}
+			for _, reorganize := range table.Partitions.Reorganize {
+				statements = append(statements, dbdiffer.NewStatement("ALTER TABLE `"+table.Name+"` REORGANIZE PARTITION "+partitionnames(reorganize.Old)+" INTO ("+sqlpartitiondefinitions(reorganize.New)+");", dbdiffer.ReorganizePartition, table.Name, table.Name+" "+partitionnames(reorganize.Old)))
+			}
+			if len(table.Partitions.Add) > 0 {
+				statements = append(statements, dbdiffer.NewStatement("ALTER TABLE `"+table.Name+"` ADD PARTITION ("+sqlpartitiondefinitions(table.Partitions.Add)+");", dbdiffer.AddPartition, table.Name, table.Name+" "+partitionnames(table.Partitions.Add)))
+			}
+		}
+	}
+	// foreign keys are added last, when referenced tables, indexes and columns exist
+	for _, table := range result.Change {
+		for _, constraint := range table.Constraints.Add {
+			statements = append(statements, dbdiffer.NewStatement("ALTER TABLE `"+constraint.Table+"` ADD "+sqlconstraint(constraint)+";", dbdiffer.AddConstraint, constraint.Table, constraint.Table+"."+constraint.Name))
 		}
 	}
+	for _, constraint := range plan.AddConstraints {
+		statements = append(statements, dbdiffer.NewStatement("ALTER TABLE `"+constraint.Table+"` ADD "+sqlforeignkey(constraint)+";", dbdiffer.AddConstraint, constraint.Table, constraint.Table+"."+constraint.Name))
+	}
+	// routines are created before the views and triggers using them
+	for _, routine := range result.Routines.Drop {
+		statements = append(statements, dbdiffer.NewStatement("DROP "+routine.Type+" IF EXISTS `"+routine.Name+"`;", dbdiffer.DropRoutine, routine.Name, routine.Name))
+	}
+	for _, routine := range result.Routines.Change {
+		statements = append(statements, dbdiffer.NewStatement("DROP "+routine.Type+" IF EXISTS `"+routine.Name+"`;", dbdiffer.DropRoutine, routine.Name, routine.Name))
+		statements = append(statements, dbdiffer.NewStatement(sqlroutine(routine), dbdiffer.CreateRoutine, routine.Name, routine.Name))
+	}
+	for _, routine := range result.Routines.Create {
+		statements = append(statements, dbdiffer.NewStatement(sqlroutine(routine), dbdiffer.CreateRoutine, routine.Name, routine.Name))
+	}
+	// views are created last, when the tables they select from are in their final shape
+	for _, view := range plan.CreateViews {
+		statements = append(statements, dbdiffer.NewStatement(sqlview(view)+";", dbdiffer.CreateView, view.Name, view.Name))
+	}
+	for _, trigger := range result.Triggers.Change {
+		statements = append(statements, dbdiffer.NewStatement(sqltrigger(trigger), dbdiffer.CreateTrigger, trigger.Table, trigger.Name))
+	}
+	for _, trigger := range result.Triggers.Create {
+		statements = append(statements, dbdiffer.NewStatement(sqltrigger(trigger), dbdiffer.CreateTrigger, trigger.Table, trigger.Name))
+	}
+	for _, event := range result.Events.Drop {
+		statements = append(statements, dbdiffer.NewStatement("DROP EVENT IF EXISTS `"+event.Name+"`;", dbdiffer.DropEvent, event.Name, event.Name))
+	}
+	for _, event := range result.Events.Change {
+		statements = append(statements, dbdiffer.NewStatement(sqlevent("ALTER", event), dbdiffer.AlterEvent, event.Name, event.Name))
+	}
+	for _, event := range result.Events.Create {
+		statements = append(statements, dbdiffer.NewStatement(sqlevent("CREATE", event), dbdiffer.CreateEvent, event.Name, event.Name))
+	}
 
-	return sqls, nil
+	return statements, nil
+}
+
+// GenerateDown returns the statements undoing the result, see dbdiffer.GenerateDown
+func (d *Driver) GenerateDown(result *dbdiffer.Result) ([]dbdiffer.Statement, error) {
+	return dbdiffer.GenerateDown(d, result)
+}
+
+// Delimit wraps triggers, routines and events whose body holds more than one statement in DELIMITER commands,
+// so that the statement can be run by the mysql client, other statements are returned as they are
+func Delimit(statement dbdiffer.Statement) string {
+	switch statement.Kind {
+	case dbdiffer.CreateTrigger, dbdiffer.CreateRoutine, dbdiffer.CreateEvent, dbdiffer.AlterEvent:
+		sql := strings.TrimSuffix(statement.SQL, ";")
+		if compound(sql) {
+			return "DELIMITER ;;\n" + sql + ";;\nDELIMITER ;"
+		}
+	}
+	return statement.SQL
+}
+
+// compound tells whether the sql holds a semicolon outside of strings, quoted names and comments
+func compound(sql string) bool {
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == ';':
+			return true
+		case c == '\'' || c == '"' || c == '`':
+			for i++; i < len(sql) && sql[i] != c; i++ {
+				if sql[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case c == '#' || (c == '-' && strings.HasPrefix(sql[i:], "-- ")):
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return false
+			}
+			i += end + 3
+		}
+	}
+	return false
+}
+
+// inspector reads the structure from a live database
+type inspector struct {
+	db     *sql.DB
+	config *mysql.Config // connection of the DSN it is opened with, nil when opened from a sql.DB
+}
+
+// NewInspector returns an inspector reading the structure from the database
+func NewInspector(db *sql.DB) dbdiffer.Inspector {
+	return &inspector{db: db}
+}
+
+func (i *inspector) Close() error {
+	return i.db.Close()
+}
+
+func (i *inspector) Inspect(prefix string) (*dbdiffer.Schema, error) {
+	tables, _, err := tables(i.db, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for pos, table := range tables {
+		tables[pos].Fields.Create, _, err = fields(i.db, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		tables[pos].Indexes.Create, _, err = indexes(i.db, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		tables[pos].Constraints.Create, _, err = constraints(i.db, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		checks, _, err := checks(i.db, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		tables[pos].Constraints.Create = append(tables[pos].Constraints.Create, checks...)
+		tables[pos].Partitions.Create, err = partitions(i.db, table.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	views, _, err := views(i.db, prefix)
+	if err != nil {
+		return nil, err
+	}
+	triggers, _, err := triggers(i.db, prefix)
+	if err != nil {
+		return nil, err
+	}
+	routines, _, err := routines(i.db, prefix)
+	if err != nil {
+		return nil, err
+	}
+	events, _, err := events(i.db, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &dbdiffer.Schema{Tables: tables, Views: views, Triggers: triggers, Routines: routines, Events: events}, nil
 }
 
 func tables(db *sql.DB, prefix string) ([]dbdiffer.Table, map[string]int, error) {
-	query := "SHOW TABLE STATUS;"
+	// views are listed with a NULL engine, they are read by views
+	query := "SHOW TABLE STATUS WHERE Engine IS NOT NULL;"
 	if prefix != "" {
-		query = "SHOW TABLE STATUS LIKE '" + prefix + "%';"
+		query = "SHOW TABLE STATUS WHERE Name LIKE '" + prefix + "%' AND Engine IS NOT NULL;"
 	}
 	resultrows, err := db.Query(query)
 	if err != nil {
@@ -347,14 +720,23 @@ func tables(db *sql.DB, prefix string) ([]dbdiffer.Table, map[string]int, error)
 		if err := resultrows.Scan(&name, &engine, &version, &row_format, &rows, &avg_row_length, &data_length, &max_data_length, &index_length, &data_free, &auto_increment, &create_time, &update_time, &check_time, &collection, &checksum, &create_options, &comment); err != nil {
 			return nil, nil, err
 		}
+		// partitioning is read by partitions
+		options := make([]string, 0)
+		for _, option := range strings.Fields(create_options) {
+			if option != "partitioned" {
+				options = append(options, option)
+			}
+		}
 		tables = append(tables, dbdiffer.Table{
-			Name:      name,
-			Engine:    engine,
-			Version:   version,
-			RowFormat: row_format,
-			Options:   create_options,
-			Comment:   comment,
-			Collation: collection,
+			Name:       name,
+			Engine:     engine,
+			Version:    version,
+			RowFormat:  row_format,
+			Options:    strings.Join(options, " "),
+			Comment:    comment,
+			Collation:  collection,
+			Rows:       rows,
+			DataLength: data_length,
 		})
 		tablespos[name] = len(tables) - 1
 	}
@@ -399,9 +781,45 @@ func fields(db *sql.DB, table string) ([]dbdiffer.Field, map[string]int, error)
 		fieldspos[field] = len(fields) - 1
 		lastfield = field
 	}
+	if err := resultrows.Err(); err != nil {
+		return nil, nil, err
+	}
+	for _, field := range fields {
+		if strings.Contains(field.Extra, "VIRTUAL GENERATED") || strings.Contains(field.Extra, "STORED GENERATED") {
+			// SHOW FULL FIELDS leaves out expressions of generated columns
+			expressions, err := generated(db, table)
+			if err != nil {
+				return nil, nil, err
+			}
+			for pos := range fields {
+				fields[pos].Expression = expressions[fields[pos].Field]
+			}
+			break
+		}
+	}
 	return fields, fieldspos, nil
 }
 
+func generated(db *sql.DB, table string) (map[string]string, error) {
+	resultrows, err := db.Query("SELECT COLUMN_NAME, GENERATION_EXPRESSION FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND GENERATION_EXPRESSION <> '';", table)
+	if err != nil {
+		return nil, err
+	}
+	defer resultrows.Close()
+	expressions := make(map[string]string)
+	for resultrows.Next() {
+		var (
+			column_name           string
+			generation_expression string
+		)
+		if err := resultrows.Scan(&column_name, &generation_expression); err != nil {
+			return nil, err
+		}
+		expressions[column_name] = generation_expression
+	}
+	return expressions, resultrows.Err()
+}
+
 func indexes(db *sql.DB, table string) ([]dbdiffer.Index, map[string]int, error) {
 	resultrows, err := db.Query("SHOW INDEX FROM `" + table + "`;")
 	if err != nil {
@@ -424,8 +842,8 @@ func indexes(db *sql.DB, table string) ([]dbdiffer.Index, map[string]int, error)
 			non_unique    int
 			key_name      string
 			seq_in_index  int
-			column_name   string
-			collation     string
+			column_name   *string
+			collation     *string
 			cardinality   int
 			sub_part      *string
 			packed        *string
@@ -447,25 +865,597 @@ func indexes(db *sql.DB, table string) ([]dbdiffer.Index, map[string]int, error)
 			}
 		}
 
+		part := dbdiffer.IndexPart{
+			Column:     str(column_name),
+			Expression: str(expression),
+			Collation:  str(collation),
+		}
+		// spatial indexes report a prefix length, which they cannot be created with
+		if sub_part != nil && index_type != "SPATIAL" {
+			if part.SubPart, err = strconv.Atoi(*sub_part); err != nil {
+				return nil, nil, err
+			}
+		}
+		// functional key parts have no column
+		name := part.Column
+		if name == "" {
+			name = part.Expression
+		}
 		if pos, exist := indexpos[key_name]; exist {
-			indexes[pos].ColumnName = append(indexes[pos].ColumnName, column_name)
+			indexes[pos].ColumnName = append(indexes[pos].ColumnName, name)
+			indexes[pos].Parts = append(indexes[pos].Parts, part)
 		} else {
 			indexes = append(indexes, dbdiffer.Index{
 				Table:        table,
 				NonUnique:    non_unique,
 				KeyName:      key_name,
-				ColumnName:   []string{column_name},
-				Collation:    collation,
+				ColumnName:   []string{name},
+				Collation:    part.Collation,
 				IndexType:    index_type,
 				Comment:      comment,
 				IndexComment: index_comment,
+				Parts:        []dbdiffer.IndexPart{part},
+				Visible:      visible,
 			})
 			indexpos[key_name] = len(indexes) - 1
 		}
 	}
+	if err := resultrows.Err(); err != nil {
+		return nil, nil, err
+	}
+	for _, index := range indexes {
+		if index.IndexType == "FULLTEXT" {
+			// SHOW INDEX leaves out full-text parsers
+			parsers, err := fulltextparsers(db, table)
+			if err != nil {
+				return nil, nil, err
+			}
+			for pos := range indexes {
+				indexes[pos].Parser = parsers[indexes[pos].KeyName]
+			}
+			break
+		}
+	}
 	return indexes, indexpos, nil
 }
 
+// fulltextparsers reads the parsers of full-text indexes from SHOW CREATE TABLE
+func fulltextparsers(db *sql.DB, table string) (map[string]string, error) {
+	var name, create string
+	if err := db.QueryRow("SHOW CREATE TABLE `"+table+"`;").Scan(&name, &create); err != nil {
+		return nil, err
+	}
+	schema, err := ParseSchema(strings.NewReader(create))
+	if err != nil {
+		return nil, err
+	}
+	parsers := make(map[string]string)
+	for _, t := range schema.Tables {
+		for _, index := range t.Indexes.Create {
+			if index.Parser != "" {
+				parsers[index.KeyName] = index.Parser
+			}
+		}
+	}
+	return parsers, nil
+}
+
+func constraints(db *sql.DB, table string) ([]dbdiffer.Constraint, map[string]int, error) {
+	resultrows, err := db.Query(`SELECT k.CONSTRAINT_NAME, k.COLUMN_NAME, k.REFERENCED_TABLE_NAME, k.REFERENCED_COLUMN_NAME, r.UPDATE_RULE, r.DELETE_RULE
+FROM information_schema.KEY_COLUMN_USAGE k
+JOIN information_schema.REFERENTIAL_CONSTRAINTS r ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND r.TABLE_NAME = k.TABLE_NAME AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME
+WHERE k.TABLE_SCHEMA = DATABASE() AND k.TABLE_NAME = ? AND k.REFERENCED_TABLE_NAME IS NOT NULL
+ORDER BY k.CONSTRAINT_NAME, k.ORDINAL_POSITION;`, table)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultrows.Close()
+	constraints := make([]dbdiffer.Constraint, 0)
+	constraintpos := make(map[string]int)
+	for resultrows.Next() {
+		var (
+			constraint_name        string
+			column_name            string
+			referenced_table_name  string
+			referenced_column_name string
+			update_rule            string
+			delete_rule            string
+		)
+		if err := resultrows.Scan(&constraint_name, &column_name, &referenced_table_name, &referenced_column_name, &update_rule, &delete_rule); err != nil {
+			return nil, nil, err
+		}
+
+		if pos, exist := constraintpos[constraint_name]; exist {
+			constraints[pos].Columns = append(constraints[pos].Columns, column_name)
+			constraints[pos].RefColumns = append(constraints[pos].RefColumns, referenced_column_name)
+		} else {
+			constraints = append(constraints, dbdiffer.Constraint{
+				Name:       constraint_name,
+				Table:      table,
+				Type:       dbdiffer.ForeignKey,
+				Columns:    []string{column_name},
+				RefTable:   referenced_table_name,
+				RefColumns: []string{referenced_column_name},
+				OnUpdate:   update_rule,
+				OnDelete:   delete_rule,
+			})
+			constraintpos[constraint_name] = len(constraints) - 1
+		}
+	}
+	return constraints, constraintpos, resultrows.Err()
+}
+
+func views(db *sql.DB, prefix string) ([]dbdiffer.View, map[string]int, error) {
+	resultrows, err := db.Query(`SELECT TABLE_SCHEMA, TABLE_NAME, VIEW_DEFINITION, CHECK_OPTION, SECURITY_TYPE
+FROM information_schema.VIEWS
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME LIKE ?
+ORDER BY TABLE_NAME;`, prefix+"%")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultrows.Close()
+	views := make([]dbdiffer.View, 0)
+	viewspos := make(map[string]int)
+	for resultrows.Next() {
+		var (
+			table_schema    string
+			table_name      string
+			view_definition string
+			check_option    string
+			security_type   string
+		)
+		if err := resultrows.Scan(&table_schema, &table_name, &view_definition, &check_option, &security_type); err != nil {
+			return nil, nil, err
+		}
+		views = append(views, dbdiffer.View{
+			Name: table_name,
+			// tables of the same database are qualified with its name, which differs between databases
+			Definition:  strings.Replace(view_definition, "`"+table_schema+"`.", "", -1),
+			Security:    security_type,
+			CheckOption: check_option,
+		})
+		viewspos[table_name] = len(views) - 1
+	}
+	if err := resultrows.Err(); err != nil {
+		return nil, nil, err
+	}
+	resultrows.Close()
+
+	// the algorithm is only shown by SHOW CREATE VIEW
+	for pos, view := range views {
+		var (
+			name                 string
+			create               string
+			character_set_client string
+			collation_connection string
+		)
+		if err := db.QueryRow("SHOW CREATE VIEW `"+view.Name+"`;").Scan(&name, &create, &character_set_client, &collation_connection); err != nil {
+			return nil, nil, err
+		}
+		if start := strings.Index(create, "ALGORITHM="); start >= 0 {
+			algorithm := create[start+len("ALGORITHM="):]
+			if end := strings.IndexByte(algorithm, ' '); end >= 0 {
+				algorithm = algorithm[:end]
+			}
+			views[pos].Algorithm = algorithm
+		}
+	}
+	return views, viewspos, nil
+}
+
+func triggers(db *sql.DB, prefix string) ([]dbdiffer.Trigger, map[string]int, error) {
+	resultrows, err := db.Query(`SELECT TRIGGER_NAME, EVENT_OBJECT_TABLE, ACTION_TIMING, EVENT_MANIPULATION, ACTION_STATEMENT
+FROM information_schema.TRIGGERS
+WHERE TRIGGER_SCHEMA = DATABASE() AND EVENT_OBJECT_TABLE LIKE ?
+ORDER BY EVENT_OBJECT_TABLE, ACTION_TIMING, EVENT_MANIPULATION, ACTION_ORDER;`, prefix+"%")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultrows.Close()
+	triggers := make([]dbdiffer.Trigger, 0)
+	triggerspos := make(map[string]int)
+	for resultrows.Next() {
+		var (
+			trigger_name       string
+			event_object_table string
+			action_timing      string
+			event_manipulation string
+			action_statement   string
+		)
+		if err := resultrows.Scan(&trigger_name, &event_object_table, &action_timing, &event_manipulation, &action_statement); err != nil {
+			return nil, nil, err
+		}
+		triggers = append(triggers, dbdiffer.Trigger{
+			Name:      trigger_name,
+			Table:     event_object_table,
+			Timing:    action_timing,
+			Event:     event_manipulation,
+			Statement: action_statement,
+		})
+		triggerspos[trigger_name] = len(triggers) - 1
+	}
+	return triggers, triggerspos, resultrows.Err()
+}
+
+func routines(db *sql.DB, prefix string) ([]dbdiffer.Routine, map[string]int, error) {
+	resultrows, err := db.Query(`SELECT ROUTINE_NAME, ROUTINE_TYPE
+FROM information_schema.ROUTINES
+WHERE ROUTINE_SCHEMA = DATABASE() AND ROUTINE_NAME LIKE ?
+ORDER BY ROUTINE_TYPE DESC, ROUTINE_NAME;`, prefix+"%")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultrows.Close()
+	routines := make([]dbdiffer.Routine, 0)
+	for resultrows.Next() {
+		var (
+			routine_name string
+			routine_type string
+		)
+		if err := resultrows.Scan(&routine_name, &routine_type); err != nil {
+			return nil, nil, err
+		}
+		routines = append(routines, dbdiffer.Routine{Name: routine_name, Type: routine_type})
+	}
+	if err := resultrows.Err(); err != nil {
+		return nil, nil, err
+	}
+	resultrows.Close()
+
+	// parameters and characteristics are read from the definition shown by SHOW CREATE,
+	// the same way they are read from a schema file
+	routinespos := make(map[string]int)
+	for pos, routine := range routines {
+		var (
+			name                 string
+			sql_mode             string
+			create               *string
+			character_set_client string
+			collation_connection string
+			database_collation   string
+		)
+		if err := db.QueryRow("SHOW CREATE "+routine.Type+" `"+routine.Name+"`;").Scan(&name, &sql_mode, &create, &character_set_client, &collation_connection, &database_collation); err != nil {
+			return nil, nil, err
+		}
+		if create == nil {
+			return nil, nil, fmt.Errorf("no privilege to read the definition of %s %s", strings.ToLower(routine.Type), routine.Name)
+		}
+		parsed, err := parseroutine(*create)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s %s: %w", strings.ToLower(routine.Type), routine.Name, err)
+		}
+		routines[pos] = parsed
+		routinespos[parsed.Key()] = pos
+	}
+	return routines, routinespos, nil
+}
+
+func events(db *sql.DB, prefix string) ([]dbdiffer.Event, map[string]int, error) {
+	resultrows, err := db.Query(`SELECT EVENT_NAME, DEFINER, EVENT_DEFINITION, EVENT_TYPE, EXECUTE_AT, INTERVAL_VALUE, INTERVAL_FIELD, STARTS, ENDS, STATUS, ON_COMPLETION, EVENT_COMMENT
+FROM information_schema.EVENTS
+WHERE EVENT_SCHEMA = DATABASE() AND EVENT_NAME LIKE ?
+ORDER BY EVENT_NAME;`, prefix+"%")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultrows.Close()
+	events := make([]dbdiffer.Event, 0)
+	eventspos := make(map[string]int)
+	for resultrows.Next() {
+		var (
+			event_name       string
+			definer          string
+			event_definition string
+			event_type       string
+			execute_at       *string
+			interval_value   *string
+			interval_field   *string
+			starts           *string
+			ends             *string
+			status           string
+			on_completion    string
+			event_comment    string
+		)
+		if err := resultrows.Scan(&event_name, &definer, &event_definition, &event_type, &execute_at, &interval_value, &interval_field, &starts, &ends, &status, &on_completion, &event_comment); err != nil {
+			return nil, nil, err
+		}
+		event := dbdiffer.Event{
+			Name:         event_name,
+			Definer:      account(definer),
+			Status:       status,
+			OnCompletion: on_completion,
+			Comment:      event_comment,
+			Body:         event_definition,
+		}
+		if event_type == "ONE TIME" {
+			event.At = sqltime(execute_at)
+		} else if interval_value != nil && interval_field != nil {
+			value := *interval_value
+			if strings.Trim(value, "0123456789") != "" {
+				value = "'" + value + "'"
+			}
+			event.Every = value + " " + *interval_field
+			event.Starts = sqltime(starts)
+			event.Ends = sqltime(ends)
+		}
+		events = append(events, event)
+		eventspos[event_name] = len(events) - 1
+	}
+	return events, eventspos, resultrows.Err()
+}
+
+// account quotes an account like user@host the way SHOW CREATE does
+func account(s string) string {
+	pos := strings.LastIndex(s, "@")
+	if pos < 0 {
+		return "`" + s + "`"
+	}
+	return "`" + s[:pos] + "`@`" + s[pos+1:] + "`"
+}
+
+func sqltime(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return "'" + *s + "'"
+}
+
+// sqlevent creates or alters an event with the full definition
+func sqlevent(verb string, e dbdiffer.Event) string {
+	sql := verb
+	if e.Definer != "" {
+		sql += " DEFINER = " + e.Definer
+	}
+	sql += " EVENT `" + e.Name + "` ON SCHEDULE"
+	if e.Every != "" {
+		sql += " EVERY " + e.Every
+		if e.Starts != "" {
+			sql += " STARTS " + e.Starts
+		}
+		if e.Ends != "" {
+			sql += " ENDS " + e.Ends
+		}
+	} else {
+		sql += " AT " + e.At
+	}
+	if e.OnCompletion != "" {
+		sql += " ON COMPLETION " + e.OnCompletion
+	}
+	switch e.Status {
+	case "DISABLED":
+		sql += " DISABLE"
+	case "SLAVESIDE_DISABLED":
+		sql += " DISABLE ON SLAVE"
+	default:
+		sql += " ENABLE"
+	}
+	if e.Comment != "" || verb == "ALTER" {
+		sql += " COMMENT '" + escape(e.Comment) + "'"
+	}
+	return sql + " DO " + e.Body + ";"
+}
+
+// sqltrigger creates a trigger
+func sqltrigger(t dbdiffer.Trigger) string {
+	return "CREATE TRIGGER `" + t.Name + "` " + t.Timing + " " + t.Event + " ON `" + t.Table + "` FOR EACH ROW " + t.Statement + ";"
+}
+
+// sqlroutine creates a procedure or a function
+func sqlroutine(r dbdiffer.Routine) string {
+	sql := "CREATE"
+	if r.Definer != "" {
+		sql += " DEFINER = " + r.Definer
+	}
+	sql += " " + r.Type + " `" + r.Name + "`(" + r.Parameters + ")"
+	if r.Returns != "" {
+		sql += " RETURNS " + r.Returns
+	}
+	sql += sqlcomment(r.Comment)
+	if r.Deterministic {
+		sql += " DETERMINISTIC"
+	} else {
+		sql += " NOT DETERMINISTIC"
+	}
+	if r.DataAccess != "" {
+		sql += " " + r.DataAccess
+	}
+	if r.Security != "" {
+		sql += " SQL SECURITY " + r.Security
+	}
+	return sql + " " + r.Body + ";"
+}
+
+func sqlview(v dbdiffer.View) string {
+	sql := "CREATE OR REPLACE"
+	if v.Algorithm != "" {
+		sql += " ALGORITHM = " + v.Algorithm
+	}
+	if v.Security != "" {
+		sql += " SQL SECURITY " + v.Security
+	}
+	sql += " VIEW `" + v.Name + "` AS " + v.Definition
+	switch v.CheckOption {
+	case "", "NONE":
+	default:
+		sql += " WITH " + v.CheckOption + " CHECK OPTION"
+	}
+	return sql
+}
+
+// checks reads check constraints, which are only kept by mysql 8.0.16 and later
+func checks(db *sql.DB, table string) ([]dbdiffer.Constraint, map[string]int, error) {
+	resultrows, err := db.Query(`SELECT t.CONSTRAINT_NAME, c.CHECK_CLAUSE, t.ENFORCED
+FROM information_schema.TABLE_CONSTRAINTS t
+JOIN information_schema.CHECK_CONSTRAINTS c ON c.CONSTRAINT_SCHEMA = t.CONSTRAINT_SCHEMA AND c.CONSTRAINT_NAME = t.CONSTRAINT_NAME
+WHERE t.TABLE_SCHEMA = DATABASE() AND t.TABLE_NAME = ? AND t.CONSTRAINT_TYPE = 'CHECK'
+ORDER BY t.CONSTRAINT_NAME;`, table)
+	if err != nil {
+		if merr, ok := err.(*mysql.MySQLError); ok && (merr.Number == 1109 || merr.Number == 1054) {
+			// unknown table or column, the server has no check constraints
+			return []dbdiffer.Constraint{}, map[string]int{}, nil
+		}
+		return nil, nil, err
+	}
+	defer resultrows.Close()
+	constraints := make([]dbdiffer.Constraint, 0)
+	constraintpos := make(map[string]int)
+	for resultrows.Next() {
+		var (
+			constraint_name string
+			check_clause    string
+			enforced        string
+		)
+		if err := resultrows.Scan(&constraint_name, &check_clause, &enforced); err != nil {
+			return nil, nil, err
+		}
+		constraints = append(constraints, dbdiffer.Constraint{
+			Name:       constraint_name,
+			Table:      table,
+			Type:       dbdiffer.Check,
+			Expression: check_clause,
+			Enforced:   enforced,
+		})
+		constraintpos[constraint_name] = len(constraints) - 1
+	}
+	return constraints, constraintpos, resultrows.Err()
+}
+
+// partitions reads the partitioning of a table, nil if the table is not partitioned
+func partitions(db *sql.DB, table string) (*dbdiffer.Partition, error) {
+	resultrows, err := db.Query(`SELECT PARTITION_NAME, SUBPARTITION_NAME, PARTITION_METHOD, SUBPARTITION_METHOD, PARTITION_EXPRESSION, SUBPARTITION_EXPRESSION, PARTITION_DESCRIPTION, PARTITION_COMMENT
+FROM information_schema.PARTITIONS
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND PARTITION_NAME IS NOT NULL
+ORDER BY PARTITION_ORDINAL_POSITION, SUBPARTITION_ORDINAL_POSITION;`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer resultrows.Close()
+	var partition *dbdiffer.Partition
+	for resultrows.Next() {
+		var (
+			partition_name          string
+			subpartition_name       *string
+			partition_method        string
+			subpartition_method     *string
+			partition_expression    *string
+			subpartition_expression *string
+			partition_description   *string
+			partition_comment       string
+		)
+		if err := resultrows.Scan(&partition_name, &subpartition_name, &partition_method, &subpartition_method, &partition_expression, &subpartition_expression, &partition_description, &partition_comment); err != nil {
+			return nil, err
+		}
+		if partition == nil {
+			partition = &dbdiffer.Partition{
+				Method:        partition_method,
+				Expression:    str(partition_expression),
+				SubMethod:     str(subpartition_method),
+				SubExpression: str(subpartition_expression),
+			}
+		}
+		// a row for each sub partition
+		if n := len(partition.Partitions); n == 0 || partition.Partitions[n-1].Name != partition_name {
+			partition.Partitions = append(partition.Partitions, dbdiffer.PartitionDefinition{
+				Name:    partition_name,
+				Values:  partitionvalues(partition_method, str(partition_description)),
+				Comment: partition_comment,
+			})
+		}
+		if subpartition_name != nil {
+			last := &partition.Partitions[len(partition.Partitions)-1]
+			last.SubPartitions = append(last.SubPartitions, *subpartition_name)
+		}
+	}
+	return partition, resultrows.Err()
+}
+
+// partitionvalues turns PARTITION_DESCRIPTION into the values clause of a partition
+func partitionvalues(method, description string) string {
+	switch {
+	case description == "":
+		return ""
+	case method == "RANGE" && description == "MAXVALUE":
+		return "LESS THAN MAXVALUE"
+	case strings.HasPrefix(method, "RANGE"):
+		return "LESS THAN (" + description + ")"
+	case strings.HasPrefix(method, "LIST"):
+		return "IN (" + description + ")"
+	}
+	return ""
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func sqlpartition(p *dbdiffer.Partition) string {
+	sql := "PARTITION BY " + p.Method + " (" + p.Expression + ")"
+	if p.SubMethod != "" {
+		sql += " SUBPARTITION BY " + p.SubMethod + " (" + p.SubExpression + ")"
+	}
+	return sql + " (" + sqlpartitiondefinitions(p.Partitions) + ")"
+}
+
+func sqlpartitiondefinitions(partitions []dbdiffer.PartitionDefinition) string {
+	defs := make([]string, 0, len(partitions))
+	for _, partition := range partitions {
+		def := "PARTITION `" + partition.Name + "`"
+		if partition.Values != "" {
+			def += " VALUES " + partition.Values
+		}
+		def += sqlcomment(partition.Comment)
+		if len(partition.SubPartitions) > 0 {
+			def += " (SUBPARTITION `" + strings.Join(partition.SubPartitions, "`, SUBPARTITION `") + "`)"
+		}
+		defs = append(defs, def)
+	}
+	return strings.Join(defs, ", ")
+}
+
+func partitionnames(partitions []dbdiffer.PartitionDefinition) string {
+	names := make([]string, 0, len(partitions))
+	for _, partition := range partitions {
+		names = append(names, "`"+partition.Name+"`")
+	}
+	return strings.Join(names, ", ")
+}
+
+func sqlconstraint(c dbdiffer.Constraint) string {
+	if c.Type == dbdiffer.Check {
+		return sqlcheck(c)
+	}
+	return sqlforeignkey(c)
+}
+
+func sqldropconstraint(c dbdiffer.Constraint) string {
+	if c.Type == dbdiffer.Check {
+		return "DROP CHECK `" + c.Name + "`"
+	}
+	return "DROP FOREIGN KEY `" + c.Name + "`"
+}
+
+func sqlcheck(c dbdiffer.Constraint) string {
+	sql := "CONSTRAINT `" + c.Name + "` CHECK (" + c.Expression + ")"
+	if c.Enforced == "NO" {
+		sql += " NOT ENFORCED"
+	}
+	return sql
+}
+
+func sqlforeignkey(c dbdiffer.Constraint) string {
+	sql := "CONSTRAINT `" + c.Name + "` FOREIGN KEY (`" + strings.Join(c.Columns, "`, `") + "`) REFERENCES `" + c.RefTable + "` (`" + strings.Join(c.RefColumns, "`, `") + "`)"
+	if c.OnDelete != "" {
+		sql += " ON DELETE " + c.OnDelete
+	}
+	if c.OnUpdate != "" {
+		sql += " ON UPDATE " + c.OnUpdate
+	}
+	return sql
+}
+
 func sqlnull(s string) string {
 	switch s {
 	case "NO":
@@ -493,9 +1483,21 @@ func sqldefault(typ string, s *string) string {
 }
 
 func sqlextra(s string) string {
+	// generated columns are declared by sqlgenerated
+	s = strings.Replace(strings.Replace(s, "VIRTUAL GENERATED", "", -1), "STORED GENERATED", "", -1)
 	return " " + strings.Replace(s, "DEFAULT_GENERATED", "", -1) // mysql 8 added this extra, should ignore
 }
 
+func sqlgenerated(field dbdiffer.Field) string {
+	if field.Expression == "" {
+		return ""
+	}
+	if strings.Contains(field.Extra, "STORED GENERATED") {
+		return " GENERATED ALWAYS AS (" + field.Expression + ") STORED"
+	}
+	return " GENERATED ALWAYS AS (" + field.Expression + ") VIRTUAL"
+}
+
 func sqlcomment(s string) string {
 	switch s {
 	case "":
@@ -505,6 +1507,60 @@ func sqlcomment(s string) string {
 	}
 }
 
+func sqlindex(index dbdiffer.Index, engine string) string {
+	switch index.IndexType {
+	case "FULLTEXT":
+		sql := "FULLTEXT KEY `" + index.KeyName + "` " + sqlindexparts(index)
+		if index.Parser != "" {
+			sql += " WITH PARSER `" + index.Parser + "`"
+		}
+		return sql + sqlvisible(index.Visible)
+	case "SPATIAL":
+		return "SPATIAL KEY `" + index.KeyName + "` " + sqlindexparts(index) + sqlvisible(index.Visible)
+	}
+	return sqluniq(index.NonUnique) + " `" + index.KeyName + "` " + sqlindexparts(index) + sqlindextype(index.IndexType, engine) + sqlvisible(index.Visible)
+}
+
+// sqlindextype leaves out USING when the index type is the default of the engine
+func sqlindextype(indextype, engine string) string {
+	if indextype == "" || indextype == defaultindextype(engine) {
+		return ""
+	}
+	return " USING " + indextype
+}
+
+// defaultindextype is the type of indexes created without USING
+func defaultindextype(engine string) string {
+	if strings.EqualFold(engine, "MEMORY") || strings.EqualFold(engine, "HEAP") {
+		return "HASH"
+	}
+	return "BTREE"
+}
+
+func sqlindexparts(index dbdiffer.Index) string {
+	parts := make([]string, 0, len(index.ColumnName))
+	for _, part := range index.KeyParts() {
+		sql := "`" + part.Column + "`"
+		if part.Column == "" {
+			sql = "(" + part.Expression + ")"
+		} else if part.SubPart > 0 {
+			sql += "(" + strconv.Itoa(part.SubPart) + ")"
+		}
+		if part.Collation == "D" {
+			sql += " DESC"
+		}
+		parts = append(parts, sql)
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+func sqlvisible(visible string) string {
+	if visible == "NO" {
+		return " INVISIBLE"
+	}
+	return ""
+}
+
 func sqluniq(s int) string {
 	if s == 0 {
 		return "UNIQUE"
@@ -513,13 +1569,23 @@ func sqluniq(s int) string {
 }
 
 func sqlcol(s *string) string {
-	switch s {
-	case nil:
+	if s == nil || *s == "" {
 		return ""
-	default:
-		chars := strings.Split(*s, "_")
-		return " CHARACTER SET " + chars[0] + " COLLATE " + *s
 	}
+	return " CHARACTER SET " + charset(*s) + sqlcollate(*s)
+}
+
+// sqlcollate returns the COLLATE of a collation, a character set alone takes its default collation
+func sqlcollate(s string) string {
+	if !strings.Contains(s, "_") {
+		return ""
+	}
+	return " COLLATE " + s
+}
+
+// charset returns the character set of a collation like utf8mb4_general_ci
+func charset(collation string) string {
+	return strings.SplitN(collation, "_", 2)[0]
 }
 
 func escape(s string) string {
@@ -532,7 +1598,7 @@ func escape(s string) string {
 
 func after(s string) string {
 	if s == "" {
-		return ""
+		return " FIRST"
 	}
 	return " AFTER `" + s + "`"
 }
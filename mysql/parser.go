@@ -0,0 +1,1814 @@
+package mysql
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sillydong/dbdiffer"
+)
+
+// ParseFile reads the structure from a file of CREATE statements,
+// such as the output of mysqldump --no-data.
+func ParseFile(path string) (*dbdiffer.Schema, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	schema, err := ParseSchema(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return schema, nil
+}
+
+// ParseSchema reads CREATE TABLE, CREATE VIEW, CREATE TRIGGER, CREATE PROCEDURE, CREATE FUNCTION and CREATE EVENT statements.
+// CREATE INDEX, DROP and ALTER TABLE adding indexes and constraints or modifying columns, like dumps write them, are applied to what is read.
+// Statements not changing the structure, like SET or INSERT, are skipped, any other statement is an error.
+// DELIMITER commands are followed like the mysql client does.
+// What the server fills in is left empty, like the row format or the collation of a character set, see dbdiffer.Table.Equal.
+func ParseSchema(r io.Reader) (*dbdiffer.Schema, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	toks, err := tokenize(string(b), ";")
+	if err != nil {
+		return nil, err
+	}
+	schema := &dbdiffer.Schema{
+		Tables: make([]dbdiffer.Table, 0),
+	}
+	start := 0
+	for i := 0; i <= len(toks); i++ {
+		if i < len(toks) && toks[i].kind != tokend {
+			continue
+		}
+		if i > start {
+			p := &parser{src: string(b), toks: toks[start:i]}
+			if err := p.statement(schema); err != nil {
+				return nil, err
+			}
+		}
+		start = i + 1
+	}
+	return schema, nil
+}
+
+// parseroutine reads a CREATE PROCEDURE or CREATE FUNCTION statement, like the one shown by SHOW CREATE PROCEDURE
+func parseroutine(create string) (dbdiffer.Routine, error) {
+	toks, err := tokenize(create, "")
+	if err != nil {
+		return dbdiffer.Routine{}, err
+	}
+	schema := &dbdiffer.Schema{}
+	p := &parser{src: create, toks: toks}
+	if !p.word("CREATE") {
+		return dbdiffer.Routine{}, p.errorf("expect CREATE")
+	}
+	if err := p.create(schema); err != nil {
+		return dbdiffer.Routine{}, err
+	}
+	if len(schema.Routines) != 1 {
+		return dbdiffer.Routine{}, p.errorf("expect CREATE PROCEDURE or CREATE FUNCTION")
+	}
+	return schema.Routines[0], nil
+}
+
+type tokenkind int
+
+const (
+	tokword   tokenkind = iota // keyword or bare identifier
+	tokident                   // `quoted identifier`
+	tokstring                  // 'string' or "string"
+	toknumber
+	tokpunct
+	tokend // end of a statement, ; or the delimiter set with DELIMITER
+)
+
+type token struct {
+	kind tokenkind
+	text string // unquoted text
+	pos  int    // offset of the first byte in source
+	end  int    // offset after the last byte in source
+	line int
+}
+
+func (t token) is(punct string) bool {
+	return t.kind == tokpunct && t.text == punct
+}
+
+func (t token) isword(words ...string) bool {
+	if t.kind != tokword {
+		return false
+	}
+	for _, word := range words {
+		if strings.EqualFold(t.text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenize splits the source into tokens, statements end with the delimiter until DELIMITER sets another one.
+// An empty delimiter reads the source as a single statement.
+func tokenize(src, delimiter string) ([]token, error) {
+	toks := make([]token, 0)
+	line := 1
+	versioned := 0 // depth of /*!50100 ... */ comments, their content is executed by mysql
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case delimiter != "" && strings.HasPrefix(src[i:], delimiter):
+			toks = append(toks, token{kind: tokend, text: delimiter, pos: i, end: i + len(delimiter), line: line})
+			i += len(delimiter)
+		case delimiter != "" && linestart(src, i) && len(src) > i+10 && strings.EqualFold(src[i:i+9], "DELIMITER") && (src[i+9] == ' ' || src[i+9] == '\t'):
+			// mysql client command setting the delimiter, used around bodies of triggers and routines
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			args := strings.Fields(src[i+9 : i+end])
+			if len(args) == 0 {
+				return nil, fmt.Errorf("line %d: expect delimiter", line)
+			}
+			delimiter = args[0]
+			toks = append(toks, token{kind: tokend, text: delimiter, pos: i, end: i + end, line: line})
+			i += end
+		case c == '#' || (c == '-' && strings.HasPrefix(src[i:], "--") && (i+2 == len(src) || strings.ContainsRune(" \t\r\n", rune(src[i+2])))):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*!"):
+			i += 3
+			for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+				i++
+			}
+			versioned++
+		case strings.HasPrefix(src[i:], "*/") && versioned > 0:
+			i += 2
+			versioned--
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`':
+			start := i
+			text, n, err := unquote(src[i:], c)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			kind := tokstring
+			if c == '`' {
+				kind = tokident
+			}
+			toks = append(toks, token{kind: kind, text: text, pos: start, end: i + n, line: line})
+			line += strings.Count(src[i:i+n], "\n")
+			i += n
+		case c >= '0' && c <= '9' || (c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'):
+			start := i
+			for i < len(src) && (isidentchar(src[i]) || src[i] == '.' ||
+				((src[i] == '+' || src[i] == '-') && (src[i-1] == 'e' || src[i-1] == 'E'))) {
+				i++
+			}
+			toks = append(toks, token{kind: toknumber, text: src[start:i], pos: start, end: i, line: line})
+		case isidentchar(c):
+			start := i
+			for i < len(src) && isidentchar(src[i]) {
+				i++
+			}
+			toks = append(toks, token{kind: tokword, text: src[start:i], pos: start, end: i, line: line})
+		default:
+			toks = append(toks, token{kind: tokpunct, text: string(c), pos: i, end: i + 1, line: line})
+			i++
+		}
+	}
+	return toks, nil
+}
+
+// linestart tells whether only spaces come before the offset on its line
+func linestart(src string, i int) bool {
+	for i--; i >= 0 && src[i] != '\n'; i-- {
+		if src[i] != ' ' && src[i] != '\t' && src[i] != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+func isidentchar(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// unquote reads a quoted string at the beginning of s, returns its content and the length consumed
+func unquote(s string, quote byte) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote && i+1 < len(s) && s[i+1] == quote:
+			b.WriteByte(quote)
+			i++
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && quote != '`' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '0':
+				b.WriteByte(0)
+			case 'Z':
+				b.WriteByte(26)
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string %.20s", s)
+}
+
+type parser struct {
+	src  string
+	toks []token
+	i    int
+}
+
+func (p *parser) eof() bool {
+	return p.i >= len(p.toks)
+}
+
+func (p *parser) peek() token {
+	if p.eof() {
+		return token{kind: tokpunct, pos: len(p.src), end: len(p.src)}
+	}
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.i++
+	return t
+}
+
+// word consumes the given keyword
+func (p *parser) word(words ...string) bool {
+	if p.peek().isword(words...) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// punct consumes the given punctuation
+func (p *parser) punct(punct string) bool {
+	if p.peek().is(punct) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	if p.eof() && len(p.toks) > 0 {
+		t = p.toks[len(p.toks)-1]
+	}
+	return fmt.Errorf("line %d: %s", t.line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) ident() (string, error) {
+	t := p.peek()
+	if t.kind != tokword && t.kind != tokident && t.kind != tokstring {
+		return "", p.errorf("expect identifier, got %q", t.text)
+	}
+	p.i++
+	return t.text, nil
+}
+
+// name reads a possibly qualified name and returns its last part
+func (p *parser) name() (string, error) {
+	name, err := p.ident()
+	if err != nil {
+		return "", err
+	}
+	for p.punct(".") {
+		if name, err = p.ident(); err != nil {
+			return "", err
+		}
+	}
+	return name, nil
+}
+
+// group consumes a parenthesized group and returns the tokens inside
+func (p *parser) group() ([]token, error) {
+	if !p.punct("(") {
+		return nil, p.errorf("expect (, got %q", p.peek().text)
+	}
+	start := p.i
+	depth := 1
+	for !p.eof() {
+		t := p.next()
+		if t.is("(") {
+			depth++
+		} else if t.is(")") {
+			depth--
+			if depth == 0 {
+				return p.toks[start : p.i-1], nil
+			}
+		}
+	}
+	return nil, p.errorf("unbalanced parentheses")
+}
+
+// raw returns the source text covered by the tokens
+func (p *parser) raw(toks []token) string {
+	if len(toks) == 0 {
+		return ""
+	}
+	return p.src[toks[0].pos:toks[len(toks)-1].end]
+}
+
+// split splits tokens by top level commas
+func split(toks []token) [][]token {
+	parts := make([][]token, 0)
+	depth, start := 0, 0
+	for i, t := range toks {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case t.is(",") && depth == 0:
+			parts = append(parts, toks[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(toks) {
+		parts = append(parts, toks[start:])
+	}
+	return parts
+}
+
+// skipped are the statements that do not change the structure
+var skipped = []string{"SET", "USE", "LOCK", "UNLOCK", "INSERT", "REPLACE", "UPDATE", "DELETE", "TRUNCATE", "START", "BEGIN", "COMMIT", "ROLLBACK", "GRANT", "REVOKE", "FLUSH", "ANALYZE", "OPTIMIZE"}
+
+// statement applies a statement to the schema
+func (p *parser) statement(schema *dbdiffer.Schema) error {
+	switch t := p.next(); {
+	case t.isword("CREATE"):
+		return p.create(schema)
+	case t.isword("DROP"):
+		return p.drop(schema)
+	case t.isword("ALTER") && p.word("TABLE"):
+		return p.altertable(schema)
+	case t.isword("ALTER") && p.peek().isword("DATABASE", "SCHEMA"), t.isword(skipped...):
+		return nil
+	}
+	p.i = 0
+	if len(p.toks) > 2 {
+		return p.errorf("%s is not supported", p.raw(p.toks[:2]))
+	}
+	return p.errorf("%s is not supported", p.raw(p.toks))
+}
+
+func (p *parser) create(schema *dbdiffer.Schema) error {
+	if p.word("OR") && !p.word("REPLACE") {
+		return p.errorf("expect OR REPLACE")
+	}
+	view := dbdiffer.View{}
+	definer := ""
+	for {
+		if p.word("ALGORITHM") {
+			p.punct("=")
+			view.Algorithm = strings.ToUpper(p.next().text)
+		} else if p.word("DEFINER") {
+			p.punct("=")
+			var err error
+			if definer, err = p.definer(); err != nil {
+				return err
+			}
+		} else if p.word("SQL") {
+			if !p.word("SECURITY") {
+				return p.errorf("expect SQL SECURITY")
+			}
+			view.Security = strings.ToUpper(p.next().text)
+		} else {
+			break
+		}
+	}
+	if p.word("VIEW") {
+		return p.view(schema, view)
+	}
+	if p.word("TRIGGER") {
+		return p.trigger(schema)
+	}
+	if t := p.peek(); t.isword("PROCEDURE", "FUNCTION") {
+		p.i++
+		return p.routine(schema, strings.ToUpper(t.text), definer)
+	}
+	if p.word("EVENT") {
+		return p.event(schema, definer)
+	}
+	if p.peek().isword("INDEX", "UNIQUE", "FULLTEXT", "SPATIAL") {
+		return p.createindex(schema)
+	}
+	if p.word("DATABASE", "SCHEMA", "USER", "ROLE") {
+		// not part of the structure of a database
+		return nil
+	}
+	p.word("TEMPORARY")
+	if !p.word("TABLE") {
+		return p.errorf("CREATE %s is not supported", p.peek().text)
+	}
+	if p.word("IF") {
+		if !p.word("NOT") || !p.word("EXISTS") {
+			return p.errorf("expect IF NOT EXISTS")
+		}
+	}
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	if p.peek().isword("LIKE") {
+		return p.errorf("CREATE TABLE %s LIKE is not supported", name)
+	}
+	body, err := p.group()
+	if err != nil {
+		return err
+	}
+
+	// options left to the server, like the row format, stay empty and are not compared
+	table := dbdiffer.Table{
+		Name:   name,
+		Engine: "InnoDB",
+	}
+	charset := ""
+	options := make([]string, 0)
+	for !p.eof() {
+		p.word("DEFAULT")
+		t := p.next()
+		switch {
+		case t.is(","):
+			continue
+		case t.isword("PARTITION"):
+			if !p.word("BY") {
+				return p.errorf("expect PARTITION BY")
+			}
+			if table.Partitions.Create, err = p.partition(); err != nil {
+				return err
+			}
+			continue
+		case t.isword("CHARACTER"):
+			if !p.word("SET") {
+				return p.errorf("expect CHARACTER SET")
+			}
+			fallthrough
+		case t.isword("CHARSET"):
+			p.punct("=")
+			if charset, err = p.ident(); err != nil {
+				return err
+			}
+			continue
+		case t.kind != tokword:
+			return p.errorf("unexpected %q in table options", t.text)
+		}
+		p.punct("=")
+		value := p.next()
+		switch strings.ToUpper(t.text) {
+		case "ENGINE":
+			table.Engine = engine(value.text)
+		case "COLLATE":
+			table.Collation = strings.ToLower(value.text)
+		case "COMMENT":
+			table.Comment = value.text
+		case "ROW_FORMAT":
+			table.RowFormat = strings.ToUpper(value.text[:1]) + strings.ToLower(value.text[1:])
+			options = append(options, "row_format="+strings.ToUpper(value.text))
+		case "KEY_BLOCK_SIZE", "STATS_PERSISTENT", "STATS_AUTO_RECALC", "STATS_SAMPLE_PAGES", "CHECKSUM", "DELAY_KEY_WRITE", "PACK_KEYS", "MIN_ROWS", "MAX_ROWS", "AVG_ROW_LENGTH":
+			options = append(options, strings.ToLower(t.text)+"="+value.text)
+		}
+	}
+	if table.Collation == "" && charset != "" {
+		table.Collation = collation(charset)
+	}
+	table.Options = strings.Join(options, " ")
+
+	table.Fields.Create = make([]dbdiffer.Field, 0)
+	table.Indexes.Create = make([]dbdiffer.Index, 0)
+	table.Constraints.Create = make([]dbdiffer.Constraint, 0)
+	for _, def := range split(body) {
+		d := &parser{src: p.src, toks: def}
+		if err := d.definition(&table); err != nil {
+			return err
+		}
+	}
+	finishtable(&table)
+	schema.Tables = append(schema.Tables, table)
+	return nil
+}
+
+// definition reads a column, index or constraint of a table and adds it to the table
+func (p *parser) definition(table *dbdiffer.Table) error {
+	var err error
+	if p.peek().isword("CONSTRAINT", "PRIMARY", "KEY", "INDEX", "UNIQUE", "FULLTEXT", "SPATIAL", "FOREIGN", "CHECK") {
+		symbol := ""
+		if p.word("CONSTRAINT") && !p.peek().isword("PRIMARY", "UNIQUE", "FOREIGN", "CHECK") {
+			if symbol, err = p.ident(); err != nil {
+				return err
+			}
+		}
+		switch {
+		case p.word("FOREIGN"):
+			constraint, err := p.foreignkey(table.Name, symbol, len(table.Constraints.Create)+1)
+			if err != nil {
+				return err
+			}
+			table.Constraints.Create = append(table.Constraints.Create, constraint)
+		case p.word("CHECK"):
+			constraint, err := p.check(table.Name, symbol)
+			if err != nil {
+				return err
+			}
+			table.Constraints.Create = append(table.Constraints.Create, constraint)
+		default:
+			index, err := p.index(table.Name, symbol, table.Indexes.Create)
+			if err != nil {
+				return err
+			}
+			table.Indexes.Create = append(table.Indexes.Create, index)
+		}
+		return nil
+	}
+	field, inline, check, err := p.field(table.Name, table.Collation)
+	if err != nil {
+		return err
+	}
+	if fields := table.Fields.Create; len(fields) > 0 {
+		field.After = fields[len(fields)-1].Field
+	}
+	table.Fields.Create = append(table.Fields.Create, field)
+	if inline != nil {
+		table.Indexes.Create = append(table.Indexes.Create, *inline)
+	}
+	if check != nil {
+		table.Constraints.Create = append(table.Constraints.Create, *check)
+	}
+	return nil
+}
+
+// finishtable names unnamed check constraints, sets the default index type and the keys of columns,
+// after the definitions of a table are read or changed
+func finishtable(table *dbdiffer.Table) {
+	// unnamed check constraints are numbered like mysql does
+	n := 0
+	constraints := table.Constraints.Create
+	for i := range constraints {
+		if constraints[i].Type == dbdiffer.Check && strings.HasPrefix(constraints[i].Name, table.Name+"_chk_") {
+			n++
+		}
+	}
+	for i := range constraints {
+		if constraints[i].Type == dbdiffer.Check && constraints[i].Name == "" {
+			n++
+			constraints[i].Name = fmt.Sprintf("%s_chk_%d", table.Name, n)
+		}
+	}
+
+	// indexes without USING have the default type of the engine, hash indexes are not sorted
+	indexes := table.Indexes.Create
+	for i := range indexes {
+		if indexes[i].IndexType == "" || (indexes[i].IndexType == "HASH" && (table.Engine == "InnoDB" || table.Engine == "MyISAM")) {
+			// innodb and myisam keep USING HASH but build a btree
+			indexes[i].IndexType = defaultindextype(table.Engine)
+		}
+		if indexes[i].IndexType == "HASH" {
+			indexes[i].Collation = ""
+			for j := range indexes[i].Parts {
+				indexes[i].Parts[j].Collation = ""
+			}
+		}
+	}
+
+	// primary key first, like SHOW INDEX does
+	sorted := make([]dbdiffer.Index, 0, len(indexes))
+	for _, index := range indexes {
+		if index.KeyName == "PRIMARY" {
+			sorted = append(sorted, index)
+		}
+	}
+	for _, index := range indexes {
+		if index.KeyName != "PRIMARY" {
+			sorted = append(sorted, index)
+		}
+	}
+	indexes = sorted
+
+	fields := table.Fields.Create
+	for i := range fields {
+		fields[i].Key = ""
+		for _, index := range indexes {
+			if index.KeyName == "PRIMARY" {
+				for _, column := range index.ColumnName {
+					if column == fields[i].Field {
+						fields[i].Key = "PRI"
+						fields[i].Null = "NO"
+					}
+				}
+			} else if fields[i].Key == "" && len(index.ColumnName) > 0 && index.ColumnName[0] == fields[i].Field {
+				if index.NonUnique == 0 && len(index.ColumnName) == 1 {
+					fields[i].Key = "UNI"
+				} else {
+					fields[i].Key = "MUL"
+				}
+			}
+		}
+	}
+	table.Indexes.Create = indexes
+}
+
+// table returns the table of the schema to change with a statement
+func (p *parser) table(schema *dbdiffer.Schema, name string) (*dbdiffer.Table, error) {
+	for i := range schema.Tables {
+		if schema.Tables[i].Name == name {
+			return &schema.Tables[i], nil
+		}
+	}
+	return nil, p.errorf("table %s is not created yet", name)
+}
+
+// createindex adds the index of CREATE INDEX to its table
+func (p *parser) createindex(schema *dbdiffer.Schema) error {
+	start := p.i
+	p.word("UNIQUE", "FULLTEXT", "SPATIAL")
+	if !p.word("INDEX") {
+		return p.errorf("expect CREATE INDEX")
+	}
+	if _, err := p.ident(); err != nil {
+		return err
+	}
+	if p.word("USING") {
+		p.next()
+	}
+	on := p.i
+	if !p.word("ON") {
+		return p.errorf("expect ON")
+	}
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	table, err := p.table(schema, name)
+	if err != nil {
+		return err
+	}
+	// the index is read like in CREATE TABLE, without ON and the table
+	toks := append(append([]token{}, p.toks[start:on]...), p.toks[p.i:]...)
+	d := &parser{src: p.src, toks: toks}
+	if err := d.definition(table); err != nil {
+		return err
+	}
+	finishtable(table)
+	return nil
+}
+
+// altertable applies the changes of ALTER TABLE written by dumps,
+// which add indexes and constraints or modify columns in place
+func (p *parser) altertable(schema *dbdiffer.Schema) error {
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	table, err := p.table(schema, name)
+	if err != nil {
+		return err
+	}
+	for _, spec := range split(p.toks[p.i:]) {
+		d := &parser{src: p.src, toks: spec}
+		switch {
+		case d.word("ADD"):
+			if !d.peek().isword("CONSTRAINT", "PRIMARY", "KEY", "INDEX", "UNIQUE", "FULLTEXT", "SPATIAL", "FOREIGN", "CHECK") {
+				return d.errorf("ALTER TABLE ADD %s is not supported", d.peek().text)
+			}
+			if err := d.definition(table); err != nil {
+				return err
+			}
+		case d.word("MODIFY"):
+			d.word("COLUMN")
+			if err := d.modify(table); err != nil {
+				return err
+			}
+		case d.word("AUTO_INCREMENT", "ALGORITHM", "LOCK"), d.word("DISABLE", "ENABLE") && d.word("KEYS"):
+			// not part of the structure
+		default:
+			d.i = 0
+			return d.errorf("ALTER TABLE %s is not supported", d.raw(spec[:1]))
+		}
+	}
+	finishtable(table)
+	return nil
+}
+
+// modify replaces the definition of a column, which keeps its position
+func (p *parser) modify(table *dbdiffer.Table) error {
+	for _, t := range p.toks[p.i:] {
+		if t.isword("FIRST", "AFTER") {
+			return p.errorf("ALTER TABLE MODIFY %s is not supported", t.text)
+		}
+	}
+	field, inline, check, err := p.field(table.Name, table.Collation)
+	if err != nil {
+		return err
+	}
+	fields := table.Fields.Create
+	for i := range fields {
+		if fields[i].Field == field.Field {
+			field.After = fields[i].After
+			fields[i] = field
+			if inline != nil {
+				table.Indexes.Create = append(table.Indexes.Create, *inline)
+			}
+			if check != nil {
+				table.Constraints.Create = append(table.Constraints.Create, *check)
+			}
+			return nil
+		}
+	}
+	return p.errorf("column %s.%s is not created yet", table.Name, field.Field)
+}
+
+// drop removes a table, view, trigger, routine or event from the schema, or an index of DROP INDEX
+func (p *parser) drop(schema *dbdiffer.Schema) error {
+	p.word("TEMPORARY")
+	kind := p.next()
+	switch {
+	case kind.isword("DATABASE", "SCHEMA", "USER", "ROLE"):
+		// not part of the structure of a database
+		return nil
+	case kind.isword("INDEX"):
+		return p.dropindex(schema)
+	case !kind.isword("TABLE", "TABLES", "VIEW", "TRIGGER", "PROCEDURE", "FUNCTION", "EVENT"):
+		p.i--
+		return p.errorf("DROP %s is not supported", kind.text)
+	}
+	if p.word("IF") && !p.word("EXISTS") {
+		return p.errorf("expect IF EXISTS")
+	}
+	names := make(map[string]bool)
+	for !p.eof() {
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		names[name] = true
+		if !p.punct(",") {
+			// RESTRICT or CASCADE
+			break
+		}
+	}
+	switch {
+	case kind.isword("TABLE", "TABLES"):
+		tables := make([]dbdiffer.Table, 0, len(schema.Tables))
+		for _, table := range schema.Tables {
+			if !names[table.Name] {
+				tables = append(tables, table)
+			}
+		}
+		schema.Tables = tables
+		// triggers are dropped along with their tables
+		triggers := make([]dbdiffer.Trigger, 0, len(schema.Triggers))
+		for _, trigger := range schema.Triggers {
+			if !names[trigger.Table] {
+				triggers = append(triggers, trigger)
+			}
+		}
+		schema.Triggers = triggers
+	case kind.isword("VIEW"):
+		views := make([]dbdiffer.View, 0, len(schema.Views))
+		for _, view := range schema.Views {
+			if !names[view.Name] {
+				views = append(views, view)
+			}
+		}
+		schema.Views = views
+	case kind.isword("TRIGGER"):
+		triggers := make([]dbdiffer.Trigger, 0, len(schema.Triggers))
+		for _, trigger := range schema.Triggers {
+			if !names[trigger.Name] {
+				triggers = append(triggers, trigger)
+			}
+		}
+		schema.Triggers = triggers
+	case kind.isword("PROCEDURE", "FUNCTION"):
+		routines := make([]dbdiffer.Routine, 0, len(schema.Routines))
+		for _, routine := range schema.Routines {
+			if !names[routine.Name] || !strings.EqualFold(routine.Type, kind.text) {
+				routines = append(routines, routine)
+			}
+		}
+		schema.Routines = routines
+	case kind.isword("EVENT"):
+		events := make([]dbdiffer.Event, 0, len(schema.Events))
+		for _, event := range schema.Events {
+			if !names[event.Name] {
+				events = append(events, event)
+			}
+		}
+		schema.Events = events
+	}
+	return nil
+}
+
+// dropindex removes the index of DROP INDEX from its table
+func (p *parser) dropindex(schema *dbdiffer.Schema) error {
+	index, err := p.ident()
+	if err != nil {
+		return err
+	}
+	if !p.word("ON") {
+		return p.errorf("expect ON")
+	}
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	table, err := p.table(schema, name)
+	if err != nil {
+		return err
+	}
+	indexes := make([]dbdiffer.Index, 0, len(table.Indexes.Create))
+	for _, i := range table.Indexes.Create {
+		if !strings.EqualFold(i.KeyName, index) {
+			indexes = append(indexes, i)
+		}
+	}
+	table.Indexes.Create = indexes
+	finishtable(table)
+	return nil
+}
+
+func (p *parser) view(schema *dbdiffer.Schema, view dbdiffer.View) error {
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	view.Name = name
+	if p.peek().is("(") {
+		// column names are part of the definition as aliases
+		if _, err := p.group(); err != nil {
+			return err
+		}
+	}
+	if !p.word("AS") {
+		return p.errorf("expect AS")
+	}
+	body := p.toks[p.i:]
+	if n := len(body); n >= 3 && body[n-2].isword("CHECK") && body[n-1].isword("OPTION") {
+		view.CheckOption = "CASCADED"
+		body = body[:n-2]
+		if n := len(body); n >= 2 && body[n-1].isword("CASCADED", "LOCAL") {
+			view.CheckOption = strings.ToUpper(body[n-1].text)
+			body = body[:n-1]
+		}
+		if n := len(body); n == 0 || !body[n-1].isword("WITH") {
+			return p.errorf("expect WITH CHECK OPTION")
+		}
+		body = body[:len(body)-1]
+	}
+	if len(body) == 0 {
+		return p.errorf("expect view definition")
+	}
+	view.Definition = p.raw(body)
+	if view.CheckOption == "" {
+		view.CheckOption = "NONE"
+	}
+	if view.Algorithm == "" {
+		view.Algorithm = "UNDEFINED"
+	}
+	if view.Security == "" {
+		view.Security = "DEFINER"
+	}
+
+	// mysqldump creates a table standing in for the view first
+	for pos, table := range schema.Tables {
+		if table.Name == name {
+			schema.Tables = append(schema.Tables[:pos], schema.Tables[pos+1:]...)
+			break
+		}
+	}
+	for pos, existing := range schema.Views {
+		if existing.Name == name {
+			schema.Views[pos] = view
+			return nil
+		}
+	}
+	schema.Views = append(schema.Views, view)
+	return nil
+}
+
+func (p *parser) trigger(schema *dbdiffer.Schema) error {
+	trigger := dbdiffer.Trigger{}
+	var err error
+	if trigger.Name, err = p.name(); err != nil {
+		return err
+	}
+	timing := p.next()
+	if !timing.isword("BEFORE", "AFTER") {
+		return p.errorf("expect BEFORE or AFTER, got %q", timing.text)
+	}
+	trigger.Timing = strings.ToUpper(timing.text)
+	event := p.next()
+	if !event.isword("INSERT", "UPDATE", "DELETE") {
+		return p.errorf("expect INSERT, UPDATE or DELETE, got %q", event.text)
+	}
+	trigger.Event = strings.ToUpper(event.text)
+	if !p.word("ON") {
+		return p.errorf("expect ON")
+	}
+	if trigger.Table, err = p.name(); err != nil {
+		return err
+	}
+	if !p.word("FOR") || !p.word("EACH") || !p.word("ROW") {
+		return p.errorf("expect FOR EACH ROW")
+	}
+	if p.word("FOLLOWS", "PRECEDES") {
+		// the order among triggers of the same event is kept by the order they are created in
+		if _, err := p.name(); err != nil {
+			return err
+		}
+	}
+	if p.eof() {
+		return p.errorf("expect trigger body")
+	}
+	trigger.Statement = p.raw(p.toks[p.i:])
+	schema.Triggers = append(schema.Triggers, trigger)
+	return nil
+}
+
+func (p *parser) routine(schema *dbdiffer.Schema, typ, definer string) error {
+	routine := dbdiffer.Routine{
+		Type:       typ,
+		Definer:    definer,
+		DataAccess: "CONTAINS SQL",
+		Security:   "DEFINER",
+	}
+	if p.word("IF") {
+		if !p.word("NOT") || !p.word("EXISTS") {
+			return p.errorf("expect IF NOT EXISTS")
+		}
+	}
+	var err error
+	if routine.Name, err = p.name(); err != nil {
+		return err
+	}
+	params, err := p.group()
+	if err != nil {
+		return err
+	}
+	routine.Parameters = p.raw(params)
+	if typ == dbdiffer.Function {
+		if !p.word("RETURNS") {
+			return p.errorf("expect RETURNS")
+		}
+		start := p.i
+		if _, err := p.datatype(); err != nil {
+			return err
+		}
+		for {
+			if p.word("CHARSET", "COLLATE") {
+				p.next()
+			} else if p.word("CHARACTER") {
+				p.word("SET")
+				p.next()
+			} else {
+				break
+			}
+		}
+		routine.Returns = p.raw(p.toks[start:p.i])
+	}
+	for {
+		if p.word("COMMENT") {
+			routine.Comment = p.next().text
+		} else if p.word("LANGUAGE") {
+			p.word("SQL")
+		} else if p.word("DETERMINISTIC") {
+			routine.Deterministic = true
+		} else if p.word("NOT") {
+			if !p.word("DETERMINISTIC") {
+				return p.errorf("expect NOT DETERMINISTIC")
+			}
+			routine.Deterministic = false
+		} else if p.word("CONTAINS") {
+			p.word("SQL")
+			routine.DataAccess = "CONTAINS SQL"
+		} else if p.peek().isword("NO") && p.i+1 < len(p.toks) && p.toks[p.i+1].isword("SQL") {
+			p.i += 2
+			routine.DataAccess = "NO SQL"
+		} else if t := p.peek(); t.isword("READS", "MODIFIES") && p.i+1 < len(p.toks) && p.toks[p.i+1].isword("SQL") {
+			p.i += 2
+			p.word("DATA")
+			routine.DataAccess = strings.ToUpper(t.text) + " SQL DATA"
+		} else if p.peek().isword("SQL") && p.i+1 < len(p.toks) && p.toks[p.i+1].isword("SECURITY") {
+			p.i += 2
+			routine.Security = strings.ToUpper(p.next().text)
+		} else {
+			break
+		}
+	}
+	if p.eof() {
+		return p.errorf("expect routine body")
+	}
+	routine.Body = p.raw(p.toks[p.i:])
+	schema.Routines = append(schema.Routines, routine)
+	return nil
+}
+
+func (p *parser) event(schema *dbdiffer.Schema, definer string) error {
+	event := dbdiffer.Event{
+		Definer:      definer,
+		Status:       "ENABLED",
+		OnCompletion: "NOT PRESERVE",
+	}
+	if p.word("IF") {
+		if !p.word("NOT") || !p.word("EXISTS") {
+			return p.errorf("expect IF NOT EXISTS")
+		}
+	}
+	var err error
+	if event.Name, err = p.name(); err != nil {
+		return err
+	}
+	if !p.word("ON") || !p.word("SCHEDULE") {
+		return p.errorf("expect ON SCHEDULE")
+	}
+	// times are expressions, they run up to the next clause
+	clauses := []string{"STARTS", "ENDS", "ON", "ENABLE", "DISABLE", "COMMENT", "DO"}
+	switch {
+	case p.word("AT"):
+		event.At = p.raw(p.until(clauses...))
+	case p.word("EVERY"):
+		value := p.next()
+		unit := p.next()
+		if unit.kind != tokword {
+			return p.errorf("expect interval unit, got %q", unit.text)
+		}
+		event.Every = interval(value) + " " + strings.ToUpper(unit.text)
+		if p.word("STARTS") {
+			event.Starts = p.raw(p.until(clauses...))
+		}
+		if p.word("ENDS") {
+			event.Ends = p.raw(p.until(clauses...))
+		}
+	default:
+		return p.errorf("expect AT or EVERY")
+	}
+	for !p.eof() {
+		switch t := p.next(); {
+		case t.isword("ON"):
+			if !p.word("COMPLETION") {
+				return p.errorf("expect ON COMPLETION")
+			}
+			event.OnCompletion = "PRESERVE"
+			if p.word("NOT") {
+				event.OnCompletion = "NOT PRESERVE"
+			}
+			if !p.word("PRESERVE") {
+				return p.errorf("expect PRESERVE")
+			}
+		case t.isword("ENABLE"):
+			event.Status = "ENABLED"
+		case t.isword("DISABLE"):
+			event.Status = "DISABLED"
+			if p.word("ON") {
+				p.next()
+				event.Status = "SLAVESIDE_DISABLED"
+			}
+		case t.isword("COMMENT"):
+			event.Comment = p.next().text
+		case t.isword("DO"):
+			if p.eof() {
+				return p.errorf("expect event body")
+			}
+			event.Body = p.raw(p.toks[p.i:])
+			p.i = len(p.toks)
+		default:
+			return p.errorf("unexpected %q in event", t.text)
+		}
+	}
+	if event.Body == "" {
+		return p.errorf("expect DO")
+	}
+	schema.Events = append(schema.Events, event)
+	return nil
+}
+
+// until consumes tokens up to one of the words outside of parentheses
+func (p *parser) until(words ...string) []token {
+	start := p.i
+	depth := 0
+	for !p.eof() {
+		t := p.peek()
+		if t.is("(") {
+			depth++
+		} else if t.is(")") {
+			depth--
+		} else if depth == 0 && t.isword(words...) {
+			break
+		}
+		p.i++
+	}
+	return p.toks[start:p.i]
+}
+
+// interval formats the value of an interval like information_schema.EVENTS does,
+// numbers are bare and compound values like '1:30' are quoted
+func interval(t token) string {
+	if t.kind == toknumber {
+		return t.text
+	}
+	return "'" + strings.Replace(t.text, "'", "''", -1) + "'"
+}
+
+// definer reads an account like `user`@`host` or CURRENT_USER and formats it like SHOW CREATE does
+func (p *parser) definer() (string, error) {
+	if p.word("CURRENT_USER") {
+		if p.peek().is("(") {
+			if _, err := p.group(); err != nil {
+				return "", err
+			}
+		}
+		return "CURRENT_USER", nil
+	}
+	user, err := p.ident()
+	if err != nil {
+		return "", err
+	}
+	account := "`" + user + "`"
+	if p.punct("@") {
+		host, err := p.ident()
+		if err != nil {
+			return "", err
+		}
+		account += "@`" + host + "`"
+	}
+	return account, nil
+}
+
+func (p *parser) field(table, tablecollation string) (dbdiffer.Field, *dbdiffer.Index, *dbdiffer.Constraint, error) {
+	var inline *dbdiffer.Index
+	var check *dbdiffer.Constraint
+	symbol := ""
+	name, err := p.ident()
+	if err != nil {
+		return dbdiffer.Field{}, nil, nil, err
+	}
+	field := dbdiffer.Field{
+		Field: name,
+		Null:  "YES",
+	}
+	typ, err := p.datatype()
+	if err != nil {
+		return field, nil, nil, err
+	}
+	field.Type = typ
+
+	charset, col := "", ""
+	extra := make([]string, 0)
+	for !p.eof() {
+		t := p.next()
+		switch {
+		case t.isword("NOT"):
+			if !p.word("NULL") {
+				return field, nil, nil, p.errorf("expect NOT NULL")
+			}
+			field.Null = "NO"
+		case t.isword("NULL"):
+			field.Null = "YES"
+		case t.isword("DEFAULT"):
+			if field.Default, err = p.defaultvalue(); err != nil {
+				return field, nil, nil, err
+			}
+		case t.isword("AUTO_INCREMENT"):
+			extra = append(extra, "auto_increment")
+		case t.isword("ON"):
+			if !p.word("UPDATE") {
+				return field, nil, nil, p.errorf("expect ON UPDATE")
+			}
+			value, err := p.defaultvalue()
+			if err != nil {
+				return field, nil, nil, err
+			}
+			if value != nil {
+				extra = append(extra, "on update "+*value)
+			}
+		case t.isword("COMMENT"):
+			field.Comment = p.next().text
+		case t.isword("CHARACTER"):
+			p.word("SET")
+			charset = p.next().text
+		case t.isword("CHARSET"):
+			charset = p.next().text
+		case t.isword("COLLATE"):
+			col = strings.ToLower(p.next().text)
+		case t.isword("GENERATED"):
+			p.word("ALWAYS")
+		case t.isword("AS"):
+			expr, err := p.group()
+			if err != nil {
+				return field, nil, nil, err
+			}
+			field.Expression = p.raw(expr)
+			generated := "VIRTUAL GENERATED"
+			if p.word("STORED", "PERSISTENT") {
+				generated = "STORED GENERATED"
+			} else {
+				p.word("VIRTUAL")
+			}
+			extra = append(extra, generated)
+		case t.isword("PRIMARY", "KEY"):
+			p.word("KEY")
+			inline = &dbdiffer.Index{Table: table, NonUnique: 0, KeyName: "PRIMARY", ColumnName: []string{name}, Collation: "A"}
+		case t.isword("UNIQUE"):
+			p.word("KEY", "INDEX")
+			inline = &dbdiffer.Index{Table: table, NonUnique: 0, KeyName: name, ColumnName: []string{name}, Collation: "A"}
+		case t.isword("REFERENCES"):
+			// inline foreign keys are ignored by mysql
+			p.i = len(p.toks)
+		case t.isword("CONSTRAINT"):
+			if !p.peek().isword("CHECK") {
+				if symbol, err = p.ident(); err != nil {
+					return field, nil, nil, err
+				}
+			}
+		case t.isword("CHECK"):
+			constraint, err := p.check(table, symbol)
+			if err != nil {
+				return field, nil, nil, err
+			}
+			check = &constraint
+		case t.is("("):
+			// arguments of an ignored attribute
+			p.i--
+			if _, err := p.group(); err != nil {
+				return field, nil, nil, err
+			}
+		}
+	}
+	field.Extra = strings.Join(extra, " ")
+
+	if textual(typ) {
+		switch {
+		case col != "":
+		case charset != "":
+			col = collation(charset)
+		default:
+			col = tablecollation
+		}
+		// an empty collation is the default of the table, which is not known either
+		field.Collation = &col
+	}
+	return field, inline, check, nil
+}
+
+var typealias = map[string]string{
+	"integer":   "int",
+	"int4":      "int",
+	"int1":      "tinyint",
+	"int2":      "smallint",
+	"int3":      "mediumint",
+	"int8":      "bigint",
+	"middleint": "mediumint",
+	"dec":       "decimal",
+	"numeric":   "decimal",
+	"fixed":     "decimal",
+	"real":      "double",
+	"float8":    "double",
+	"float4":    "float",
+}
+
+// datatype reads a column type and formats it like SHOW FULL FIELDS does
+func (p *parser) datatype() (string, error) {
+	t := p.next()
+	if t.kind != tokword {
+		return "", p.errorf("expect data type, got %q", t.text)
+	}
+	name := strings.ToLower(t.text)
+	switch name {
+	case "bool", "boolean":
+		return "tinyint(1)", nil
+	case "double":
+		p.word("PRECISION")
+	case "character":
+		name = "char"
+		if p.word("VARYING") {
+			name = "varchar"
+		}
+	case "national":
+		name = "char"
+		if p.word("VARCHAR") {
+			name = "varchar"
+		} else if p.word("CHAR", "CHARACTER") && p.word("VARYING") {
+			name = "varchar"
+		}
+	case "nchar":
+		name = "char"
+	case "nvarchar":
+		name = "varchar"
+	case "long":
+		name = "mediumtext"
+		if p.word("VARBINARY") {
+			name = "mediumblob"
+		} else {
+			p.word("VARCHAR")
+		}
+	}
+	if alias, exist := typealias[name]; exist {
+		name = alias
+	}
+	if p.peek().is("(") {
+		args, err := p.group()
+		if err != nil {
+			return "", err
+		}
+		values := make([]string, 0)
+		for _, arg := range split(args) {
+			if len(arg) == 1 && arg[0].kind == tokstring {
+				values = append(values, "'"+strings.Replace(arg[0].text, "'", "''", -1)+"'")
+			} else {
+				values = append(values, strings.Join(strings.Fields(p.raw(arg)), ""))
+			}
+		}
+		name += "(" + strings.Join(values, ",") + ")"
+	}
+	unsigned, zerofill := false, false
+	for {
+		if p.word("UNSIGNED") {
+			unsigned = true
+		} else if p.word("ZEROFILL") {
+			zerofill = true
+		} else if p.word("SIGNED") {
+		} else {
+			break
+		}
+	}
+	// zerofill columns are unsigned
+	if unsigned || zerofill {
+		name += " unsigned"
+	}
+	if zerofill {
+		name += " zerofill"
+	}
+	return name, nil
+}
+
+// defaultvalue reads a default value and formats it like SHOW FULL FIELDS does
+func (p *parser) defaultvalue() (*string, error) {
+	t := p.next()
+	value := t.text
+	switch {
+	case t.kind == tokstring:
+	case t.is("-") || t.is("+"):
+		n := p.next()
+		value = strings.TrimPrefix(t.text, "+") + n.text
+	case t.is("("):
+		p.i--
+		expr, err := p.group()
+		if err != nil {
+			return nil, err
+		}
+		value = p.raw(expr)
+	case t.isword("NULL"):
+		return nil, nil
+	case t.isword("TRUE"):
+		value = "1"
+	case t.isword("FALSE"):
+		value = "0"
+	case t.isword("CURRENT_TIMESTAMP", "NOW", "LOCALTIME", "LOCALTIMESTAMP"):
+		value = "CURRENT_TIMESTAMP"
+		if p.peek().is("(") {
+			args, err := p.group()
+			if err != nil {
+				return nil, err
+			}
+			if len(args) > 0 {
+				value += "(" + p.raw(args) + ")"
+			}
+		}
+	case t.kind == tokword && p.peek().kind == tokstring && p.peek().pos == t.end:
+		// b'0101', x'ff' or a character set introducer like _utf8mb4'text'
+		s := p.next()
+		if strings.HasPrefix(t.text, "_") {
+			value = s.text
+		} else {
+			value = p.src[t.pos:s.end]
+		}
+	case t.kind == tokword || t.kind == toknumber:
+	default:
+		return nil, p.errorf("unexpected %q in default value", t.text)
+	}
+	return &value, nil
+}
+
+func (p *parser) index(table, symbol string, existing []dbdiffer.Index) (dbdiffer.Index, error) {
+	index := dbdiffer.Index{
+		Table:     table,
+		NonUnique: 1,
+		Collation: "A",
+	}
+	switch t := p.next(); {
+	case t.isword("PRIMARY"):
+		if !p.word("KEY") {
+			return index, p.errorf("expect PRIMARY KEY")
+		}
+		index.NonUnique = 0
+		index.KeyName = "PRIMARY"
+	case t.isword("UNIQUE"):
+		p.word("KEY", "INDEX")
+		index.NonUnique = 0
+	case t.isword("FULLTEXT", "SPATIAL"):
+		p.word("KEY", "INDEX")
+		index.IndexType = strings.ToUpper(t.text)
+		if index.IndexType == "FULLTEXT" {
+			index.Collation = ""
+		}
+	default:
+		// KEY or INDEX
+	}
+	if index.KeyName == "" && !p.peek().is("(") && !p.peek().isword("USING") {
+		name, err := p.ident()
+		if err != nil {
+			return index, err
+		}
+		index.KeyName = name
+	}
+	if p.word("USING") {
+		index.IndexType = strings.ToUpper(p.next().text)
+	}
+	parts, err := p.group()
+	if err != nil {
+		return index, err
+	}
+	for _, toks := range split(parts) {
+		if len(toks) == 0 {
+			return index, p.errorf("empty key part")
+		}
+		d := &parser{src: p.src, toks: toks}
+		part := dbdiffer.IndexPart{Collation: index.Collation}
+		if d.peek().is("(") {
+			// functional key part
+			expr, err := d.group()
+			if err != nil {
+				return index, err
+			}
+			part.Expression = d.raw(expr)
+			index.ColumnName = append(index.ColumnName, part.Expression)
+		} else {
+			if part.Column, err = d.ident(); err != nil {
+				return index, err
+			}
+			index.ColumnName = append(index.ColumnName, part.Column)
+			if d.peek().is("(") {
+				length, err := d.group()
+				if err != nil {
+					return index, err
+				}
+				if len(length) != 1 {
+					return index, d.errorf("expect prefix length of %s", part.Column)
+				}
+				if part.SubPart, err = strconv.Atoi(length[0].text); err != nil {
+					return index, d.errorf("expect prefix length of %s", part.Column)
+				}
+			}
+		}
+		if d.word("DESC") {
+			part.Collation = "D"
+		}
+		index.Parts = append(index.Parts, part)
+	}
+	for !p.eof() {
+		switch t := p.next(); {
+		case t.isword("USING"):
+			index.IndexType = strings.ToUpper(p.next().text)
+		case t.isword("COMMENT"):
+			index.IndexComment = p.next().text
+		case t.isword("WITH"):
+			if !p.word("PARSER") {
+				return index, p.errorf("expect WITH PARSER")
+			}
+			if index.Parser, err = p.ident(); err != nil {
+				return index, err
+			}
+		case t.isword("INVISIBLE"):
+			index.Visible = "NO"
+		case t.isword("VISIBLE"):
+			index.Visible = "YES"
+		}
+	}
+	if len(index.Parts) > 0 {
+		index.Collation = index.Parts[0].Collation
+	}
+	if index.KeyName == "" {
+		index.KeyName = symbol
+	}
+	if index.KeyName == "" {
+		// unnamed indexes are named after their first column
+		index.KeyName = index.ColumnName[0]
+		for n := 2; indexexists(existing, index.KeyName); n++ {
+			index.KeyName = fmt.Sprintf("%s_%d", index.ColumnName[0], n)
+		}
+	}
+	return index, nil
+}
+
+// partition reads the partitioning of a table after PARTITION BY
+func (p *parser) partition() (*dbdiffer.Partition, error) {
+	partition := &dbdiffer.Partition{}
+	var err error
+	if partition.Method, partition.Expression, err = p.partitionmethod(); err != nil {
+		return nil, err
+	}
+	count, subcount := 0, 0
+	if p.word("PARTITIONS") {
+		if count, err = strconv.Atoi(p.next().text); err != nil {
+			return nil, p.errorf("expect number of partitions")
+		}
+	}
+	if p.word("SUBPARTITION") {
+		if !p.word("BY") {
+			return nil, p.errorf("expect SUBPARTITION BY")
+		}
+		if partition.SubMethod, partition.SubExpression, err = p.partitionmethod(); err != nil {
+			return nil, err
+		}
+		if p.word("SUBPARTITIONS") {
+			if subcount, err = strconv.Atoi(p.next().text); err != nil {
+				return nil, p.errorf("expect number of sub partitions")
+			}
+		}
+	}
+	if p.peek().is("(") {
+		group, err := p.group()
+		if err != nil {
+			return nil, err
+		}
+		for _, def := range split(group) {
+			d := &parser{src: p.src, toks: def}
+			definition, err := d.partitiondefinition()
+			if err != nil {
+				return nil, err
+			}
+			partition.Partitions = append(partition.Partitions, definition)
+		}
+	} else {
+		// partitions without definitions are named like mysql does
+		for i := 0; i < count; i++ {
+			partition.Partitions = append(partition.Partitions, dbdiffer.PartitionDefinition{Name: fmt.Sprintf("p%d", i)})
+		}
+	}
+	for i := range partition.Partitions {
+		if len(partition.Partitions[i].SubPartitions) > 0 {
+			continue
+		}
+		for j := 0; j < subcount; j++ {
+			partition.Partitions[i].SubPartitions = append(partition.Partitions[i].SubPartitions, fmt.Sprintf("%ssp%d", partition.Partitions[i].Name, j))
+		}
+	}
+	return partition, nil
+}
+
+// partitionmethod reads a method like RANGE COLUMNS or LINEAR HASH and the expression partitioned by
+func (p *parser) partitionmethod() (string, string, error) {
+	method := ""
+	if p.word("LINEAR") {
+		method = "LINEAR "
+	}
+	t := p.next()
+	if !t.isword("RANGE", "LIST", "HASH", "KEY") {
+		return "", "", p.errorf("unexpected partitioning %q", t.text)
+	}
+	method += strings.ToUpper(t.text)
+	if p.word("COLUMNS") {
+		method += " COLUMNS"
+	}
+	if p.word("ALGORITHM") {
+		p.punct("=")
+		p.next()
+	}
+	expr, err := p.group()
+	if err != nil {
+		return "", "", err
+	}
+	return method, p.raw(expr), nil
+}
+
+// partitiondefinition reads a partition, options other than values and comment are ignored
+func (p *parser) partitiondefinition() (dbdiffer.PartitionDefinition, error) {
+	definition := dbdiffer.PartitionDefinition{}
+	if !p.word("PARTITION") {
+		return definition, p.errorf("expect PARTITION, got %q", p.peek().text)
+	}
+	name, err := p.ident()
+	if err != nil {
+		return definition, err
+	}
+	definition.Name = name
+	for !p.eof() {
+		t := p.next()
+		switch {
+		case t.isword("VALUES"):
+			start := p.i
+			switch {
+			case p.word("LESS"):
+				if !p.word("THAN") {
+					return definition, p.errorf("expect VALUES LESS THAN")
+				}
+				if !p.word("MAXVALUE") {
+					if _, err := p.group(); err != nil {
+						return definition, err
+					}
+				}
+			case p.word("IN"):
+				if _, err := p.group(); err != nil {
+					return definition, err
+				}
+			default:
+				return definition, p.errorf("expect VALUES LESS THAN or VALUES IN")
+			}
+			definition.Values = p.raw(p.toks[start:p.i])
+		case t.isword("COMMENT"):
+			p.punct("=")
+			definition.Comment = p.next().text
+		case t.is("("):
+			p.i--
+			group, err := p.group()
+			if err != nil {
+				return definition, err
+			}
+			for _, def := range split(group) {
+				d := &parser{src: p.src, toks: def}
+				if !d.word("SUBPARTITION") {
+					return definition, d.errorf("expect SUBPARTITION, got %q", d.peek().text)
+				}
+				name, err := d.ident()
+				if err != nil {
+					return definition, err
+				}
+				definition.SubPartitions = append(definition.SubPartitions, name)
+			}
+		}
+	}
+	return definition, nil
+}
+
+// check reads the expression of a check constraint after CHECK
+func (p *parser) check(table, symbol string) (dbdiffer.Constraint, error) {
+	constraint := dbdiffer.Constraint{
+		Name:     symbol,
+		Table:    table,
+		Type:     dbdiffer.Check,
+		Enforced: "YES",
+	}
+	expr, err := p.group()
+	if err != nil {
+		return constraint, err
+	}
+	constraint.Expression = p.raw(expr)
+	if p.word("NOT") {
+		if !p.word("ENFORCED") {
+			return constraint, p.errorf("expect NOT ENFORCED")
+		}
+		constraint.Enforced = "NO"
+	} else {
+		p.word("ENFORCED")
+	}
+	return constraint, nil
+}
+
+func (p *parser) foreignkey(table, symbol string, n int) (dbdiffer.Constraint, error) {
+	constraint := dbdiffer.Constraint{
+		Name:     symbol,
+		Table:    table,
+		Type:     dbdiffer.ForeignKey,
+		OnUpdate: "RESTRICT",
+		OnDelete: "RESTRICT",
+	}
+	if constraint.Name == "" {
+		constraint.Name = fmt.Sprintf("%s_ibfk_%d", table, n)
+	}
+	if !p.word("KEY") {
+		return constraint, p.errorf("expect FOREIGN KEY")
+	}
+	if !p.peek().is("(") {
+		// name of the index created for the foreign key
+		if _, err := p.ident(); err != nil {
+			return constraint, err
+		}
+	}
+	columns, err := p.group()
+	if err != nil {
+		return constraint, err
+	}
+	for _, column := range split(columns) {
+		constraint.Columns = append(constraint.Columns, column[0].text)
+	}
+	if !p.word("REFERENCES") {
+		return constraint, p.errorf("expect REFERENCES")
+	}
+	if constraint.RefTable, err = p.name(); err != nil {
+		return constraint, err
+	}
+	columns, err = p.group()
+	if err != nil {
+		return constraint, err
+	}
+	for _, column := range split(columns) {
+		constraint.RefColumns = append(constraint.RefColumns, column[0].text)
+	}
+	for !p.eof() {
+		switch t := p.next(); {
+		case t.isword("MATCH"):
+			p.next()
+		case t.isword("ON"):
+			event := p.next()
+			action := strings.ToUpper(p.next().text)
+			if action == "SET" || action == "NO" {
+				action += " " + strings.ToUpper(p.next().text)
+			}
+			if event.isword("DELETE") {
+				constraint.OnDelete = action
+			} else {
+				constraint.OnUpdate = action
+			}
+		default:
+			return constraint, p.errorf("unexpected %q in foreign key", t.text)
+		}
+	}
+	return constraint, nil
+}
+
+func indexexists(indexes []dbdiffer.Index, name string) bool {
+	for _, index := range indexes {
+		if strings.EqualFold(index.KeyName, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// textual tells whether the type has a collation
+func textual(typ string) bool {
+	if strings.Contains(typ, "(") {
+		typ = typ[:strings.Index(typ, "(")]
+	}
+	switch typ {
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext", "enum", "set":
+		return true
+	default:
+		return false
+	}
+}
+
+var engines = map[string]string{
+	"innodb":     "InnoDB",
+	"myisam":     "MyISAM",
+	"memory":     "MEMORY",
+	"heap":       "MEMORY",
+	"csv":        "CSV",
+	"archive":    "ARCHIVE",
+	"blackhole":  "BLACKHOLE",
+	"mrg_myisam": "MRG_MYISAM",
+	"federated":  "FEDERATED",
+	"ndb":        "ndbcluster",
+	"ndbcluster": "ndbcluster",
+}
+
+func engine(s string) string {
+	if e, exist := engines[strings.ToLower(s)]; exist {
+		return e
+	}
+	return s
+}
+
+// collation returns the collation standing for the default collation of a character set,
+// which depends on the server version and is taken as the same as any collation of the character set
+func collation(charset string) string {
+	return strings.ToLower(charset)
+}
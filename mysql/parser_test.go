@@ -0,0 +1,1545 @@
+package mysql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/sillydong/dbdiffer"
+)
+
+const dump = `-- MySQL dump 10.13
+/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;
+DROP TABLE IF EXISTS ` + "`user`" + `;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+CREATE TABLE ` + "`user`" + ` (
+  ` + "`id`" + ` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  ` + "`name`" + ` varchar(64) NOT NULL DEFAULT '' COMMENT 'user''s name',
+  ` + "`email`" + ` varchar(128) CHARACTER SET latin1 DEFAULT NULL,
+  ` + "`balance`" + ` decimal(10, 2) NOT NULL DEFAULT '0.00',
+  ` + "`status`" + ` enum('on','off') NOT NULL DEFAULT 'on',
+  ` + "`created_at`" + ` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (` + "`id`" + `),
+  UNIQUE KEY ` + "`uk_email`" + ` (` + "`email`" + `),
+  KEY ` + "`idx_name`" + ` (` + "`name`" + `,` + "`status`" + `) COMMENT 'lookup'
+) ENGINE=InnoDB AUTO_INCREMENT=3 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='users';
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+create table if not exists log (
+  id bigint primary key,
+  message text,
+  flag boolean default false,
+  index (message(10))
+) engine=myisam default charset=latin1;
+
+INSERT INTO log VALUES (1, 'CREATE TABLE nothing (id int);', 0);
+`
+
+func TestParse(t *testing.T) {
+	schema, err := ParseSchema(strings.NewReader(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tb := schema.Tables
+	if len(tb) != 2 || tb[1].Name != "log" {
+		t.Fatalf("unexpected tables %+v", tb)
+	}
+	if tb[0].Engine != "InnoDB" || tb[0].Collation != "utf8mb4_unicode_ci" || tb[0].Comment != "users" {
+		t.Fatalf("unexpected table %+v", tb[0])
+	}
+	if tb[1].Engine != "MyISAM" || tb[1].Collation != "latin1" {
+		t.Fatalf("unexpected table %+v", tb[1])
+	}
+
+	fids := tb[0].Fields.Create
+	expects := []struct {
+		field, typ, null, def, extra, collation, after string
+	}{
+		{"id", "int(10) unsigned", "NO", "", "auto_increment", "", ""},
+		{"name", "varchar(64)", "NO", "", "", "utf8mb4_unicode_ci", "id"},
+		{"email", "varchar(128)", "YES", "", "", "latin1", "name"},
+		{"balance", "decimal(10,2)", "NO", "0.00", "", "", "email"},
+		{"status", "enum('on','off')", "NO", "on", "", "utf8mb4_unicode_ci", "balance"},
+		{"created_at", "timestamp", "NO", "CURRENT_TIMESTAMP", "on update CURRENT_TIMESTAMP", "", "status"},
+	}
+	if len(fids) != len(expects) {
+		t.Fatalf("expect %d fields, got %+v", len(expects), fids)
+	}
+	for i, expect := range expects {
+		f := fids[i]
+		def, collation := "", ""
+		if f.Default != nil {
+			def = *f.Default
+		}
+		if f.Collation != nil {
+			collation = *f.Collation
+		}
+		if f.Field != expect.field || f.Type != expect.typ || f.Null != expect.null || def != expect.def || f.Extra != expect.extra || collation != expect.collation || f.After != expect.after {
+			t.Errorf("field %d: expect %+v, got %+v (default %q, collation %q)", i, expect, f, def, collation)
+		}
+	}
+	if fids[1].Comment != "user's name" {
+		t.Errorf("unexpected comment %q", fids[1].Comment)
+	}
+
+	idxs := tb[0].Indexes.Create
+	if len(idxs) != 3 || idxs[0].KeyName != "PRIMARY" || idxs[1].NonUnique != 0 || idxs[2].IndexComment != "lookup" {
+		t.Fatalf("unexpected indexes %+v", idxs)
+	}
+	if strings.Join(idxs[2].ColumnName, ",") != "name,status" {
+		t.Fatalf("unexpected index columns %+v", idxs[2].ColumnName)
+	}
+
+	fids = tb[1].Fields.Create
+	if fids[0].Null != "NO" || fids[2].Type != "tinyint(1)" || *fids[2].Default != "0" {
+		t.Fatalf("unexpected fields %+v", fids)
+	}
+	idxs = tb[1].Indexes.Create
+	if len(idxs) != 2 || idxs[0].KeyName != "PRIMARY" || idxs[1].KeyName != "message" {
+		t.Fatalf("unexpected indexes %+v", idxs)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	_, err := ParseSchema(strings.NewReader("CREATE TABLE t (\n  id int,\n  KEY (id\n);"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 4") {
+		t.Fatalf("expect error on line 4, got %v", err)
+	}
+}
+
+func TestParseAlter(t *testing.T) {
+	schema, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (id int NOT NULL, name varchar(64), email varchar(128), legacy int);
+CREATE TABLE post (id int NOT NULL, user_id int NOT NULL);
+ALTER TABLE user ADD PRIMARY KEY (id), ADD UNIQUE KEY uk_email (email), MODIFY id int NOT NULL AUTO_INCREMENT, AUTO_INCREMENT=3;
+ALTER TABLE post ADD PRIMARY KEY (id), ADD KEY user_id (user_id);
+ALTER TABLE post ADD CONSTRAINT fk_post_user FOREIGN KEY (user_id) REFERENCES user (id);
+/*!40000 ALTER TABLE post DISABLE KEYS */;
+CREATE INDEX idx_name ON user (name(10) DESC) ALGORITHM = INPLACE;
+CREATE INDEX idx_legacy ON user (legacy);
+DROP INDEX idx_legacy ON user;
+CREATE TABLE obsolete (id int);
+CREATE VIEW v AS SELECT 1 AS id;
+DROP TABLE IF EXISTS obsolete, missing;
+DROP VIEW IF EXISTS v;
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Tables) != 2 || len(schema.Views) != 0 {
+		t.Fatalf("unexpected tables %+v and views %+v", schema.Tables, schema.Views)
+	}
+	user := schema.Tables[0]
+	keys := make([]string, 0)
+	for _, index := range user.Indexes.Create {
+		keys = append(keys, index.KeyName)
+	}
+	if strings.Join(keys, ",") != "PRIMARY,uk_email,idx_name" {
+		t.Errorf("unexpected indexes %+v", user.Indexes.Create)
+	}
+	if id := user.Fields.Create[0]; id.Extra != "auto_increment" || id.Key != "PRI" || id.After != "" {
+		t.Errorf("unexpected modified column %+v", id)
+	}
+	if parts := user.Indexes.Create[2].Parts; len(parts) != 1 || parts[0].SubPart != 10 || parts[0].Collation != "D" {
+		t.Errorf("unexpected key parts %+v", parts)
+	}
+	post := schema.Tables[1]
+	if len(post.Indexes.Create) != 2 || len(post.Constraints.Create) != 1 || post.Constraints.Create[0].RefTable != "user" {
+		t.Errorf("unexpected indexes %+v and constraints %+v", post.Indexes.Create, post.Constraints.Create)
+	}
+
+	for _, sql := range []string{
+		"CREATE TABLE t (id int);\nALTER TABLE t RENAME TO u;",
+		"CREATE TABLE t (id int);\nALTER TABLE t ADD COLUMN name int;",
+		"CREATE TABLE t (id int);\nALTER TABLE t MODIFY id bigint FIRST;",
+		"CREATE INDEX idx ON t (id);",
+		"RENAME TABLE t TO u;",
+	} {
+		if _, err := ParseSchema(strings.NewReader(sql)); err == nil || !strings.Contains(err.Error(), "not") {
+			t.Errorf("%s: expect an error, got %v", sql, err)
+		}
+	}
+}
+
+func TestDiffFile(t *testing.T) {
+	differ, err := New(FilePrefix+"testdata/new.sql", FilePrefix+"testdata/old.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer differ.Close()
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	expects := []string{
+		"DROP TABLE IF EXISTS `legacy`;",
+		"CREATE TABLE IF NOT EXISTS `tag` (`id` int(11) NOT NULL auto_increment, `name` varchar(32) NOT NULL DEFAULT '' ,  PRIMARY KEY (`id`)) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;",
+		"ALTER TABLE `user` DROP INDEX `idx_name`;",
+		"ALTER TABLE `user` DROP `nickname`;",
+		"ALTER TABLE `user` ADD `email` varchar(128) CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci NULL  AFTER `name`;",
+		"ALTER TABLE `user` CHANGE `name` `name` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_general_ci NOT NULL DEFAULT '' ;",
+		"ALTER TABLE `user` ADD UNIQUE `uk_email` (`email`);",
+	}
+	for i, s := range gen {
+		t.Log(s)
+		if i < len(expects) && s != expects[i] {
+			t.Errorf("statement %d: expect\n%s\ngot\n%s", i, expects[i], s)
+		}
+	}
+	if len(gen) != len(expects) {
+		t.Fatalf("expect %d statements, got %d", len(expects), len(gen))
+	}
+}
+
+func TestDiffDefaults(t *testing.T) {
+	file, err := ParseSchema(strings.NewReader("CREATE TABLE t (id int NOT NULL, name varchar(32), note text) DEFAULT CHARSET=utf8mb4;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as read from a mysql 5.7 server
+	general, unicode := "utf8mb4_general_ci", "utf8mb4_unicode_ci"
+	live := &dbdiffer.Schema{Tables: []dbdiffer.Table{{
+		Name:      "t",
+		Engine:    "InnoDB",
+		Version:   "10",
+		RowFormat: "Dynamic",
+		Collation: general,
+		Fields: dbdiffer.ResultFields{Create: []dbdiffer.Field{
+			{Field: "id", Type: "int", Null: "NO"},
+			{Field: "name", Type: "varchar(32)", Collation: &general, Null: "YES", After: "id"},
+			{Field: "note", Type: "text", Collation: &unicode, Null: "YES", After: "name"},
+		}},
+	}}}
+	res := dbdiffer.Compare(live, file)
+	if !res.IsEmpty() {
+		t.Fatalf("defaults of the server are taken as changes %+v", res.Change)
+	}
+
+	// another character set is still a change
+	latin1 := "latin1_swedish_ci"
+	live.Tables[0].Fields.Create[2].Collation = &latin1
+	res = dbdiffer.Compare(live, file)
+	if len(res.Change) != 1 || len(res.Change[0].Fields.Change) != 1 || res.Change[0].Fields.Change[0].New.Field != "note" {
+		t.Fatalf("unexpected changes %+v", res.Change)
+	}
+}
+
+func TestDiffDisplayWidth(t *testing.T) {
+	file, err := ParseSchema(strings.NewReader("CREATE TABLE t (id bigint unsigned NOT NULL, age int, active tinyint(1), code int(4) zerofill) DEFAULT CHARSET=utf8mb4;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as read from a mysql 5.7 server, which shows the display width of all integers
+	live := &dbdiffer.Schema{Tables: []dbdiffer.Table{{
+		Name:      "t",
+		Engine:    "InnoDB",
+		Collation: "utf8mb4_general_ci",
+		Fields: dbdiffer.ResultFields{Create: []dbdiffer.Field{
+			{Field: "id", Type: "bigint(20) unsigned", Null: "NO"},
+			{Field: "age", Type: "int(11)", Null: "YES", After: "id"},
+			{Field: "active", Type: "tinyint(1)", Null: "YES", After: "age"},
+			{Field: "code", Type: "int(4) unsigned zerofill", Null: "YES", After: "active"},
+		}},
+	}}}
+	res := dbdiffer.Compare(live, file)
+	if !res.IsEmpty() {
+		t.Fatalf("display widths are taken as changes %+v", res.Change)
+	}
+
+	// tinyint(1) is a boolean, and zerofill pads to the display width
+	live.Tables[0].Fields.Create[2].Type = "tinyint(4)"
+	live.Tables[0].Fields.Create[3].Type = "int(10) unsigned zerofill"
+	res = dbdiffer.Compare(live, file)
+	if len(res.Change) != 1 || len(res.Change[0].Fields.Change) != 2 {
+		t.Fatalf("unexpected changes %+v", res.Change)
+	}
+}
+
+func TestDiffTableOptions(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader("CREATE TABLE t (id int NOT NULL) ROW_FORMAT=COMPACT COMMENT='old';"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := ParseSchema(strings.NewReader("CREATE TABLE t (id int NOT NULL) ROW_FORMAT=COMPACT COMMENT='it''s new';"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	differ := NewFromInspectors(new, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the character set is not given, so it is left as it is
+	expect := "ALTER TABLE `t` ENGINE = InnoDB ROW_FORMAT = COMPACT COMMENT = 'it\\'s new';"
+	if len(statements) != 1 || statements[0].SQL != expect || statements[0].RebuildsTable {
+		t.Fatalf("expect %s, got %+v", expect, statements)
+	}
+}
+
+func TestDiffForeignKey(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (id int NOT NULL, PRIMARY KEY (id)) ENGINE=InnoDB;
+CREATE TABLE post (
+  id int NOT NULL,
+  user_id int NOT NULL,
+  PRIMARY KEY (id),
+  KEY idx_user (user_id),
+  FOREIGN KEY (user_id) REFERENCES user (id)
+) ENGINE=InnoDB;
+CREATE TABLE legacy (id int NOT NULL, post_id int, CONSTRAINT fk_legacy_post FOREIGN KEY (post_id) REFERENCES post (id)) ENGINE=InnoDB;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fk := old.Tables[1].Constraints.Create
+	if len(fk) != 1 || fk[0].Name != "post_ibfk_1" || fk[0].RefTable != "user" || fk[0].OnDelete != "RESTRICT" {
+		t.Fatalf("unexpected constraints %+v", fk)
+	}
+
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (id int NOT NULL, PRIMARY KEY (id)) ENGINE=InnoDB;
+CREATE TABLE post (
+  id int NOT NULL,
+  writer int NOT NULL,
+  tag_id int NOT NULL,
+  PRIMARY KEY (id),
+  KEY idx_writer (writer),
+  KEY idx_tag (tag_id),
+  CONSTRAINT fk_post_author FOREIGN KEY fk_idx (writer) REFERENCES user (id) ON DELETE CASCADE ON UPDATE NO ACTION,
+  CONSTRAINT fk_post_tag FOREIGN KEY (tag_id) REFERENCES tag (id) ON DELETE SET NULL
+) ENGINE=InnoDB;
+CREATE TABLE tag (id int NOT NULL, PRIMARY KEY (id)) ENGINE=InnoDB;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fk = new.Tables[1].Constraints.Create
+	if len(fk) != 2 || fk[0].OnDelete != "CASCADE" || fk[0].OnUpdate != "NO ACTION" || fk[1].OnDelete != "SET NULL" {
+		t.Fatalf("unexpected constraints %+v", fk)
+	}
+
+	differ := NewFromInspectors(new, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	position := func(prefix string) int {
+		for i, s := range gen {
+			if strings.HasPrefix(s, prefix) {
+				return i
+			}
+		}
+		t.Fatalf("missing statement %q in %q", prefix, gen)
+		return -1
+	}
+	dropfk := position("ALTER TABLE `post` DROP FOREIGN KEY `post_ibfk_1`;")
+	position("DROP TABLE IF EXISTS `legacy`;")
+	dropcolumn := position("ALTER TABLE `post` DROP `user_id`;")
+	createtag := position("CREATE TABLE IF NOT EXISTS `tag`")
+	addfk := position("ALTER TABLE `post` ADD CONSTRAINT `fk_post_tag` FOREIGN KEY (`tag_id`) REFERENCES `tag` (`id`) ON DELETE SET NULL ON UPDATE RESTRICT;")
+	position("ALTER TABLE `post` ADD CONSTRAINT `fk_post_author` FOREIGN KEY (`writer`) REFERENCES `user` (`id`) ON DELETE CASCADE ON UPDATE NO ACTION;")
+	if dropfk > dropcolumn || addfk < createtag {
+		t.Errorf("unexpected statement order %q", gen)
+	}
+}
+
+func TestGenerateOrder(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE a (id int NOT NULL, b_id int, PRIMARY KEY (id), KEY (b_id), CONSTRAINT fk_a_b FOREIGN KEY (b_id) REFERENCES b (id));
+CREATE TABLE b (id int NOT NULL, a_id int, PRIMARY KEY (id), KEY (a_id), CONSTRAINT fk_b_a FOREIGN KEY (a_id) REFERENCES a (id));`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE comment (id int NOT NULL, post_id int, PRIMARY KEY (id), KEY (post_id), CONSTRAINT fk_comment_post FOREIGN KEY (post_id) REFERENCES post (id));
+CREATE TABLE post (id int NOT NULL, user_id int, PRIMARY KEY (id), KEY (user_id), CONSTRAINT fk_post_user FOREIGN KEY (user_id) REFERENCES user (id));
+CREATE TABLE user (id int NOT NULL, post_id int, PRIMARY KEY (id), KEY (post_id), CONSTRAINT fk_user_post FOREIGN KEY (post_id) REFERENCES post (id));`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	differ := NewFromInspectors(new, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	expects := []string{
+		// b is dropped first in the cycle, so the foreign key referencing it goes first
+		"ALTER TABLE `a` DROP FOREIGN KEY `fk_a_b`;",
+		"DROP TABLE IF EXISTS `b`;",
+		"DROP TABLE IF EXISTS `a`;",
+		// post and user reference each other, user is split out of the cycle
+		"CREATE TABLE IF NOT EXISTS `post` (`id` int NOT NULL , `user_id` int NULL ,  PRIMARY KEY (`id`), INDEX `user_id` (`user_id`)) ENGINE = InnoDB;",
+		"CREATE TABLE IF NOT EXISTS `comment` (`id` int NOT NULL , `post_id` int NULL ,  PRIMARY KEY (`id`), INDEX `post_id` (`post_id`), CONSTRAINT `fk_comment_post` FOREIGN KEY (`post_id`) REFERENCES `post` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT) ENGINE = InnoDB;",
+		"CREATE TABLE IF NOT EXISTS `user` (`id` int NOT NULL , `post_id` int NULL ,  PRIMARY KEY (`id`), INDEX `post_id` (`post_id`), CONSTRAINT `fk_user_post` FOREIGN KEY (`post_id`) REFERENCES `post` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT) ENGINE = InnoDB;",
+		"ALTER TABLE `post` ADD CONSTRAINT `fk_post_user` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE RESTRICT ON UPDATE RESTRICT;",
+	}
+	for i, s := range gen {
+		t.Log(s)
+		if i < len(expects) && s != expects[i] {
+			t.Errorf("statement %d: expect\n%s\ngot\n%s", i, expects[i], s)
+		}
+	}
+	if len(gen) != len(expects) {
+		t.Fatalf("expect %d statements, got %d", len(expects), len(gen))
+	}
+}
+
+func TestDiffRename(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader("CREATE TABLE user (id int NOT NULL, username varchar(32) NOT NULL DEFAULT '', PRIMARY KEY (id), KEY idx_name (username));"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := ParseSchema(strings.NewReader("CREATE TABLE user (id int NOT NULL, user_name varchar(32) NOT NULL DEFAULT '', PRIMARY KEY (id), KEY idx_name (user_name));"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	differ := NewFromInspectors(new, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	expect := "ALTER TABLE `user` CHANGE `username` `user_name` varchar(32) NOT NULL DEFAULT '' ;"
+	if len(gen) != 1 || gen[0] != expect {
+		t.Fatalf("expect %q, got %q", expect, gen)
+	}
+}
+
+func TestDiffTableRename(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader("CREATE TABLE users (id int NOT NULL, name varchar(32) NOT NULL, email varchar(128), PRIMARY KEY (id), KEY idx_name (name));"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := ParseSchema(strings.NewReader("CREATE TABLE user (id int NOT NULL, name varchar(32) NOT NULL, email varchar(128), age int, PRIMARY KEY (id), KEY idx_name (name));"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	differ := NewFromInspectors(new, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	expects := []string{
+		"RENAME TABLE `users` TO `user`;",
+		"ALTER TABLE `user` ADD `age` int NULL  AFTER `email`;",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expects, "\n") {
+		t.Fatalf("expect %q, got %q", expects, gen)
+	}
+}
+
+func TestParseView(t *testing.T) {
+	schema, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (id int NOT NULL, status varchar(8), PRIMARY KEY (id));
+/*!50001 DROP VIEW IF EXISTS ` + "`recent_user`" + `*/;
+/*!50001 CREATE TABLE ` + "`recent_user`" + ` (` + "`id`" + ` tinyint NOT NULL) ENGINE=MyISAM */;
+/*!50001 CREATE ALGORITHM=MERGE */
+/*!50013 DEFINER=` + "`root`@`localhost`" + ` SQL SECURITY INVOKER */
+/*!50001 VIEW ` + "`recent_user`" + ` AS select ` + "`active_user`.`id`" + ` AS ` + "`id`" + ` from ` + "`active_user`" + ` */;
+CREATE OR REPLACE VIEW active_user (id) AS SELECT id FROM user WHERE status = 'on' WITH LOCAL CHECK OPTION;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Tables) != 1 || schema.Tables[0].Name != "user" {
+		t.Fatalf("unexpected tables %+v", schema.Tables)
+	}
+	v := schema.Views
+	if len(v) != 2 {
+		t.Fatalf("unexpected views %+v", v)
+	}
+	if v[0].Name != "recent_user" || v[0].Algorithm != "MERGE" || v[0].Security != "INVOKER" || v[0].CheckOption != "NONE" ||
+		v[0].Definition != "select `active_user`.`id` AS `id` from `active_user`" {
+		t.Errorf("unexpected view %+v", v[0])
+	}
+	if v[1].Name != "active_user" || v[1].Algorithm != "UNDEFINED" || v[1].Security != "DEFINER" || v[1].CheckOption != "LOCAL" ||
+		v[1].Definition != "SELECT id FROM user WHERE status = 'on'" {
+		t.Errorf("unexpected view %+v", v[1])
+	}
+
+	differ := NewFromInspectors(schema, &dbdiffer.Schema{Tables: schema.Tables})
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	expects := []string{
+		"CREATE OR REPLACE ALGORITHM = UNDEFINED SQL SECURITY DEFINER VIEW `active_user` AS SELECT id FROM user WHERE status = 'on' WITH LOCAL CHECK OPTION;",
+		"CREATE OR REPLACE ALGORITHM = MERGE SQL SECURITY INVOKER VIEW `recent_user` AS select `active_user`.`id` AS `id` from `active_user`;",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expects, "\n") {
+		t.Fatalf("expect %q, got %q", expects, gen)
+	}
+
+	differ = NewFromInspectors(&dbdiffer.Schema{Tables: schema.Tables}, schema)
+	if res, err = differ.Diff(""); err != nil {
+		t.Fatal(err)
+	}
+	if statements, err = differ.Generate(res); err != nil {
+		t.Fatal(err)
+	}
+	gen = dbdiffer.Strings(statements)
+	expects = []string{
+		"DROP VIEW IF EXISTS `recent_user`;",
+		"DROP VIEW IF EXISTS `active_user`;",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expects, "\n") {
+		t.Fatalf("expect %q, got %q", expects, gen)
+	}
+}
+
+func TestDiffView(t *testing.T) {
+	file, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (id int NOT NULL, name varchar(32), status varchar(8), PRIMARY KEY (id));
+CREATE VIEW active_user AS SELECT id, name FROM user WHERE status = 'on' AND id > 10;
+CREATE VIEW ` + "`named_user`" + ` AS SELECT ` + "`app`.`user`.`name`" + ` AS ` + "`Name`" + ` FROM ` + "`app`.`user`" + ` ORDER BY name;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as read by the inspector, which drops the qualifiers of the database
+	live := &dbdiffer.Schema{
+		Tables: file.Tables,
+		Views: []dbdiffer.View{
+			{Name: "active_user", Definition: "select `user`.`id` AS `id`,`user`.`name` AS `name` from `user` where ((`user`.`status` = 'on') and (`user`.`id` > 10))", Algorithm: "UNDEFINED", Security: "DEFINER", CheckOption: "NONE"},
+			{Name: "named_user", Definition: "select `user`.`name` AS `Name` from `user` order by `user`.`name`", Algorithm: "UNDEFINED", Security: "DEFINER", CheckOption: "NONE"},
+		},
+	}
+	if res := dbdiffer.Compare(live, file); !res.Views.IsEmpty() {
+		t.Fatalf("views written differently are taken as changed %+v", res.Views)
+	}
+
+	live.Views[0].Definition = strings.Replace(live.Views[0].Definition, "> 10", "> 20", 1)
+	res := dbdiffer.Compare(live, file)
+	if len(res.Views.Change) != 1 || res.Views.Change[0].Name != "active_user" {
+		t.Fatalf("unexpected views %+v", res.Views)
+	}
+}
+
+func TestParseTrigger(t *testing.T) {
+	schema, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (id int NOT NULL, name varchar(32), updated int, PRIMARY KEY (id));
+CREATE TRIGGER user_bi BEFORE INSERT ON user FOR EACH ROW SET NEW.name = TRIM(NEW.name);
+DELIMITER ;;
+/*!50003 CREATE*/ /*!50017 DEFINER=` + "`root`@`localhost`" + `*/ /*!50003 TRIGGER ` + "`user_bu`" + ` BEFORE UPDATE ON ` + "`user`" + ` FOR EACH ROW BEGIN
+  SET NEW.name = TRIM(NEW.name);
+  SET NEW.updated = 1;
+END */;;
+DELIMITER ;
+CREATE TABLE log (id int NOT NULL);`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Tables) != 2 || schema.Tables[1].Name != "log" {
+		t.Fatalf("unexpected tables %+v", schema.Tables)
+	}
+	tr := schema.Triggers
+	if len(tr) != 2 {
+		t.Fatalf("unexpected triggers %+v", tr)
+	}
+	if tr[0].Name != "user_bi" || tr[0].Table != "user" || tr[0].Timing != "BEFORE" || tr[0].Event != "INSERT" || tr[0].Statement != "SET NEW.name = TRIM(NEW.name)" {
+		t.Errorf("unexpected trigger %+v", tr[0])
+	}
+	body := "BEGIN\n  SET NEW.name = TRIM(NEW.name);\n  SET NEW.updated = 1;\nEND"
+	if tr[1].Name != "user_bu" || tr[1].Event != "UPDATE" || tr[1].Statement != body {
+		t.Errorf("unexpected trigger %+v", tr[1])
+	}
+
+	old := &dbdiffer.Schema{Tables: schema.Tables, Triggers: []dbdiffer.Trigger{
+		{Name: "user_bi", Table: "user", Timing: "BEFORE", Event: "INSERT", Statement: "SET NEW.name = NEW.name"},
+		{Name: "user_ad", Table: "user", Timing: "AFTER", Event: "DELETE", Statement: "DELETE FROM log WHERE id = OLD.id"},
+	}}
+	differ := NewFromInspectors(schema, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	expects := []string{
+		"DROP TRIGGER IF EXISTS `user_ad`;",
+		"DROP TRIGGER IF EXISTS `user_bi`;",
+		"CREATE TRIGGER `user_bi` BEFORE INSERT ON `user` FOR EACH ROW SET NEW.name = TRIM(NEW.name);",
+		// bodies of more than one statement are left to delimit to whatever runs them
+		"CREATE TRIGGER `user_bu` BEFORE UPDATE ON `user` FOR EACH ROW " + body + ";",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expects, "\n") {
+		t.Fatalf("expect %q, got %q", expects, gen)
+	}
+}
+
+func TestParseRoutine(t *testing.T) {
+	schema, err := ParseSchema(strings.NewReader(`
+DELIMITER ;;
+CREATE DEFINER=` + "`root`@`localhost`" + ` PROCEDURE ` + "`cleanup`" + `(IN days int, OUT removed int)
+    MODIFIES SQL DATA
+    SQL SECURITY INVOKER
+    COMMENT 'remove old logs'
+BEGIN
+  DELETE FROM log WHERE created < NOW() - INTERVAL days DAY;
+  SET removed = ROW_COUNT();
+END ;;
+DELIMITER ;
+CREATE FUNCTION add_tax(price decimal(10,2)) RETURNS decimal(10,2) CHARSET utf8mb4 DETERMINISTIC NO SQL RETURN price * 1.1;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := schema.Routines
+	if len(r) != 2 {
+		t.Fatalf("unexpected routines %+v", r)
+	}
+	body := "BEGIN\n  DELETE FROM log WHERE created < NOW() - INTERVAL days DAY;\n  SET removed = ROW_COUNT();\nEND"
+	if r[0].Name != "cleanup" || r[0].Type != "PROCEDURE" || r[0].Parameters != "IN days int, OUT removed int" || r[0].DataAccess != "MODIFIES SQL DATA" ||
+		r[0].Security != "INVOKER" || r[0].Definer != "`root`@`localhost`" || r[0].Comment != "remove old logs" || r[0].Body != body {
+		t.Errorf("unexpected routine %+v", r[0])
+	}
+	if r[1].Name != "add_tax" || r[1].Type != "FUNCTION" || r[1].Returns != "decimal(10,2) CHARSET utf8mb4" || !r[1].Deterministic || r[1].DataAccess != "NO SQL" ||
+		r[1].Security != "DEFINER" || r[1].Definer != "" || r[1].Body != "RETURN price * 1.1" {
+		t.Errorf("unexpected routine %+v", r[1])
+	}
+
+	// SHOW CREATE output has no delimiter
+	parsed, err := parseroutine("CREATE DEFINER=`root`@`localhost` PROCEDURE `cleanup`(IN days int, OUT removed int)\n    MODIFIES SQL DATA\n    SQL SECURITY INVOKER\n    COMMENT 'remove old logs'\n" + body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Equal(r[0]) {
+		t.Errorf("expect %+v, got %+v", r[0], parsed)
+	}
+
+	old := &dbdiffer.Schema{Routines: []dbdiffer.Routine{r[0], r[1]}}
+	old.Routines[0].Definer = "`deploy`@`%`"
+	old.Routines[1].Body = "RETURN price * 1.2"
+	differ := NewFromInspectors(schema, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Routines.Change) != 2 {
+		t.Fatalf("expect definer to be compared, got %+v", res.Routines)
+	}
+
+	differ = NewFromInspectors(schema, old, WithDefiner(""))
+	if res, err = differ.Diff(""); err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	expects := []string{
+		"DROP FUNCTION IF EXISTS `add_tax`;",
+		"CREATE FUNCTION `add_tax`(price decimal(10,2)) RETURNS decimal(10,2) CHARSET utf8mb4 DETERMINISTIC NO SQL SQL SECURITY DEFINER RETURN price * 1.1;",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expects, "\n") {
+		t.Fatalf("expect %q, got %q", expects, gen)
+	}
+
+	differ = NewFromInspectors(schema, &dbdiffer.Schema{}, WithDefiner("`app`@`%`"))
+	if res, err = differ.Diff(""); err != nil {
+		t.Fatal(err)
+	}
+	if statements, err = differ.Generate(res); err != nil {
+		t.Fatal(err)
+	}
+	gen = dbdiffer.Strings(statements)
+	expect := "CREATE DEFINER = `app`@`%` PROCEDURE `cleanup`(IN days int, OUT removed int) COMMENT 'remove old logs' NOT DETERMINISTIC MODIFIES SQL DATA SQL SECURITY INVOKER " + body + ";"
+	if len(gen) != 2 || gen[0] != expect {
+		t.Fatalf("expect %q first, got %q", expect, gen)
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	schema, err := ParseSchema(strings.NewReader(`
+DELIMITER ;;
+/*!50106 CREATE*/ /*!50117 DEFINER=` + "`root`@`localhost`" + `*/ /*!50106 EVENT ` + "`cleanup`" + ` ON SCHEDULE EVERY 1 DAY STARTS '2024-01-01 03:00:00' ON COMPLETION PRESERVE ENABLE COMMENT 'nightly' DO BEGIN
+  DELETE FROM log WHERE created < NOW() - INTERVAL 30 DAY;
+  DELETE FROM session WHERE expired = 1;
+END */ ;;
+DELIMITER ;
+CREATE EVENT once ON SCHEDULE AT CURRENT_TIMESTAMP + INTERVAL 1 HOUR DISABLE DO DELETE FROM log;
+CREATE EVENT tick ON SCHEDULE EVERY '1:30' HOUR_MINUTE DO DELETE FROM session;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := schema.Events
+	if len(e) != 3 {
+		t.Fatalf("unexpected events %+v", e)
+	}
+	body := "BEGIN\n  DELETE FROM log WHERE created < NOW() - INTERVAL 30 DAY;\n  DELETE FROM session WHERE expired = 1;\nEND"
+	if e[0].Name != "cleanup" || e[0].Every != "1 DAY" || e[0].Starts != "'2024-01-01 03:00:00'" || e[0].OnCompletion != "PRESERVE" ||
+		e[0].Status != "ENABLED" || e[0].Comment != "nightly" || e[0].Definer != "`root`@`localhost`" || e[0].Body != body {
+		t.Errorf("unexpected event %+v", e[0])
+	}
+	if e[1].At != "CURRENT_TIMESTAMP + INTERVAL 1 HOUR" || e[1].Status != "DISABLED" || e[1].OnCompletion != "NOT PRESERVE" || e[1].Body != "DELETE FROM log" {
+		t.Errorf("unexpected event %+v", e[1])
+	}
+	if e[2].Every != "'1:30' HOUR_MINUTE" {
+		t.Errorf("unexpected event %+v", e[2])
+	}
+
+	old := &dbdiffer.Schema{Events: []dbdiffer.Event{e[0], e[1], {Name: "legacy", Every: "1 WEEK", Body: "DELETE FROM log"}}}
+	old.Events[1].Status = "ENABLED"
+	new := &dbdiffer.Schema{Events: []dbdiffer.Event{e[0], e[1], e[2]}}
+	// an event without a start matches the start it is recorded with
+	new.Events[0].Starts = ""
+	differ := NewFromInspectors(new, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	expects := []string{
+		"DROP EVENT IF EXISTS `legacy`;",
+		"ALTER EVENT `once` ON SCHEDULE AT CURRENT_TIMESTAMP + INTERVAL 1 HOUR ON COMPLETION NOT PRESERVE DISABLE COMMENT '' DO DELETE FROM log;",
+		"CREATE EVENT `tick` ON SCHEDULE EVERY '1:30' HOUR_MINUTE ON COMPLETION NOT PRESERVE ENABLE DO DELETE FROM session;",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expects, "\n") {
+		t.Fatalf("expect %q, got %q", expects, gen)
+	}
+}
+
+func TestDiffCheck(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE account (
+  id int NOT NULL,
+  balance int NOT NULL CHECK (balance >= 0),
+  age int,
+  CONSTRAINT chk_age CHECK (age > 0)
+) ENGINE=InnoDB;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := old.Tables[0].Constraints.Create
+	if len(checks) != 2 || checks[0].Name != "account_chk_1" || checks[0].Type != dbdiffer.Check || checks[0].Expression != "balance >= 0" || checks[1].Enforced != "YES" {
+		t.Fatalf("unexpected constraints %+v", checks)
+	}
+
+	// mysql reports expressions quoted and wrapped in parentheses
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE account (
+  id int NOT NULL,
+  balance int NOT NULL,
+  age int,
+  CONSTRAINT account_chk_1 CHECK ((` + "`balance`" + ` >= 0)),
+  CONSTRAINT chk_age CHECK (age > 0) NOT ENFORCED,
+  CONSTRAINT chk_id CHECK (id <> 0)
+) ENGINE=InnoDB;
+CREATE TABLE ledger (id int NOT NULL, CHECK (id > 0)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	differ := NewFromInspectors(new, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	expect := []string{
+		"ALTER TABLE `account` DROP CHECK `chk_age`;",
+		"CREATE TABLE IF NOT EXISTS `ledger` (`id` int NOT NULL , CONSTRAINT `ledger_chk_1` CHECK (id > 0)) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;",
+		"ALTER TABLE `account` ADD CONSTRAINT `chk_age` CHECK (age > 0) NOT ENFORCED;",
+		"ALTER TABLE `account` ADD CONSTRAINT `chk_id` CHECK (id <> 0);",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected statements %q", gen)
+	}
+}
+
+func TestDiffPartition(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE log (
+  id int NOT NULL,
+  created date NOT NULL,
+  PRIMARY KEY (id, created)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+/*!50100 PARTITION BY RANGE (year(` + "`created`" + `))
+(PARTITION p2020 VALUES LESS THAN (2021) ENGINE = InnoDB,
+ PARTITION p2021 VALUES LESS THAN (2022) ENGINE = InnoDB) */;
+CREATE TABLE session (id int NOT NULL, PRIMARY KEY (id)) ENGINE=InnoDB PARTITION BY HASH (id) PARTITIONS 2;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := old.Tables[0].Partitions.Create
+	if p == nil || p.Method != "RANGE" || p.Expression != "year(`created`)" || len(p.Partitions) != 2 || p.Partitions[1].Values != "LESS THAN (2022)" {
+		t.Fatalf("unexpected partitioning %+v", p)
+	}
+	if p := old.Tables[1].Partitions.Create; p == nil || len(p.Partitions) != 2 || p.Partitions[1].Name != "p1" {
+		t.Fatalf("unexpected partitioning %+v", p)
+	}
+
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE log (
+  id int NOT NULL,
+  created date NOT NULL,
+  PRIMARY KEY (id, created)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+PARTITION BY RANGE (YEAR(created)) (
+  PARTITION p2021 VALUES LESS THAN (2022),
+  PARTITION p2022 VALUES LESS THAN (2023),
+  PARTITION pmax VALUES LESS THAN MAXVALUE
+);
+CREATE TABLE session (id int NOT NULL, PRIMARY KEY (id)) ENGINE=InnoDB;
+CREATE TABLE metric (
+  id int NOT NULL,
+  region int NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+PARTITION BY LIST (region) SUBPARTITION BY KEY (id) SUBPARTITIONS 2 (
+  PARTITION east VALUES IN (1, 2) COMMENT 'east',
+  PARTITION west VALUES IN (3)
+);`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	differ := NewFromInspectors(new, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	expect := []string{
+		"CREATE TABLE IF NOT EXISTS `metric` (`id` int NOT NULL , `region` int NOT NULL ) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4 PARTITION BY LIST (region) SUBPARTITION BY KEY (id) (PARTITION `east` VALUES IN (1, 2) COMMENT 'east' (SUBPARTITION `eastsp0`, SUBPARTITION `eastsp1`), PARTITION `west` VALUES IN (3) (SUBPARTITION `westsp0`, SUBPARTITION `westsp1`));",
+		"ALTER TABLE `log` DROP PARTITION `p2020`;",
+		"ALTER TABLE `log` ADD PARTITION (PARTITION `p2022` VALUES LESS THAN (2023), PARTITION `pmax` VALUES LESS THAN MAXVALUE);",
+		"ALTER TABLE `session` REMOVE PARTITIONING;",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected statements %q", gen)
+	}
+}
+
+func TestDiffGenerated(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE item (
+  price int NOT NULL,
+  qty int NOT NULL,
+  total int GENERATED ALWAYS AS (price * qty) VIRTUAL,
+  label varchar(16) AS (concat('#', price)),
+  code int
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := old.Tables[0].Fields.Create[2]; f.Expression != "price * qty" || f.Extra != "VIRTUAL GENERATED" {
+		t.Fatalf("unexpected field %+v", f)
+	}
+
+	// mysql reports expressions quoted and wrapped in parentheses
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE item (
+  price int NOT NULL,
+  qty int NOT NULL,
+  total int AS ((` + "`price`" + ` * ` + "`qty`" + `)) VIRTUAL,
+  label varchar(16) AS (concat('#', qty)) VIRTUAL NOT NULL,
+  code int AS (price + 1) STORED,
+  tax int AS (price / 10) STORED COMMENT 'tax'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	differ := NewFromInspectors(new, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	expect := []string{
+		"ALTER TABLE `item` ADD `tax` int GENERATED ALWAYS AS (price / 10) STORED NULL  COMMENT 'tax' AFTER `code`;",
+		"ALTER TABLE `item` CHANGE `label` `label` varchar(16) CHARACTER SET utf8mb4 GENERATED ALWAYS AS (concat('#', qty)) VIRTUAL NOT NULL ;",
+		"ALTER TABLE `item` CHANGE `code` `code` int GENERATED ALWAYS AS (price + 1) STORED NULL ;",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected statements %q", gen)
+	}
+}
+
+func TestDiffIndexParts(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE post (
+  id int NOT NULL,
+  title varchar(255) NOT NULL,
+  created datetime NOT NULL,
+  price int NOT NULL,
+  qty int NOT NULL,
+  PRIMARY KEY (id),
+  KEY idx_title (title(32)),
+  KEY idx_created (created),
+  KEY idx_total ((price * qty)),
+  KEY idx_qty (qty)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := old.Tables[0].Indexes.Create[1].Parts
+	if len(parts) != 1 || parts[0].Column != "title" || parts[0].SubPart != 32 {
+		t.Fatalf("unexpected key parts %+v", parts)
+	}
+	if parts := old.Tables[0].Indexes.Create[3].Parts; len(parts) != 1 || parts[0].Column != "" || parts[0].Expression != "price * qty" {
+		t.Fatalf("unexpected key parts %+v", parts)
+	}
+
+	// mysql reports functional key parts quoted and wrapped in parentheses
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE post (
+  id int NOT NULL,
+  title varchar(255) NOT NULL,
+  created datetime NOT NULL,
+  price int NOT NULL,
+  qty int NOT NULL,
+  PRIMARY KEY (id),
+  KEY idx_title (title(64)),
+  KEY idx_created (created DESC, id),
+  KEY idx_total (((` + "`price`" + ` * ` + "`qty`" + `))),
+  KEY idx_qty (qty) INVISIBLE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE tag (
+  name varchar(255) NOT NULL,
+  KEY idx_name (name(8) DESC, (upper(name))) INVISIBLE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	differ := NewFromInspectors(new, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	expect := []string{
+		"CREATE TABLE IF NOT EXISTS `tag` (`name` varchar(255) NOT NULL , INDEX `idx_name` (`name`(8) DESC, (upper(name))) INVISIBLE) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;",
+		"ALTER TABLE `post` DROP INDEX `idx_title`;",
+		"ALTER TABLE `post` DROP INDEX `idx_created`;",
+		"ALTER TABLE `post` DROP INDEX `idx_qty`;",
+		"ALTER TABLE `post` ADD INDEX `idx_title` (`title`(64));",
+		"ALTER TABLE `post` ADD INDEX `idx_created` (`created` DESC, `id`);",
+		"ALTER TABLE `post` ADD INDEX `idx_qty` (`qty`) INVISIBLE;",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected statements %q", gen)
+	}
+}
+
+func TestDiffIndexType(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE article (id int NOT NULL, body text, PRIMARY KEY (id)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE cache (k varchar(32) NOT NULL, v int, PRIMARY KEY (k)) ENGINE=MEMORY DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index := old.Tables[1].Indexes.Create[0]; index.IndexType != "HASH" || index.Collation != "" {
+		t.Fatalf("unexpected index %+v", index)
+	}
+
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE article (
+  id int NOT NULL,
+  body text,
+  PRIMARY KEY (id),
+  FULLTEXT KEY ft_body (body) /*!50100 WITH PARSER ` + "`ngram`" + ` */
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE cache (k varchar(32) NOT NULL, v int, PRIMARY KEY (k), KEY idx_v (v) USING BTREE) ENGINE=MEMORY DEFAULT CHARSET=utf8mb4;
+CREATE TABLE place (
+  id int NOT NULL,
+  pos point NOT NULL SRID 4326,
+  code int NOT NULL,
+  PRIMARY KEY (id),
+  SPATIAL KEY idx_pos (pos),
+  KEY idx_code (code) USING HASH
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	differ := NewFromInspectors(new, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	expect := []string{
+		"CREATE TABLE IF NOT EXISTS `place` (`id` int NOT NULL , `pos` point NOT NULL , `code` int NOT NULL ,  PRIMARY KEY (`id`), SPATIAL KEY `idx_pos` (`pos`), INDEX `idx_code` (`code`)) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;",
+		"ALTER TABLE `article` ADD FULLTEXT KEY `ft_body` (`body`) WITH PARSER `ngram`;",
+		"ALTER TABLE `cache` ADD INDEX `idx_v` (`v`) USING BTREE;",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected statements %q", gen)
+	}
+}
+
+func TestDiffColumnOrder(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE t1 (a int, b int, c int, d int, e int) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE t2 (a int, b int, c int) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE t1 (b int, a int, c int, x int, e bigint, d int) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE t2 (c int, n int, a int, b int) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	differ := NewFromInspectors(new, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	// only added columns are put in place by default
+	expect := []string{
+		"ALTER TABLE `t1` ADD `x` int NULL  AFTER `c`;",
+		"ALTER TABLE `t1` CHANGE `e` `e` bigint NULL ;",
+		"ALTER TABLE `t2` ADD `n` int NULL  AFTER `c`;",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected statements %q", gen)
+	}
+
+	differ = NewFromInspectors(new, old, WithColumnOrder())
+	res, err = differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err = differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen = dbdiffer.Strings(statements)
+	expect = []string{
+		"ALTER TABLE `t1` ADD `x` int NULL  AFTER `c`;",
+		"ALTER TABLE `t1` CHANGE `b` `b` int NULL  FIRST;",
+		"ALTER TABLE `t1` CHANGE `e` `e` bigint NULL  AFTER `x`;",
+		"ALTER TABLE `t2` ADD `n` int NULL  AFTER `c`;",
+		"ALTER TABLE `t2` CHANGE `c` `c` int NULL  FIRST;",
+		"ALTER TABLE `t2` CHANGE `n` `n` int NULL  AFTER `c`;",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected statements %q", gen)
+	}
+}
+
+func TestDiffMoveAlgorithm(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (id int NOT NULL, age int, name varchar(32), note varchar(32)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (age bigint, id int NOT NULL, note varchar(32) DEFAULT '', name varchar(32)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	differ := NewFromInspectors(new, old, WithColumnOrder(), WithVersion(Version{8, 0, 29}))
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	// a column retyped while it is moved copies the table, one with a new default is only moved in place
+	expect := []string{
+		"ALTER TABLE `user` CHANGE `age` `age` bigint NULL  FIRST, ALGORITHM=COPY, LOCK=SHARED; -- rebuilds the table",
+		"ALTER TABLE `user` CHANGE `note` `note` varchar(32) CHARACTER SET utf8mb4 NULL DEFAULT ''  AFTER `id`, ALGORITHM=INPLACE, LOCK=NONE; -- rebuilds the table",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected statements %q", gen)
+	}
+}
+
+func TestDiffCombined(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (
+  id int NOT NULL,
+  name varchar(32) NOT NULL,
+  nickname varchar(32),
+  PRIMARY KEY (id),
+  KEY idx_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (
+  id int NOT NULL,
+  name varchar(64) NOT NULL,
+  email varchar(128),
+  PRIMARY KEY (id),
+  KEY idx_name (name, email)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	differ := NewFromInspectors(new, old, WithCombinedAlter())
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	// the index is dropped before the column and added again after the columns are in place
+	expect := "ALTER TABLE `user` DROP INDEX `idx_name`, DROP `nickname`, ADD `email` varchar(128) CHARACTER SET utf8mb4 NULL  AFTER `name`, CHANGE `name` `name` varchar(64) CHARACTER SET utf8mb4 NOT NULL , ADD INDEX `idx_name` (`name`, `email`);"
+	if len(gen) != 1 || gen[0] != expect {
+		t.Errorf("unexpected statements %q", gen)
+	}
+}
+
+func TestDiffOnlineSchemaChange(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE big (id int NOT NULL, name varchar(32) NOT NULL, PRIMARY KEY (id)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE small (id int NOT NULL, PRIMARY KEY (id)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.Tables[0].DataLength = 1 << 30
+	old.Tables[1].DataLength = 1 << 10
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE big (id int NOT NULL, name varchar(32) NOT NULL DEFAULT 'it''s', PRIMARY KEY (id), KEY idx_name (name)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE small (id int NOT NULL, code int, PRIMARY KEY (id)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	differ := NewFromInspectors(new, old, WithOnlineSchemaChange(OnlineSchemaChange{Tool: GhOst, Database: "app", Threshold: 1 << 20}))
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	expect := []string{
+		"gh-ost --database='app' --table='big' --alter='CHANGE `name` `name` varchar(32) CHARACTER SET utf8mb4 NOT NULL DEFAULT '\\''it\\'\\''s'\\'' , ADD INDEX `idx_name` (`name`)' --execute",
+		"ALTER TABLE `small` ADD `code` int NULL  AFTER `id`;",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected statements %q", gen)
+	}
+
+	differ = NewFromInspectors(new, old, WithOnlineSchemaChange(OnlineSchemaChange{Tool: PtOnlineSchemaChange, Threshold: 1 << 20}))
+	statements, err = differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen = dbdiffer.Strings(statements)
+	if !strings.HasPrefix(gen[0], "pt-online-schema-change --alter 'CHANGE `name`") || !strings.HasSuffix(gen[0], "' 't=big' --execute") {
+		t.Errorf("unexpected statements %q", gen)
+	}
+
+	// the tools connect to the old database of the DSN
+	config, err := mysql.ParseDSN("app:secret@tcp(db.example.com:3307)/shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		osc    OnlineSchemaChange
+		prefix string
+		suffix string
+	}{
+		{OnlineSchemaChange{Tool: GhOst, Threshold: 1 << 20}, "gh-ost --host='db.example.com' --port='3307' --user='app' --database='shop' --ask-pass --table='big' --alter='CHANGE", ""},
+		{OnlineSchemaChange{Tool: PtOnlineSchemaChange, Threshold: 1 << 20}, "pt-online-schema-change --ask-pass --alter 'CHANGE", "' 'h=db.example.com,P=3307,u=app,D=shop,t=big' --execute"},
+		{OnlineSchemaChange{Tool: PtOnlineSchemaChange, Socket: "/tmp/mysql.sock", User: "osc", Threshold: 1 << 20}, "pt-online-schema-change --ask-pass --alter 'CHANGE", "' 'S=/tmp/mysql.sock,u=osc,D=shop,t=big' --execute"},
+	} {
+		differ = NewFromInspectors(new, &inspector{config: config}, WithOnlineSchemaChange(c.osc))
+		statements, err = differ.Generate(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(statements) != 2 || !strings.HasPrefix(statements[0].SQL, c.prefix) || !strings.HasSuffix(statements[0].SQL, c.suffix) {
+			t.Errorf("unexpected statements %+v", statements)
+		}
+	}
+}
+
+func TestDiffAlgorithm(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (id int NOT NULL, code int NOT NULL, nickname varchar(32), PRIMARY KEY (id)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (id int NOT NULL, code int NOT NULL, PRIMARY KEY (code), KEY idx_id (id)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		version string
+		options []Option
+		expect  []string
+	}{
+		{"5.7.40", nil, []string{
+			"ALTER TABLE `user` DROP PRIMARY KEY, ALGORITHM=COPY, LOCK=SHARED; -- rebuilds the table",
+			"ALTER TABLE `user` DROP `nickname`, ALGORITHM=INPLACE, LOCK=NONE; -- rebuilds the table",
+			"ALTER TABLE `user` ADD PRIMARY KEY (`code`), ALGORITHM=INPLACE, LOCK=NONE; -- rebuilds the table",
+			"ALTER TABLE `user` ADD INDEX `idx_id` (`id`), ALGORITHM=INPLACE, LOCK=NONE; -- does not rebuild the table",
+		}},
+		{"8.0.29", nil, []string{
+			"ALTER TABLE `user` DROP PRIMARY KEY, ALGORITHM=COPY, LOCK=SHARED; -- rebuilds the table",
+			"ALTER TABLE `user` DROP `nickname`, ALGORITHM=INSTANT; -- does not rebuild the table",
+			"ALTER TABLE `user` ADD PRIMARY KEY (`code`), ALGORITHM=INPLACE, LOCK=NONE; -- rebuilds the table",
+			"ALTER TABLE `user` ADD INDEX `idx_id` (`id`), ALGORITHM=INPLACE, LOCK=NONE; -- does not rebuild the table",
+		}},
+		// the primary key is replaced in place when dropped and added in the same statement
+		{"8.0.29", []Option{WithCombinedAlter()}, []string{
+			"ALTER TABLE `user` DROP PRIMARY KEY, DROP `nickname`, ADD PRIMARY KEY (`code`), ADD INDEX `idx_id` (`id`), ALGORITHM=INPLACE, LOCK=NONE; -- rebuilds the table",
+		}},
+	} {
+		version, err := ParseVersion(c.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		differ := NewFromInspectors(new, old, append(c.options, WithVersion(version))...)
+		res, err := differ.Diff("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		statements, err := differ.Generate(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen := dbdiffer.Strings(statements)
+		if strings.Join(gen, "\n") != strings.Join(c.expect, "\n") {
+			t.Errorf("%s: unexpected statements %q", c.version, gen)
+		}
+	}
+
+	if _, err := ParseVersion("8.0.29-log"); err != nil {
+		t.Error(err)
+	}
+	if _, err := ParseVersion("eight"); err == nil {
+		t.Error("invalid version is parsed")
+	}
+}
+
+func TestDiffChangeAlgorithm(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (
+  id int NOT NULL,
+  name varchar(32) NOT NULL COMMENT 'name',
+  code varchar(16) NOT NULL DEFAULT '',
+  email varchar(32) NOT NULL,
+  bio varchar(16) NOT NULL,
+  age int
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (
+  id int NOT NULL,
+  name varchar(32) NOT NULL COMMENT 'full name',
+  code varchar(16) NOT NULL DEFAULT 'none',
+  email varchar(63) NOT NULL,
+  bio varchar(64) NOT NULL,
+  age bigint
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		version Version
+		expect  []string
+	}{
+		{Version{5, 6, 51}, []string{
+			"ALTER TABLE `user` CHANGE `name` `name` varchar(32) CHARACTER SET utf8mb4 NOT NULL  COMMENT 'full name', ALGORITHM=INPLACE, LOCK=NONE; -- does not rebuild the table",
+			"ALTER TABLE `user` CHANGE `code` `code` varchar(16) CHARACTER SET utf8mb4 NOT NULL DEFAULT 'none' , ALGORITHM=INPLACE, LOCK=NONE; -- does not rebuild the table",
+			"ALTER TABLE `user` CHANGE `email` `email` varchar(63) CHARACTER SET utf8mb4 NOT NULL , ALGORITHM=COPY, LOCK=SHARED; -- rebuilds the table",
+			"ALTER TABLE `user` CHANGE `bio` `bio` varchar(64) CHARACTER SET utf8mb4 NOT NULL , ALGORITHM=COPY, LOCK=SHARED; -- rebuilds the table",
+			"ALTER TABLE `user` CHANGE `age` `age` bigint NULL , ALGORITHM=COPY, LOCK=SHARED; -- rebuilds the table",
+		}},
+		// varchar(63) of utf8mb4 takes up to 252 bytes, its length still fits in one byte, varchar(64) takes two
+		{Version{5, 7, 40}, []string{
+			"ALTER TABLE `user` CHANGE `name` `name` varchar(32) CHARACTER SET utf8mb4 NOT NULL  COMMENT 'full name', ALGORITHM=INPLACE, LOCK=NONE; -- does not rebuild the table",
+			"ALTER TABLE `user` CHANGE `code` `code` varchar(16) CHARACTER SET utf8mb4 NOT NULL DEFAULT 'none' , ALGORITHM=INPLACE, LOCK=NONE; -- does not rebuild the table",
+			"ALTER TABLE `user` CHANGE `email` `email` varchar(63) CHARACTER SET utf8mb4 NOT NULL , ALGORITHM=INPLACE, LOCK=NONE; -- does not rebuild the table",
+			"ALTER TABLE `user` CHANGE `bio` `bio` varchar(64) CHARACTER SET utf8mb4 NOT NULL , ALGORITHM=COPY, LOCK=SHARED; -- rebuilds the table",
+			"ALTER TABLE `user` CHANGE `age` `age` bigint NULL , ALGORITHM=COPY, LOCK=SHARED; -- rebuilds the table",
+		}},
+		{Version{8, 0, 29}, []string{
+			"ALTER TABLE `user` CHANGE `name` `name` varchar(32) CHARACTER SET utf8mb4 NOT NULL  COMMENT 'full name', ALGORITHM=INPLACE, LOCK=NONE; -- does not rebuild the table",
+			"ALTER TABLE `user` CHANGE `code` `code` varchar(16) CHARACTER SET utf8mb4 NOT NULL DEFAULT 'none' , ALGORITHM=INSTANT; -- does not rebuild the table",
+			"ALTER TABLE `user` CHANGE `email` `email` varchar(63) CHARACTER SET utf8mb4 NOT NULL , ALGORITHM=INPLACE, LOCK=NONE; -- does not rebuild the table",
+			"ALTER TABLE `user` CHANGE `bio` `bio` varchar(64) CHARACTER SET utf8mb4 NOT NULL , ALGORITHM=COPY, LOCK=SHARED; -- rebuilds the table",
+			"ALTER TABLE `user` CHANGE `age` `age` bigint NULL , ALGORITHM=COPY, LOCK=SHARED; -- rebuilds the table",
+		}},
+	} {
+		differ := NewFromInspectors(new, old, WithVersion(c.version))
+		res, err := differ.Diff("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		statements, err := differ.Generate(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen := dbdiffer.Strings(statements)
+		if strings.Join(gen, "\n") != strings.Join(c.expect, "\n") {
+			t.Errorf("%s: unexpected statements %q", c.version, gen)
+		}
+	}
+}
+
+func TestDiffVirtualAlgorithm(t *testing.T) {
+	plain, err := ParseSchema(strings.NewReader("CREATE TABLE item (price int NOT NULL, qty int NOT NULL) ENGINE=InnoDB;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	virtual, err := ParseSchema(strings.NewReader("CREATE TABLE item (price int NOT NULL, qty int NOT NULL, total int AS (price * qty) VIRTUAL) ENGINE=InnoDB;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// virtual columns are added and dropped instantly from 8.0.12
+	for _, c := range []struct {
+		version Version
+		expect  string
+	}{
+		{Version{5, 7, 40}, "ALGORITHM=INPLACE, LOCK=NONE;"},
+		{Version{8, 0, 11}, "ALGORITHM=INPLACE, LOCK=NONE;"},
+		{Version{8, 0, 12}, "ALGORITHM=INSTANT;"},
+	} {
+		for _, differ := range []dbdiffer.Differ{
+			NewFromInspectors(virtual, plain, WithVersion(c.version)),
+			NewFromInspectors(plain, virtual, WithVersion(c.version)),
+		} {
+			res, err := differ.Diff("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			statements, err := differ.Generate(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(statements) != 1 || !strings.Contains(statements[0].SQL, c.expect) {
+				t.Errorf("%s: unexpected statements %+v", c.version, statements)
+			}
+		}
+	}
+}
+
+func TestDiffDown(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (
+  id int NOT NULL,
+  legacy varchar(16),
+  name varchar(32) NOT NULL,
+  email varchar(128),
+  PRIMARY KEY (id),
+  KEY idx_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE obsolete (id int NOT NULL, PRIMARY KEY (id)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE VIEW named_user AS SELECT id, name FROM user;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.Tables[1].Rows = 42
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (
+  id int NOT NULL,
+  email varchar(128),
+  name varchar(16) NOT NULL,
+  nickname varchar(32),
+  PRIMARY KEY (id),
+  KEY idx_name (name, email)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE VIEW named_user AS SELECT id, name, email FROM user;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	differ := NewFromInspectors(new, old, WithColumnOrder(), WithCombinedAlter())
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.GenerateDown(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	// columns are moved back, the dropped column is added again before
+	expect := []string{
+		"-- WARNING: table obsolete is created again without its rows (about 42 rows)",
+		"-- WARNING: column user.legacy is added again without its values",
+		"-- WARNING: column user.nickname is dropped along with its values",
+		"-- WARNING: column user.name is changed back from varchar(16) to varchar(32), values changed by the conversion are not restored",
+		"CREATE TABLE IF NOT EXISTS `obsolete` (`id` int NOT NULL ,  PRIMARY KEY (`id`)) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;",
+		"ALTER TABLE `user` DROP INDEX `idx_name`, DROP `nickname`, ADD `legacy` varchar(16) CHARACTER SET utf8mb4 NULL  AFTER `id`, CHANGE `email` `email` varchar(128) CHARACTER SET utf8mb4 NULL  AFTER `name`, CHANGE `name` `name` varchar(32) CHARACTER SET utf8mb4 NOT NULL , ADD INDEX `idx_name` (`name`);",
+		"CREATE OR REPLACE ALGORITHM = UNDEFINED SQL SECURITY DEFINER VIEW `named_user` AS SELECT id, name FROM user;",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected statements %q", gen)
+	}
+}
+
+func TestDiffStatements(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (id int NOT NULL, name varchar(32) NOT NULL, legacy varchar(16), PRIMARY KEY (id)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+CREATE TABLE obsolete (id int NOT NULL, PRIMARY KEY (id)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (id int NOT NULL, name varchar(32) NOT NULL, PRIMARY KEY (id), KEY idx_name (name)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	differ := NewFromInspectors(new, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []dbdiffer.Statement{
+		{SQL: "DROP TABLE IF EXISTS `obsolete`;", Table: "obsolete", Kind: dbdiffer.DropTable, Destructive: true, Description: "drop table obsolete"},
+		{SQL: "ALTER TABLE `user` DROP `legacy`;", Table: "user", Kind: dbdiffer.DropColumn, Destructive: true, RebuildsTable: true, Description: "drop column user.legacy"},
+		{SQL: "ALTER TABLE `user` ADD INDEX `idx_name` (`name`);", Table: "user", Kind: dbdiffer.AddIndex, Description: "add index user.idx_name"},
+	}
+	if len(statements) != len(expect) {
+		t.Fatalf("unexpected statements %+v", statements)
+	}
+	for i := range expect {
+		if statements[i] != expect[i] {
+			t.Errorf("expect %+v, got %+v", expect[i], statements[i])
+		}
+	}
+
+	// a combined statement is destructive when any of its changes is
+	differ = NewFromInspectors(new, old, WithCombinedAlter(), WithVersion(Version{8, 0, 29}))
+	statements, err = differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	combined := dbdiffer.Statement{
+		SQL:         "ALTER TABLE `user` DROP `legacy`, ADD INDEX `idx_name` (`name`), ALGORITHM=INPLACE, LOCK=NONE; -- does not rebuild the table",
+		Table:       "user",
+		Kind:        dbdiffer.AlterTable,
+		Destructive: true,
+		Description: "alter table user: drop column legacy, add index idx_name",
+	}
+	if len(statements) != 2 || statements[1] != combined {
+		t.Errorf("unexpected statements %+v", statements)
+	}
+}
+
+func TestDiffRenamesOrder(t *testing.T) {
+	old, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (id int NOT NULL, mail varchar(64), name varchar(32)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := ParseSchema(strings.NewReader(`
+CREATE TABLE user (id int NOT NULL, name varchar(32), contact varchar(64)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renames := dbdiffer.Renames{{Table: "user", Old: "mail", New: "contact"}}
+	differ := NewFromInspectors(new, old, WithColumnOrder(), WithRenames(renames))
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	// the renamed column keeps its values and ends up after name, as name is moved before it
+	expect := []string{
+		"ALTER TABLE `user` CHANGE `mail` `contact` varchar(64) CHARACTER SET utf8mb4 NULL ;",
+		"ALTER TABLE `user` CHANGE `name` `name` varchar(32) CHARACTER SET utf8mb4 NULL  AFTER `id`;",
+	}
+	if strings.Join(gen, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected statements %q", gen)
+	}
+}
+
+func TestDelimit(t *testing.T) {
+	for sql, expect := range map[string]string{
+		"CREATE TRIGGER t BEFORE INSERT ON user FOR EACH ROW SET NEW.note = 'a;b';":                       "CREATE TRIGGER t BEFORE INSERT ON user FOR EACH ROW SET NEW.note = 'a;b';",
+		"CREATE TRIGGER t BEFORE INSERT ON user FOR EACH ROW SET NEW.note = 'it''s \\';' /* ; */;":        "CREATE TRIGGER t BEFORE INSERT ON user FOR EACH ROW SET NEW.note = 'it''s \\';' /* ; */;",
+		"CREATE TRIGGER t BEFORE INSERT ON user FOR EACH ROW BEGIN SET NEW.a = 1; SET NEW.b = 'x;'; END;": "DELIMITER ;;\nCREATE TRIGGER t BEFORE INSERT ON user FOR EACH ROW BEGIN SET NEW.a = 1; SET NEW.b = 'x;'; END;;\nDELIMITER ;",
+	} {
+		if delimited := Delimit(dbdiffer.Statement{SQL: sql, Kind: dbdiffer.CreateTrigger}); delimited != expect {
+			t.Errorf("unexpected delimited %q of %q", delimited, sql)
+		}
+	}
+	if sql := "ALTER TABLE `user` ADD `note` varchar(8) DEFAULT ';';"; Delimit(dbdiffer.Statement{SQL: sql, Kind: dbdiffer.AddColumn}) != sql {
+		t.Errorf("unexpected delimited table statement")
+	}
+}
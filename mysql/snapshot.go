@@ -0,0 +1,16 @@
+package mysql
+
+import (
+	"github.com/sillydong/dbdiffer"
+)
+
+// Snapshot takes a snapshot of tables with the given prefix, see dbdiffer.TakeSnapshot.
+// The DSN accepts the same values as New.
+func Snapshot(dsn, prefix string) (*dbdiffer.Snapshot, error) {
+	inspector, err := Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer dbdiffer.CloseInspectors(inspector)
+	return dbdiffer.TakeSnapshot(inspector, MySQL, prefix)
+}
@@ -0,0 +1,33 @@
+package mysql
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	s, err := Snapshot(FilePrefix+"testdata/new.sql", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Tables) != 2 || len(s.Tables[0].Fields.Create) != 3 || len(s.Tables[0].Indexes.Create) != 2 {
+		t.Fatalf("unexpected snapshot %+v", s)
+	}
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	differ, err := New(FilePrefix+path, FilePrefix+"testdata/new.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer differ.Close()
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsEmpty() {
+		t.Fatalf("snapshot differs from its source: %+v", res)
+	}
+}
@@ -0,0 +1,161 @@
+package dbdiffer
+
+// Plan is the order in which the tables of a result are dropped and created,
+// so that statements never refer to tables that do not exist yet or are gone already
+type Plan struct {
+	// Drop holds the dropped tables, tables referencing others come first
+	Drop []Table
+	// DropConstraints holds the foreign keys to drop before the tables,
+	// they reference a table of a cycle that is dropped earlier
+	DropConstraints []Constraint
+	// Create holds the created tables, referenced tables come first.
+	// Their Constraints.Create only holds foreign keys that can be declared along with the table.
+	Create []Table
+	// AddConstraints holds the foreign keys of created tables to add after all tables are created and changed,
+	// they reference a table of a cycle that is created later or a changed table
+	AddConstraints []Constraint
+	// DropViews holds the dropped views, views selecting from others come first
+	DropViews []View
+	// CreateViews holds the created and changed views, views selected from come first
+	CreateViews []View
+}
+
+// NewPlan orders the dropped and created tables of a result by their foreign keys
+func NewPlan(result *Result) *Plan {
+	plan := &Plan{
+		Drop:            []Table{},
+		DropConstraints: []Constraint{},
+		Create:          []Table{},
+		AddConstraints:  []Constraint{},
+		DropViews:       []View{},
+		CreateViews:     []View{},
+	}
+
+	changed := make(map[string]bool, len(result.Change))
+	for _, table := range result.Change {
+		changed[table.Name] = true
+	}
+
+	// tables are dropped in the reverse order they would be created in
+	drop := sorttables(result.Drop)
+	droppos := make(map[string]int, len(drop))
+	for i := len(drop) - 1; i >= 0; i-- {
+		droppos[drop[i].Name] = len(plan.Drop)
+		plan.Drop = append(plan.Drop, drop[i])
+	}
+	for _, table := range plan.Drop {
+		for _, constraint := range table.Constraints.Create {
+			if pos, exist := droppos[constraint.RefTable]; exist && pos < droppos[table.Name] {
+				plan.DropConstraints = append(plan.DropConstraints, constraint)
+			}
+		}
+	}
+
+	create := sorttables(result.Create)
+	createpos := make(map[string]int, len(create))
+	for pos, table := range create {
+		createpos[table.Name] = pos
+	}
+	for _, table := range create {
+		inline := make([]Constraint, 0, len(table.Constraints.Create))
+		for _, constraint := range table.Constraints.Create {
+			pos, created := createpos[constraint.RefTable]
+			if (created && pos <= createpos[table.Name]) || (!created && !changed[constraint.RefTable]) {
+				inline = append(inline, constraint)
+			} else {
+				plan.AddConstraints = append(plan.AddConstraints, constraint)
+			}
+		}
+		table.Constraints.Create = inline
+		plan.Create = append(plan.Create, table)
+	}
+
+	dropviews := sortviews(result.Views.Drop)
+	for i := len(dropviews) - 1; i >= 0; i-- {
+		plan.DropViews = append(plan.DropViews, dropviews[i])
+	}
+	createviews := make([]View, 0, len(result.Views.Create)+len(result.Views.Change))
+	createviews = append(createviews, result.Views.Create...)
+	createviews = append(createviews, result.Views.Change...)
+	plan.CreateViews = sortviews(createviews)
+	return plan
+}
+
+// sortviews orders views so that views selected from come before the views selecting from them
+func sortviews(views []View) []View {
+	graph := NewGraph()
+	viewpos := make(map[string]int, len(views))
+	for pos, view := range views {
+		graph.AddNode(view.Name)
+		viewpos[view.Name] = pos
+	}
+	for _, view := range views {
+		for _, name := range identifiers(view.Definition) {
+			if _, exist := viewpos[name]; exist {
+				graph.AddEdge(view.Name, name)
+			}
+		}
+	}
+	sorted := make([]View, 0, len(views))
+	for _, name := range graph.Sort() {
+		sorted = append(sorted, views[viewpos[name]])
+	}
+	return sorted
+}
+
+// identifiers lists the words and quoted identifiers of a statement, string literals are skipped
+func identifiers(s string) []string {
+	words := []string{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := i + 1
+			for end < len(s) && s[end] != c {
+				if s[end] == '\\' && c != '`' {
+					end++
+				}
+				end++
+			}
+			if end > len(s) {
+				end = len(s)
+			}
+			if c == '`' {
+				words = append(words, s[i+1:end])
+			}
+			i = end
+		case isword(c):
+			end := i
+			for end < len(s) && isword(s[end]) {
+				end++
+			}
+			words = append(words, s[i:end])
+			i = end - 1
+		}
+	}
+	return words
+}
+
+func isword(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// sorttables orders tables so that referenced tables come before the tables referencing them
+func sorttables(tables []Table) []Table {
+	graph := NewGraph()
+	tablepos := make(map[string]int, len(tables))
+	for pos, table := range tables {
+		graph.AddNode(table.Name)
+		tablepos[table.Name] = pos
+	}
+	for _, table := range tables {
+		for _, constraint := range table.Constraints.Create {
+			graph.AddEdge(table.Name, constraint.RefTable)
+		}
+	}
+	sorted := make([]Table, 0, len(tables))
+	for _, name := range graph.Sort() {
+		sorted = append(sorted, tables[tablepos[name]])
+	}
+	return sorted
+}
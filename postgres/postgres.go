@@ -0,0 +1,727 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/sillydong/dbdiffer"
+)
+
+const Postgres string = "postgres"
+
+func init() {
+	dbdiffer.DriverList = append(dbdiffer.DriverList, Postgres)
+}
+
+type Driver struct {
+	new dbdiffer.Inspector
+	old dbdiffer.Inspector
+}
+
+// New creates a new Driver driver.
+// The DSN is documented here: https://pkg.go.dev/github.com/lib/pq#hdr-Connection_String_Parameters
+// Either DSN can also be a snapshot prefixed with file://
+func New(newDsn, oldDsn string) (dbdiffer.Differ, error) {
+	newInspector, oldInspector, err := dbdiffer.OpenInspectors(Open, newDsn, oldDsn)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromInspectors(newInspector, oldInspector), nil
+}
+
+// Open returns an inspector of the DSN, which accepts the same values as New
+func Open(dsn string) (dbdiffer.Inspector, error) {
+	if strings.HasPrefix(dsn, dbdiffer.FilePrefix) {
+		return dbdiffer.LoadDriverSnapshot(strings.TrimPrefix(dsn, dbdiffer.FilePrefix), Postgres)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	return &inspector{db: db}, nil
+}
+
+// NewFromDB returns a postgres driver from a sql.DB
+func NewFromDB(newDb, oldDb *sql.DB) (dbdiffer.Differ, error) {
+	if _, ok := newDb.Driver().(*pq.Driver); !ok {
+		return nil, errors.New("new database instance is not using the PostgreSQL driver")
+	}
+	if _, ok := oldDb.Driver().(*pq.Driver); !ok {
+		return nil, errors.New("old database instance is not using the PostgreSQL driver")
+	}
+
+	if err := newDb.Ping(); err != nil {
+		return nil, err
+	}
+
+	if err := oldDb.Ping(); err != nil {
+		return nil, err
+	}
+
+	return NewFromInspectors(NewInspector(newDb), NewInspector(oldDb)), nil
+}
+
+// NewFromInspectors returns a postgres driver comparing structures from any inspectors,
+// inspectors implementing io.Closer are closed with the driver.
+func NewFromInspectors(newInspector, oldInspector dbdiffer.Inspector) dbdiffer.Differ {
+	return &Driver{
+		new: newInspector,
+		old: oldInspector,
+	}
+}
+
+// Close closes the connection to the Driver server.
+func (d *Driver) Close() error {
+	return dbdiffer.CloseInspectors(d.new, d.old)
+}
+
+func (d *Driver) Diff(prefix string) (diff *dbdiffer.Result, err error) {
+	//retrive new database structure
+	newschema, err := d.new.Inspect(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	//retrive old database structure
+	oldschema, err := d.old.Inspect(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return dbdiffer.Compare(oldschema, newschema), nil
+}
+
+// Snapshot takes a snapshot of tables with the given prefix, see dbdiffer.TakeSnapshot.
+// The DSN accepts the same values as New.
+func Snapshot(dsn, prefix string) (*dbdiffer.Snapshot, error) {
+	inspector, err := Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer dbdiffer.CloseInspectors(inspector)
+	return dbdiffer.TakeSnapshot(inspector, Postgres, prefix)
+}
+
+func (d *Driver) Generate(result *dbdiffer.Result) ([]dbdiffer.Statement, error) {
+	statements := make([]dbdiffer.Statement, 0)
+	if result.IsEmpty() {
+		return statements, nil
+	}
+	for _, rename := range result.Rename {
+		statements = append(statements, dbdiffer.NewStatement("ALTER TABLE "+quote(rename.Old.Name)+" RENAME TO "+quote(rename.New.Name)+";", dbdiffer.RenameTable, rename.New.Name, rename.Old.Name+" to "+rename.New.Name))
+	}
+	plan := dbdiffer.NewPlan(result)
+	// constraints are dropped first, so that tables and columns they rely on can be dropped
+	for _, table := range result.Change {
+		for _, constraint := range table.Constraints.Drop {
+			statements = append(statements, dbdiffer.NewStatement("ALTER TABLE "+quote(constraint.Table)+" DROP CONSTRAINT IF EXISTS "+quote(constraint.Name)+";", dbdiffer.DropConstraint, constraint.Table, constraint.Table+"."+constraint.Name))
+		}
+	}
+	for _, constraint := range plan.DropConstraints {
+		statements = append(statements, dbdiffer.NewStatement("ALTER TABLE "+quote(constraint.Table)+" DROP CONSTRAINT IF EXISTS "+quote(constraint.Name)+";", dbdiffer.DropConstraint, constraint.Table, constraint.Table+"."+constraint.Name))
+	}
+	if len(plan.Drop) > 0 {
+		for _, table := range plan.Drop {
+			statement := dbdiffer.NewStatement("DROP TABLE IF EXISTS "+quote(table.Name)+";", dbdiffer.DropTable, table.Name, table.Name)
+			statement.Destructive = true
+			statements = append(statements, statement)
+		}
+	}
+	if len(plan.Create) > 0 {
+		for _, table := range plan.Create {
+			sql := "CREATE TABLE IF NOT EXISTS " + quote(table.Name) + " ("
+			fieldstr := make([]string, 0)
+			for _, field := range table.Fields.Create {
+				fieldstr = append(fieldstr, quote(field.Field)+" "+sqltype(field.Type, field.Default)+sqlcol(field.Collation)+sqlextra(field.Extra)+sqlnull(field.Null)+sqldefault(field.Type, field.Default))
+			}
+			for _, index := range table.Indexes.Create {
+				if index.KeyName == "PRIMARY" {
+					fieldstr = append(fieldstr, sqlconstraint(index.Comment)+"PRIMARY KEY ("+sqlcolumns(index.ColumnName)+")")
+				} else if index.NonUnique == 0 && index.Comment != "" {
+					fieldstr = append(fieldstr, sqlconstraint(index.Comment)+"UNIQUE ("+sqlcolumns(index.ColumnName)+")")
+				}
+			}
+			for _, constraint := range table.Constraints.Create {
+				fieldstr = append(fieldstr, sqltableconstraint(constraint))
+			}
+			sql += strings.Join(fieldstr, ", ") + ")" + sqloptions(table.Options) + ";"
+			statements = append(statements, dbdiffer.NewStatement(sql, dbdiffer.CreateTable, table.Name, table.Name))
+
+			for _, index := range table.Indexes.Create {
+				if index.KeyName != "PRIMARY" && index.Comment == "" {
+					statements = append(statements, dbdiffer.NewStatement(createindex(index), dbdiffer.AddIndex, table.Name, table.Name+"."+index.KeyName))
+				}
+				if index.IndexComment != "" {
+					statements = append(statements, dbdiffer.NewStatement("COMMENT ON INDEX "+quote(indexname(index))+" IS "+literal(index.IndexComment)+";", dbdiffer.AddIndex, table.Name, table.Name+"."+index.KeyName))
+				}
+			}
+			if table.Comment != "" {
+				statements = append(statements, dbdiffer.NewStatement("COMMENT ON TABLE "+quote(table.Name)+" IS "+literal(table.Comment)+";", dbdiffer.CreateTable, table.Name, table.Name))
+			}
+			for _, field := range table.Fields.Create {
+				if field.Comment != "" {
+					statements = append(statements, dbdiffer.NewStatement("COMMENT ON COLUMN "+quote(table.Name)+"."+quote(field.Field)+" IS "+literal(field.Comment)+";", dbdiffer.CreateTable, table.Name, table.Name))
+				}
+			}
+		}
+	}
+	if len(result.Change) > 0 {
+		for _, table := range result.Change {
+			if table.OptionsChanged || table.Options != "" || table.Comment != "" {
+				// table structure has changed, options that are not set any more are reset
+				old := dbdiffer.Table{}
+				if table.Old != nil {
+					old = *table.Old
+				}
+				set, reset := changedoptions(old.Options, table.Options)
+				if len(set) > 0 {
+					statements = append(statements, dbdiffer.NewStatement("ALTER TABLE "+quote(table.Name)+" SET ("+strings.Join(set, ", ")+");", dbdiffer.AlterTable, table.Name, table.Name))
+				}
+				if len(reset) > 0 {
+					statements = append(statements, dbdiffer.NewStatement("ALTER TABLE "+quote(table.Name)+" RESET ("+strings.Join(reset, ", ")+");", dbdiffer.AlterTable, table.Name, table.Name))
+				}
+				if table.Old == nil || old.Comment != table.Comment {
+					statements = append(statements, dbdiffer.NewStatement("COMMENT ON TABLE "+quote(table.Name)+" IS "+comment(table.Comment)+";", dbdiffer.AlterTable, table.Name, table.Name))
+				}
+			}
+			if len(table.Indexes.Drop) > 0 {
+				for _, index := range table.Indexes.Drop {
+					if index.Comment != "" {
+						statements = append(statements, dbdiffer.NewStatement("ALTER TABLE "+quote(index.Table)+" DROP CONSTRAINT IF EXISTS "+quote(index.Comment)+";", dbdiffer.DropIndex, table.Name, table.Name+"."+index.KeyName))
+					} else {
+						statements = append(statements, dbdiffer.NewStatement("DROP INDEX IF EXISTS "+quote(index.KeyName)+";", dbdiffer.DropIndex, table.Name, table.Name+"."+index.KeyName))
+					}
+				}
+			}
+			if len(table.Fields.Drop) > 0 {
+				for _, field := range table.Fields.Drop {
+					statement := dbdiffer.NewStatement("ALTER TABLE "+quote(table.Name)+" DROP COLUMN IF EXISTS "+quote(field.Field)+";", dbdiffer.DropColumn, table.Name, table.Name+"."+field.Field)
+					statement.Destructive = true
+					statements = append(statements, statement)
+				}
+			}
+			for _, rename := range table.Fields.Rename {
+				statements = append(statements, dbdiffer.NewStatement("ALTER TABLE "+quote(table.Name)+" RENAME COLUMN "+quote(rename.Old.Field)+" TO "+quote(rename.New.Field)+";", dbdiffer.RenameColumn, table.Name, table.Name+"."+rename.Old.Field+" to "+rename.New.Field))
+				old := rename.Old
+				old.Field = rename.New.Field
+				statements = append(statements, changecolumn(table.Name, old, rename.New)...)
+			}
+			if len(table.Fields.Add) > 0 {
+				for _, field := range table.Fields.Add {
+					statements = append(statements, dbdiffer.NewStatement("ALTER TABLE "+quote(table.Name)+" ADD COLUMN "+quote(field.Field)+" "+sqltype(field.Type, field.Default)+sqlcol(field.Collation)+sqlextra(field.Extra)+sqlnull(field.Null)+sqldefault(field.Type, field.Default)+";", dbdiffer.AddColumn, table.Name, table.Name+"."+field.Field))
+					if field.Comment != "" {
+						statements = append(statements, dbdiffer.NewStatement("COMMENT ON COLUMN "+quote(table.Name)+"."+quote(field.Field)+" IS "+literal(field.Comment)+";", dbdiffer.AddColumn, table.Name, table.Name+"."+field.Field))
+					}
+				}
+			}
+			if len(table.Fields.Change) > 0 {
+				for _, change := range table.Fields.Change {
+					statements = append(statements, changecolumn(table.Name, change.Old, change.New)...)
+				}
+			}
+			if len(table.Indexes.Add) > 0 {
+				for _, index := range table.Indexes.Add {
+					if index.KeyName == "PRIMARY" {
+						statements = append(statements, dbdiffer.NewStatement("ALTER TABLE "+quote(index.Table)+" ADD "+sqlconstraint(index.Comment)+"PRIMARY KEY ("+sqlcolumns(index.ColumnName)+");", dbdiffer.AddIndex, table.Name, table.Name+"."+index.KeyName))
+					} else if index.NonUnique == 0 && index.Comment != "" {
+						statements = append(statements, dbdiffer.NewStatement("ALTER TABLE "+quote(index.Table)+" ADD "+sqlconstraint(index.Comment)+"UNIQUE ("+sqlcolumns(index.ColumnName)+");", dbdiffer.AddIndex, table.Name, table.Name+"."+index.KeyName))
+					} else {
+						statements = append(statements, dbdiffer.NewStatement(createindex(index), dbdiffer.AddIndex, table.Name, table.Name+"."+index.KeyName))
+					}
+					if index.IndexComment != "" {
+						statements = append(statements, dbdiffer.NewStatement("COMMENT ON INDEX "+quote(indexname(index))+" IS "+literal(index.IndexComment)+";", dbdiffer.AddIndex, table.Name, table.Name+"."+index.KeyName))
+					}
+				}
+			}
+		}
+	}
+	// constraints are added last, when referenced tables and columns exist
+	for _, table := range result.Change {
+		for _, constraint := range table.Constraints.Add {
+			statements = append(statements, dbdiffer.NewStatement("ALTER TABLE "+quote(constraint.Table)+" ADD "+sqltableconstraint(constraint)+";", dbdiffer.AddConstraint, constraint.Table, constraint.Table+"."+constraint.Name))
+		}
+	}
+	for _, constraint := range plan.AddConstraints {
+		statements = append(statements, dbdiffer.NewStatement("ALTER TABLE "+quote(constraint.Table)+" ADD "+sqltableconstraint(constraint)+";", dbdiffer.AddConstraint, constraint.Table, constraint.Table+"."+constraint.Name))
+	}
+
+	return statements, nil
+}
+
+// GenerateDown returns the statements undoing the result, see dbdiffer.GenerateDown
+func (d *Driver) GenerateDown(result *dbdiffer.Result) ([]dbdiffer.Statement, error) {
+	return dbdiffer.GenerateDown(d, result)
+}
+
+// inspector reads the structure from a live database
+type inspector struct {
+	db *sql.DB
+}
+
+// NewInspector returns an inspector reading the structure from the database
+func NewInspector(db *sql.DB) dbdiffer.Inspector {
+	return &inspector{db: db}
+}
+
+func (i *inspector) Close() error {
+	return i.db.Close()
+}
+
+func (i *inspector) Inspect(prefix string) (*dbdiffer.Schema, error) {
+	tables, _, err := tables(i.db, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for pos, table := range tables {
+		tables[pos].Fields.Create, _, err = fields(i.db, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		tables[pos].Indexes.Create, _, err = indexes(i.db, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		tables[pos].Constraints.Create, _, err = constraints(i.db, table.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &dbdiffer.Schema{Tables: tables}, nil
+}
+
+func tables(db *sql.DB, prefix string) ([]dbdiffer.Table, map[string]int, error) {
+	// reltuples is the estimate of the last VACUUM or ANALYZE, -1 or 0 before the first one
+	resultrows, err := db.Query(`SELECT c.relname, COALESCE(array_to_string(c.reloptions, ', '), ''), COALESCE(obj_description(c.oid, 'pg_class'), ''),
+	GREATEST(c.reltuples, 0)::bigint
+FROM pg_catalog.pg_class c
+JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname = current_schema() AND c.relkind IN ('r', 'p') AND c.relname LIKE $1
+ORDER BY c.relname;`, prefix+"%")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultrows.Close()
+	tablespos := make(map[string]int)
+	tables := make([]dbdiffer.Table, 0)
+	for resultrows.Next() {
+		var (
+			name    string
+			options string
+			comment string
+			rows    int64
+		)
+		if err := resultrows.Scan(&name, &options, &comment, &rows); err != nil {
+			return nil, nil, err
+		}
+		tables = append(tables, dbdiffer.Table{
+			Name:    name,
+			Options: options,
+			Comment: comment,
+			Rows:    rows,
+		})
+		tablespos[name] = len(tables) - 1
+	}
+	return tables, tablespos, resultrows.Err()
+}
+
+func fields(db *sql.DB, table string) ([]dbdiffer.Field, map[string]int, error) {
+	resultrows, err := db.Query(`SELECT a.attname, pg_catalog.format_type(a.atttypid, a.atttypmod),
+	CASE WHEN a.attcollation <> t.typcollation THEN co.collname END,
+	a.attnotnull, pg_catalog.pg_get_expr(d.adbin, d.adrelid), a.attidentity::text,
+	COALESCE(pg_catalog.col_description(a.attrelid, a.attnum), '')
+FROM pg_catalog.pg_attribute a
+JOIN pg_catalog.pg_class c ON c.oid = a.attrelid
+JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+JOIN pg_catalog.pg_type t ON t.oid = a.atttypid
+LEFT JOIN pg_catalog.pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+LEFT JOIN pg_catalog.pg_collation co ON co.oid = a.attcollation
+WHERE n.nspname = current_schema() AND c.relname = $1 AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum;`, table)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultrows.Close()
+	fieldspos := make(map[string]int)
+	fields := make([]dbdiffer.Field, 0)
+	lastfield := ""
+	for resultrows.Next() {
+		var (
+			field     string
+			typ       string
+			collation *string
+			notnull   bool
+			def       *string
+			identity  string
+			comment   string
+		)
+		if err := resultrows.Scan(&field, &typ, &collation, &notnull, &def, &identity, &comment); err != nil {
+			return nil, nil, err
+		}
+		null := "YES"
+		if notnull {
+			null = "NO"
+		}
+		extra := ""
+		switch identity {
+		case "a":
+			extra = "GENERATED ALWAYS AS IDENTITY"
+		case "d":
+			extra = "GENERATED BY DEFAULT AS IDENTITY"
+		}
+		fields = append(fields, dbdiffer.Field{
+			Field:     field,
+			Type:      typ,
+			Collation: collation,
+			Null:      null,
+			Default:   def,
+			Extra:     extra,
+			Comment:   comment,
+			After:     lastfield,
+		})
+		fieldspos[field] = len(fields) - 1
+		lastfield = field
+	}
+	return fields, fieldspos, resultrows.Err()
+}
+
+func indexes(db *sql.DB, table string) ([]dbdiffer.Index, map[string]int, error) {
+	resultrows, err := db.Query(`SELECT i.relname, ix.indisunique, ix.indisprimary, am.amname,
+	ARRAY(SELECT pg_catalog.pg_get_indexdef(ix.indexrelid, k, true) FROM generate_series(1, ix.indnatts) AS k ORDER BY k),
+	COALESCE(con.conname, ''), COALESCE(obj_description(i.oid, 'pg_class'), '')
+FROM pg_catalog.pg_index ix
+JOIN pg_catalog.pg_class c ON c.oid = ix.indrelid
+JOIN pg_catalog.pg_class i ON i.oid = ix.indexrelid
+JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+JOIN pg_catalog.pg_am am ON am.oid = i.relam
+LEFT JOIN pg_catalog.pg_constraint con ON con.conindid = ix.indexrelid AND con.contype IN ('p', 'u')
+WHERE n.nspname = current_schema() AND c.relname = $1
+ORDER BY ix.indisprimary DESC, i.relname;`, table)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultrows.Close()
+	indexes := make([]dbdiffer.Index, 0)
+	indexpos := make(map[string]int)
+	for resultrows.Next() {
+		var (
+			key_name      string
+			unique        bool
+			primary       bool
+			index_type    string
+			column_name   []string
+			constraint    string
+			index_comment string
+		)
+		if err := resultrows.Scan(&key_name, &unique, &primary, &index_type, pq.Array(&column_name), &constraint, &index_comment); err != nil {
+			return nil, nil, err
+		}
+		non_unique := 1
+		if unique {
+			non_unique = 0
+		}
+		if primary {
+			// keep the constraint name in Comment, the index is known as PRIMARY like other drivers
+			key_name = "PRIMARY"
+		}
+		indexes = append(indexes, dbdiffer.Index{
+			Table:        table,
+			NonUnique:    non_unique,
+			KeyName:      key_name,
+			ColumnName:   column_name,
+			IndexType:    index_type,
+			Comment:      constraint,
+			IndexComment: index_comment,
+		})
+		indexpos[key_name] = len(indexes) - 1
+	}
+	return indexes, indexpos, resultrows.Err()
+}
+
+// constraints reads foreign keys and check constraints, primary keys and unique constraints are read as indexes
+func constraints(db *sql.DB, table string) ([]dbdiffer.Constraint, map[string]int, error) {
+	resultrows, err := db.Query(`SELECT con.conname, con.contype::text,
+	ARRAY(SELECT a.attname FROM unnest(con.conkey) WITH ORDINALITY AS k(attnum, pos) JOIN pg_catalog.pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum ORDER BY k.pos),
+	COALESCE(r.relname, ''),
+	ARRAY(SELECT a.attname FROM unnest(con.confkey) WITH ORDINALITY AS k(attnum, pos) JOIN pg_catalog.pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.attnum ORDER BY k.pos),
+	con.confupdtype::text, con.confdeltype::text, COALESCE(pg_catalog.pg_get_expr(con.conbin, con.conrelid), '')
+FROM pg_catalog.pg_constraint con
+JOIN pg_catalog.pg_class c ON c.oid = con.conrelid
+JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+LEFT JOIN pg_catalog.pg_class r ON r.oid = con.confrelid
+WHERE n.nspname = current_schema() AND c.relname = $1 AND con.contype IN ('f', 'c')
+ORDER BY con.conname;`, table)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultrows.Close()
+	constraints := make([]dbdiffer.Constraint, 0)
+	constraintpos := make(map[string]int)
+	for resultrows.Next() {
+		var (
+			constraint_name  string
+			constraint_type  string
+			column_name      []string
+			referenced_table string
+			referenced_name  []string
+			update_rule      string
+			delete_rule      string
+			check_clause     string
+		)
+		if err := resultrows.Scan(&constraint_name, &constraint_type, pq.Array(&column_name), &referenced_table, pq.Array(&referenced_name), &update_rule, &delete_rule, &check_clause); err != nil {
+			return nil, nil, err
+		}
+		constraint := dbdiffer.Constraint{
+			Name:  constraint_name,
+			Table: table,
+		}
+		if constraint_type == "c" {
+			constraint.Type = dbdiffer.Check
+			constraint.Expression = check_clause
+		} else {
+			constraint.Type = dbdiffer.ForeignKey
+			constraint.Columns = column_name
+			constraint.RefTable = referenced_table
+			constraint.RefColumns = referenced_name
+			constraint.OnUpdate = referentialactions[update_rule]
+			constraint.OnDelete = referentialactions[delete_rule]
+		}
+		constraints = append(constraints, constraint)
+		constraintpos[constraint_name] = len(constraints) - 1
+	}
+	return constraints, constraintpos, resultrows.Err()
+}
+
+// referentialactions maps the actions of pg_constraint to their sql
+var referentialactions = map[string]string{
+	"a": "NO ACTION",
+	"r": "RESTRICT",
+	"c": "CASCADE",
+	"n": "SET NULL",
+	"d": "SET DEFAULT",
+}
+
+func createindex(index dbdiffer.Index) string {
+	sql := "CREATE "
+	if index.NonUnique == 0 {
+		sql += "UNIQUE "
+	}
+	sql += "INDEX IF NOT EXISTS " + quote(index.KeyName) + " ON " + quote(index.Table)
+	if index.IndexType != "" && index.IndexType != "btree" {
+		sql += " USING " + index.IndexType
+	}
+	return sql + " (" + sqlcolumns(index.ColumnName) + ");"
+}
+
+// changecolumn returns the statements changing the column from old to new, leaving what is the same as it is
+func changecolumn(table string, old, new dbdiffer.Field) []dbdiffer.Statement {
+	statements := make([]dbdiffer.Statement, 0, 2)
+	if actions := altercolumn(old, new); len(actions) > 0 {
+		statement := dbdiffer.NewStatement("ALTER TABLE "+quote(table)+" "+strings.Join(actions, ", ")+";", dbdiffer.ChangeColumn, table, table+"."+new.Field)
+		// changing the type rewrites the table, unless the types are binary compatible
+		statement.RebuildsTable = old.Type != new.Type
+		statement.Destructive = dbdiffer.LossyChange(old, new) != ""
+		statements = append(statements, statement)
+	}
+	if old.Comment != new.Comment {
+		statements = append(statements, dbdiffer.NewStatement("COMMENT ON COLUMN "+quote(table)+"."+quote(new.Field)+" IS "+comment(new.Comment)+";", dbdiffer.ChangeColumn, table, table+"."+new.Field))
+	}
+	return statements
+}
+
+// altercolumn returns the ALTER COLUMN actions of what differs between old and new
+func altercolumn(old, new dbdiffer.Field) []string {
+	column := "ALTER COLUMN " + quote(new.Field)
+	actions := make([]string, 0, 3)
+	if old.Type != new.Type || (old.Collation == nil) != (new.Collation == nil) || (old.Collation != nil && new.Collation != nil && *old.Collation != *new.Collation) {
+		actions = append(actions, column+" TYPE "+new.Type+sqlcol(new.Collation)+" USING "+quote(new.Field)+"::"+new.Type)
+	}
+	if old.Null != new.Null {
+		if new.Null == "NO" {
+			actions = append(actions, column+" SET NOT NULL")
+		} else {
+			actions = append(actions, column+" DROP NOT NULL")
+		}
+	}
+	if (old.Default == nil) != (new.Default == nil) || (old.Default != nil && new.Default != nil && *old.Default != *new.Default) {
+		if new.Default != nil {
+			actions = append(actions, column+" SET DEFAULT "+*new.Default)
+		} else {
+			actions = append(actions, column+" DROP DEFAULT")
+		}
+	}
+	return actions
+}
+
+// changedoptions returns the storage parameters to set, and the names of the ones to reset
+func changedoptions(old, new string) ([]string, []string) {
+	oldoptions := make(map[string]string)
+	for _, option := range splitoptions(old) {
+		oldoptions[optionname(option)] = option
+	}
+	set := make([]string, 0)
+	newoptions := make(map[string]bool)
+	for _, option := range splitoptions(new) {
+		newoptions[optionname(option)] = true
+		if oldoptions[optionname(option)] != option {
+			set = append(set, option)
+		}
+	}
+	reset := make([]string, 0)
+	for _, option := range splitoptions(old) {
+		if !newoptions[optionname(option)] {
+			reset = append(reset, optionname(option))
+		}
+	}
+	return set, reset
+}
+
+// splitoptions splits reloptions, which are read as name=value separated by commas
+func splitoptions(s string) []string {
+	options := make([]string, 0)
+	for _, option := range strings.Split(s, ",") {
+		if option = strings.TrimSpace(option); option != "" {
+			options = append(options, option)
+		}
+	}
+	return options
+}
+
+func optionname(option string) string {
+	return strings.TrimSpace(strings.SplitN(option, "=", 2)[0])
+}
+
+// comment returns the literal of a comment, an empty one drops it
+func comment(s string) string {
+	if s == "" {
+		return "NULL"
+	}
+	return literal(s)
+}
+
+// indexname returns the name of the relation backing an index
+func indexname(index dbdiffer.Index) string {
+	if index.Comment != "" {
+		return index.Comment
+	}
+	return index.KeyName
+}
+
+// sqltype turns integer columns backed by a sequence into serial types, so the sequence is created with the table
+func sqltype(typ string, def *string) string {
+	if !isserial(def) {
+		return typ
+	}
+	switch typ {
+	case "smallint":
+		return "smallserial"
+	case "integer":
+		return "serial"
+	case "bigint":
+		return "bigserial"
+	default:
+		return typ
+	}
+}
+
+func isserial(def *string) bool {
+	return def != nil && strings.HasPrefix(*def, "nextval(")
+}
+
+func sqlnull(s string) string {
+	switch s {
+	case "NO":
+		return " NOT NULL"
+	default:
+		return ""
+	}
+}
+
+func sqldefault(typ string, s *string) string {
+	if s == nil || sqltype(typ, s) != typ {
+		return ""
+	}
+	return " DEFAULT " + *s
+}
+
+func sqlextra(s string) string {
+	if s == "" {
+		return ""
+	}
+	return " " + s
+}
+
+func sqlcol(s *string) string {
+	switch s {
+	case nil:
+		return ""
+	default:
+		return " COLLATE " + quote(*s)
+	}
+}
+
+func sqlconstraint(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "CONSTRAINT " + quote(s) + " "
+}
+
+func sqltableconstraint(c dbdiffer.Constraint) string {
+	if c.Type == dbdiffer.Check {
+		return sqlconstraint(c.Name) + "CHECK (" + c.Expression + ")"
+	}
+	sql := sqlconstraint(c.Name) + "FOREIGN KEY (" + sqlcolumns(c.Columns) + ") REFERENCES " + quote(c.RefTable) + " (" + sqlcolumns(c.RefColumns) + ")"
+	if c.OnDelete != "" {
+		sql += " ON DELETE " + c.OnDelete
+	}
+	if c.OnUpdate != "" {
+		sql += " ON UPDATE " + c.OnUpdate
+	}
+	return sql
+}
+
+func sqloptions(s string) string {
+	if s == "" {
+		return ""
+	}
+	return " WITH (" + s + ")"
+}
+
+func sqlcolumns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		if isident(column) {
+			quoted[i] = quote(column)
+		} else {
+			// expression columns are already formatted by pg_get_indexdef
+			quoted[i] = column
+		}
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func isident(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if !(r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+func quote(s string) string {
+	return pq.QuoteIdentifier(s)
+}
+
+func literal(s string) string {
+	return pq.QuoteLiteral(s)
+}
@@ -0,0 +1,319 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/sillydong/dbdiffer"
+)
+
+var db *sql.DB
+
+func TestMain(m *testing.M) {
+	if os.Getenv("PG_NEWDB") == "" {
+		// only tests without database will run
+		os.Exit(m.Run())
+	}
+
+	var err error
+	db, err = sql.Open("postgres", os.Getenv("PG_NEWDB"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
+func requiredb(t *testing.T) {
+	if db == nil {
+		t.Skip("PG_NEWDB is not set")
+	}
+}
+
+func strptr(s string) *string {
+	return &s
+}
+
+var oldschema = &dbdiffer.Schema{Tables: []dbdiffer.Table{
+	{
+		Name: "user",
+		Fields: dbdiffer.ResultFields{Create: []dbdiffer.Field{
+			{Field: "id", Type: "integer", Null: "NO", Default: strptr("nextval('user_id_seq'::regclass)")},
+			{Field: "name", Type: "character varying(64)", Null: "NO", After: "id"},
+		}},
+		Indexes: dbdiffer.ResultIndexes{Create: []dbdiffer.Index{
+			{Table: "user", KeyName: "PRIMARY", ColumnName: []string{"id"}, IndexType: "btree", Comment: "user_pkey"},
+		}},
+	},
+	{
+		Name: "post",
+		Fields: dbdiffer.ResultFields{Create: []dbdiffer.Field{
+			{Field: "id", Type: "integer", Null: "NO"},
+			{Field: "user_id", Type: "integer", Null: "NO", After: "id"},
+			{Field: "title", Type: "text", Null: "NO", After: "user_id"},
+		}},
+		Constraints: dbdiffer.ResultConstraints{Create: []dbdiffer.Constraint{
+			{Name: "post_title_check", Table: "post", Type: dbdiffer.Check, Expression: "(title <> ''::text)"},
+		}},
+	},
+}}
+
+var newschema = &dbdiffer.Schema{Tables: []dbdiffer.Table{
+	{
+		Name: "user",
+		Fields: dbdiffer.ResultFields{Create: []dbdiffer.Field{
+			{Field: "id", Type: "integer", Null: "NO", Default: strptr("nextval('user_id_seq'::regclass)")},
+			{Field: "name", Type: "character varying(128)", Null: "NO", After: "id"},
+			{Field: "email", Type: "text", Null: "YES", After: "name"},
+		}},
+		Indexes: dbdiffer.ResultIndexes{Create: []dbdiffer.Index{
+			{Table: "user", KeyName: "PRIMARY", ColumnName: []string{"id"}, IndexType: "btree", Comment: "user_pkey"},
+			{Table: "user", KeyName: "user_email_key", ColumnName: []string{"email"}, IndexType: "btree", Comment: "user_email_key"},
+		}},
+	},
+	{
+		Name: "post",
+		Fields: dbdiffer.ResultFields{Create: []dbdiffer.Field{
+			{Field: "id", Type: "integer", Null: "NO"},
+			{Field: "user_id", Type: "integer", Null: "NO", After: "id"},
+			{Field: "title", Type: "text", Null: "NO", After: "user_id"},
+		}},
+		Constraints: dbdiffer.ResultConstraints{Create: []dbdiffer.Constraint{
+			{Name: "post_title_check", Table: "post", Type: dbdiffer.Check, Expression: "(length(title) > 0)"},
+			{Name: "post_user_id_fkey", Table: "post", Type: dbdiffer.ForeignKey, Columns: []string{"user_id"}, RefTable: "user", RefColumns: []string{"id"}, OnUpdate: "NO ACTION", OnDelete: "CASCADE"},
+		}},
+	},
+	{
+		Name: "comment",
+		Fields: dbdiffer.ResultFields{Create: []dbdiffer.Field{
+			{Field: "id", Type: "bigint", Null: "NO", Default: strptr("nextval('comment_id_seq'::regclass)")},
+			{Field: "post_id", Type: "integer", Null: "NO", After: "id"},
+		}},
+		Indexes: dbdiffer.ResultIndexes{Create: []dbdiffer.Index{
+			{Table: "comment", KeyName: "PRIMARY", ColumnName: []string{"id"}, IndexType: "btree", Comment: "comment_pkey"},
+		}},
+		Constraints: dbdiffer.ResultConstraints{Create: []dbdiffer.Constraint{
+			{Name: "comment_post_id_fkey", Table: "comment", Type: dbdiffer.ForeignKey, Columns: []string{"post_id"}, RefTable: "post", RefColumns: []string{"id"}, OnUpdate: "NO ACTION", OnDelete: "NO ACTION"},
+		}},
+	},
+}}
+
+func TestGenerate(t *testing.T) {
+	differ := NewFromInspectors(newschema, oldschema)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		`ALTER TABLE "post" DROP CONSTRAINT IF EXISTS "post_title_check";`,
+		`CREATE TABLE IF NOT EXISTS "comment" ("id" bigserial NOT NULL, "post_id" integer NOT NULL, CONSTRAINT "comment_pkey" PRIMARY KEY ("id"));`,
+		`ALTER TABLE "user" ADD COLUMN "email" text;`,
+		`ALTER TABLE "user" ALTER COLUMN "name" TYPE character varying(128) USING "name"::character varying(128);`,
+		`ALTER TABLE "user" ADD CONSTRAINT "user_email_key" UNIQUE ("email");`,
+		`ALTER TABLE "post" ADD CONSTRAINT "post_title_check" CHECK ((length(title) > 0));`,
+		`ALTER TABLE "post" ADD CONSTRAINT "post_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "user" ("id") ON DELETE CASCADE ON UPDATE NO ACTION;`,
+		// the foreign key of the created table references a changed table, it is added after the change
+		`ALTER TABLE "comment" ADD CONSTRAINT "comment_post_id_fkey" FOREIGN KEY ("post_id") REFERENCES "post" ("id") ON DELETE NO ACTION ON UPDATE NO ACTION;`,
+	}
+	sqls := dbdiffer.Strings(gen)
+	if len(sqls) != len(expect) {
+		t.Fatalf("expect %d statements, got %q", len(expect), sqls)
+	}
+	for i := range expect {
+		if sqls[i] != expect[i] {
+			t.Errorf("statement %d:\nexpect %s\ngot    %s", i, expect[i], sqls[i])
+		}
+	}
+}
+
+func TestGenerateDown(t *testing.T) {
+	differ := NewFromInspectors(newschema, oldschema)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := differ.GenerateDown(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		`-- WARNING: table comment is dropped along with its rows`,
+		`-- WARNING: column user.email is dropped along with its values`,
+		`-- WARNING: column user.name is changed back from character varying(128) to character varying(64), values changed by the conversion are not restored`,
+		`ALTER TABLE "post" DROP CONSTRAINT IF EXISTS "post_title_check";`,
+		`ALTER TABLE "post" DROP CONSTRAINT IF EXISTS "post_user_id_fkey";`,
+		`DROP TABLE IF EXISTS "comment";`,
+		`ALTER TABLE "user" DROP CONSTRAINT IF EXISTS "user_email_key";`,
+		`ALTER TABLE "user" DROP COLUMN IF EXISTS "email";`,
+		`ALTER TABLE "user" ALTER COLUMN "name" TYPE character varying(64) USING "name"::character varying(64);`,
+		`ALTER TABLE "post" ADD CONSTRAINT "post_title_check" CHECK ((title <> ''::text));`,
+	}
+	sqls := dbdiffer.Strings(gen)
+	if len(sqls) != len(expect) {
+		t.Fatalf("expect %d statements, got %q", len(expect), sqls)
+	}
+	for i := range expect {
+		if sqls[i] != expect[i] {
+			t.Errorf("statement %d:\nexpect %s\ngot    %s", i, expect[i], sqls[i])
+		}
+	}
+}
+
+func TestGenerateOptions(t *testing.T) {
+	old := &dbdiffer.Schema{Tables: []dbdiffer.Table{{
+		Name:    "user",
+		Options: "fillfactor=70, autovacuum_enabled=false",
+		Comment: "users",
+		Fields: dbdiffer.ResultFields{Create: []dbdiffer.Field{
+			{Field: "id", Type: "integer", Null: "NO"},
+			{Field: "name", Type: "text", Null: "YES", Default: strptr("''::text"), Comment: "full name", After: "id"},
+			{Field: "age", Type: "integer", Null: "YES", After: "name"},
+		}},
+	}}}
+	new := &dbdiffer.Schema{Tables: []dbdiffer.Table{{
+		Name:    "user",
+		Options: "fillfactor=80",
+		Fields: dbdiffer.ResultFields{Create: []dbdiffer.Field{
+			{Field: "id", Type: "integer", Null: "NO"},
+			{Field: "name", Type: "text", Null: "NO", Default: strptr("''::text"), After: "id"},
+			{Field: "age", Type: "integer", Null: "YES", Comment: "in years", After: "name"},
+		}},
+	}}}
+	differ := NewFromInspectors(new, old)
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// removed options and comments are reset, only what differs of a column is changed
+	expect := []string{
+		`ALTER TABLE "user" SET (fillfactor=80);`,
+		`ALTER TABLE "user" RESET (autovacuum_enabled);`,
+		`COMMENT ON TABLE "user" IS NULL;`,
+		`ALTER TABLE "user" ALTER COLUMN "name" SET NOT NULL;`,
+		`COMMENT ON COLUMN "user"."name" IS NULL;`,
+		`COMMENT ON COLUMN "user"."age" IS 'in years';`,
+	}
+	sqls := dbdiffer.Strings(gen)
+	if len(sqls) != len(expect) {
+		t.Fatalf("expect %d statements, got %q", len(expect), sqls)
+	}
+	for i := range expect {
+		if sqls[i] != expect[i] {
+			t.Errorf("statement %d:\nexpect %s\ngot    %s", i, expect[i], sqls[i])
+		}
+	}
+
+	gen, err = differ.GenerateDown(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = []string{
+		`ALTER TABLE "user" SET (fillfactor=70, autovacuum_enabled=false);`,
+		`COMMENT ON TABLE "user" IS 'users';`,
+		`ALTER TABLE "user" ALTER COLUMN "name" DROP NOT NULL;`,
+		`COMMENT ON COLUMN "user"."name" IS 'full name';`,
+		`COMMENT ON COLUMN "user"."age" IS NULL;`,
+	}
+	sqls = dbdiffer.Strings(gen)
+	if len(sqls) != len(expect) {
+		t.Fatalf("expect %d statements, got %q", len(expect), sqls)
+	}
+	for i := range expect {
+		if sqls[i] != expect[i] {
+			t.Errorf("statement %d:\nexpect %s\ngot    %s", i, expect[i], sqls[i])
+		}
+	}
+}
+
+func TestTables(t *testing.T) {
+	requiredb(t)
+	tb, tbp, err := tables(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%+v\n", tb)
+	t.Logf("%+v\n", tbp)
+}
+
+func TestFields(t *testing.T) {
+	requiredb(t)
+	tb, _, err := tables(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range tb {
+		fids, fidsp, err := fields(db, table.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("%+v\n", fids)
+		t.Logf("%+v\n", fidsp)
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	requiredb(t)
+	tb, _, err := tables(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range tb {
+		idxs, idxsp, err := indexes(db, table.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("%+v\n", idxs)
+		t.Logf("%+v", idxsp)
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	requiredb(t)
+	tb, _, err := tables(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range tb {
+		cons, consp, err := constraints(db, table.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("%+v\n", cons)
+		t.Logf("%+v", consp)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	requiredb(t)
+	differ, err := New(os.Getenv("PG_NEWDB"), os.Getenv("PG_OLDDB"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sres, _ := json.MarshalIndent(res, "", "  ")
+	t.Logf("%+v", string(sres))
+
+	gen, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range gen {
+		t.Log(s.SQL)
+	}
+}
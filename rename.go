@@ -0,0 +1,525 @@
+package dbdiffer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Rename maps the old name of a table or a column to its new name, Table is empty for tables
+type Rename struct {
+	Table string
+	Old   string
+	New   string
+}
+
+// Renames is an explicit rename mapping, for renames the detection misses or gets wrong
+type Renames []Rename
+
+// ReadRenames reads a rename mapping, one rename per line:
+//
+//	# comment
+//	users = user
+//	user.name = user.full_name
+//
+// Columns are named after the table they are in after tables are renamed.
+func ReadRenames(r io.Reader) (Renames, error) {
+	renames := Renames{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expect old = new", line)
+		}
+		oldtable, oldname, err := splitname(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		newtable, newname, err := splitname(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if oldtable != newtable {
+			if oldtable == "" || newtable == "" {
+				return nil, fmt.Errorf("line %d: table can not be renamed to a column", line)
+			}
+			return nil, fmt.Errorf("line %d: column can not be moved from %s to %s", line, oldtable, newtable)
+		}
+		renames = append(renames, Rename{Table: newtable, Old: oldname, New: newname})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return renames, nil
+}
+
+// LoadRenames reads a rename mapping from a file, see ReadRenames
+func LoadRenames(path string) (Renames, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	renames, err := ReadRenames(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return renames, nil
+}
+
+// splitname splits table.column, the table is empty for a table name
+func splitname(s string) (string, string, error) {
+	s = strings.TrimSpace(s)
+	parts := strings.Split(s, ".")
+	for _, part := range parts {
+		if part == "" {
+			return "", "", fmt.Errorf("invalid name %q", s)
+		}
+	}
+	switch len(parts) {
+	case 1:
+		return "", parts[0], nil
+	case 2:
+		return parts[0], parts[1], nil
+	default:
+		return "", "", fmt.Errorf("invalid name %q", s)
+	}
+}
+
+// Apply turns dropped and created tables, and dropped and added columns of the result into renames.
+// Tables are renamed before columns. Renames already detected for either name are undone first,
+// renames matching neither a dropped nor a created name are ignored.
+func (r Renames) Apply(result *Result) error {
+	for _, rename := range r {
+		if rename.Table == "" {
+			if err := applytable(result, rename); err != nil {
+				return err
+			}
+		}
+	}
+	for _, rename := range r {
+		if rename.Table != "" {
+			if err := applyfield(result, rename); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func applytable(result *Result, rename Rename) error {
+	// undo detected renames involving either table
+	renamed := make([]TableRename, 0, len(result.Rename))
+	for _, change := range result.Rename {
+		if change.Old.Name == rename.Old || change.New.Name == rename.New {
+			for pos, table := range result.Change {
+				if table.Name == change.New.Name {
+					result.Change = append(result.Change[:pos:pos], result.Change[pos+1:]...)
+					break
+				}
+			}
+			result.Drop = append(result.Drop, change.Old)
+			result.Create = append(result.Create, change.New)
+			continue
+		}
+		renamed = append(renamed, change)
+	}
+	result.Rename = renamed
+
+	oldpos, newpos := -1, -1
+	for i, table := range result.Drop {
+		if table.Name == rename.Old {
+			oldpos = i
+		}
+	}
+	for i, table := range result.Create {
+		if table.Name == rename.New {
+			newpos = i
+		}
+	}
+	switch {
+	case oldpos < 0 && newpos < 0:
+		return nil
+	case oldpos < 0:
+		return fmt.Errorf("rename %s: table is not dropped", rename.Old)
+	case newpos < 0:
+		return fmt.Errorf("rename %s: table is not created", rename.New)
+	}
+	old, new := result.Drop[oldpos], result.Create[newpos]
+	result.Drop = append(result.Drop[:oldpos:oldpos], result.Drop[oldpos+1:]...)
+	result.Create = append(result.Create[:newpos:newpos], result.Create[newpos+1:]...)
+	renametable(result, old, new)
+	return nil
+}
+
+func applyfield(result *Result, rename Rename) error {
+	pos := -1
+	for i, table := range result.Change {
+		if table.Name == rename.Table {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return nil
+	}
+	fields := &result.Change[pos].Fields
+
+	// undo detected renames involving either column
+	renamed := make([]FieldChange, 0, len(fields.Rename))
+	for _, change := range fields.Rename {
+		if change.Old.Field == rename.Old || change.New.Field == rename.New {
+			fields.Drop = append(fields.Drop, change.Old)
+			fields.Add = append(fields.Add, change.New)
+			continue
+		}
+		renamed = append(renamed, change)
+	}
+	fields.Rename = renamed
+
+	oldpos, newpos := -1, -1
+	for i, field := range fields.Drop {
+		if field.Field == rename.Old {
+			oldpos = i
+		}
+	}
+	for i, field := range fields.Add {
+		if field.Field == rename.New {
+			newpos = i
+		}
+	}
+	switch {
+	case oldpos < 0 && newpos < 0:
+		return nil
+	case oldpos < 0:
+		return fmt.Errorf("rename %s.%s: column is not dropped", rename.Table, rename.Old)
+	case newpos < 0:
+		return fmt.Errorf("rename %s.%s: column is not added", rename.Table, rename.New)
+	}
+	fields.Rename = append(fields.Rename, FieldChange{Old: fields.Drop[oldpos], New: fields.Add[newpos]})
+	fields.Drop = append(fields.Drop[:oldpos:oldpos], fields.Drop[oldpos+1:]...)
+	fields.Add = append(fields.Add[:newpos:newpos], fields.Add[newpos+1:]...)
+	renamedindexes(&result.Change[pos])
+	return nil
+}
+
+// renametable records the rename of a table, along with what else changed in it
+func renametable(result *Result, old, new Table) {
+	result.Rename = append(result.Rename, TableRename{Old: old, New: new})
+	if change := CompareTable(retable(old, new.Name), new); !change.IsEmpty() {
+		result.Change = append(result.Change, change)
+	}
+}
+
+// retable returns a copy of the table under another name
+func retable(table Table, name string) Table {
+	old := table.Name
+	table.Name = name
+	indexes := make([]Index, len(table.Indexes.Create))
+	for i, index := range table.Indexes.Create {
+		index.Table = name
+		indexes[i] = index
+	}
+	table.Indexes.Create = indexes
+	constraints := make([]Constraint, len(table.Constraints.Create))
+	for i, constraint := range table.Constraints.Create {
+		constraint.Table = name
+		if constraint.RefTable == old {
+			constraint.RefTable = name
+		}
+		constraints[i] = constraint
+	}
+	table.Constraints.Create = constraints
+	return table
+}
+
+// renamethreshold is the share of fields and indexes a dropped and a created table
+// need to have in common to be taken as a rename
+const renamethreshold = 0.8
+
+// detecttablerenames pairs dropped and created tables with the same or nearly the same fields and indexes and similar names.
+// Tables with more than one best candidate are left alone.
+func detecttablerenames(result *Result) {
+	if len(result.Drop) == 0 || len(result.Create) == 0 {
+		return
+	}
+	scores := make([][]float64, len(result.Drop))
+	for i, old := range result.Drop {
+		scores[i] = make([]float64, len(result.Create))
+		for j, new := range result.Create {
+			if similar(old.Name, new.Name) {
+				scores[i][j] = likeness(old, new)
+			}
+		}
+	}
+	// best tells the only candidate with the highest score, or -1
+	best := func(n int, score func(int) float64) int {
+		pos, max, ties := -1, 0.0, 0
+		for i := 0; i < n; i++ {
+			switch s := score(i); {
+			case s > max:
+				pos, max, ties = i, s, 1
+			case s == max && s > 0:
+				ties++
+			}
+		}
+		if max < renamethreshold || ties > 1 {
+			return -1
+		}
+		return pos
+	}
+
+	dropped := make(map[int]bool)
+	created := make(map[int]bool)
+	pairs := [][2]int{}
+	for i := range result.Drop {
+		j := best(len(result.Create), func(j int) float64 { return scores[i][j] })
+		if j < 0 || best(len(result.Drop), func(k int) float64 { return scores[k][j] }) != i {
+			continue
+		}
+		dropped[i] = true
+		created[j] = true
+		pairs = append(pairs, [2]int{i, j})
+	}
+	if len(pairs) == 0 {
+		return
+	}
+	for _, pair := range pairs {
+		renametable(result, result.Drop[pair[0]], result.Create[pair[1]])
+	}
+	drop := make([]Table, 0, len(result.Drop))
+	for i, table := range result.Drop {
+		if !dropped[i] {
+			drop = append(drop, table)
+		}
+	}
+	create := make([]Table, 0, len(result.Create))
+	for i, table := range result.Create {
+		if !created[i] {
+			create = append(create, table)
+		}
+	}
+	result.Drop, result.Create = drop, create
+}
+
+// likeness is the share of fields and indexes two tables have in common
+func likeness(old, new Table) float64 {
+	if len(new.Fields.Create) == 0 {
+		return 0
+	}
+	old = retable(old, new.Name)
+	same := 0
+	for _, field := range new.Fields.Create {
+		for _, oldfield := range old.Fields.Create {
+			if field.Equal(oldfield) {
+				same++
+				break
+			}
+		}
+	}
+	for _, index := range new.Indexes.Create {
+		for _, oldindex := range old.Indexes.Create {
+			if index.Equal(oldindex) {
+				same++
+				break
+			}
+		}
+	}
+	total := len(old.Fields.Create) + len(old.Indexes.Create)
+	if n := len(new.Fields.Create) + len(new.Indexes.Create); n > total {
+		total = n
+	}
+	return float64(same) / float64(total)
+}
+
+// detectrenames pairs dropped and added fields that look like the same field under a new name:
+// same definition, same position and similar names. Fields with more than one candidate are left alone.
+func detectrenames(olddetail, newdetail Table, change *Table) {
+	if len(change.Fields.Drop) == 0 || len(change.Fields.Add) == 0 {
+		return
+	}
+	position := func(fields []Field, name string) int {
+		for pos, field := range fields {
+			if field.Field == name {
+				return pos
+			}
+		}
+		return -1
+	}
+	candidates := func(field Field, others []Field, fieldpos, otherpos func(string) int) []int {
+		matches := []int{}
+		for i, other := range others {
+			renamed := field
+			renamed.Field, renamed.Comment = other.Field, other.Comment
+			if renamed.Equal(other) && fieldpos(field.Field) == otherpos(other.Field) && similar(field.Field, other.Field) {
+				matches = append(matches, i)
+			}
+		}
+		return matches
+	}
+	oldpos := func(name string) int { return position(olddetail.Fields.Create, name) }
+	newpos := func(name string) int { return position(newdetail.Fields.Create, name) }
+
+	dropped := make(map[int]bool)
+	added := make(map[int]bool)
+	for i, oldfield := range change.Fields.Drop {
+		matches := candidates(oldfield, change.Fields.Add, oldpos, newpos)
+		if len(matches) != 1 {
+			continue
+		}
+		// the match has to be unambiguous both ways
+		if back := candidates(change.Fields.Add[matches[0]], change.Fields.Drop, newpos, oldpos); len(back) != 1 {
+			continue
+		}
+		dropped[i] = true
+		added[matches[0]] = true
+		change.Fields.Rename = append(change.Fields.Rename, FieldChange{Old: oldfield, New: change.Fields.Add[matches[0]]})
+	}
+	if len(change.Fields.Rename) == 0 {
+		return
+	}
+	drop := make([]Field, 0, len(change.Fields.Drop))
+	for i, field := range change.Fields.Drop {
+		if !dropped[i] {
+			drop = append(drop, field)
+		}
+	}
+	add := make([]Field, 0, len(change.Fields.Add))
+	for i, field := range change.Fields.Add {
+		if !added[i] {
+			add = append(add, field)
+		}
+	}
+	change.Fields.Drop, change.Fields.Add = drop, add
+}
+
+// renamedindexes removes indexes and constraints dropped and added again only because a column is renamed,
+// databases rename the column in them along with the column
+func renamedindexes(change *Table) {
+	if len(change.Fields.Rename) == 0 {
+		return
+	}
+	names := make(map[string]string, len(change.Fields.Rename))
+	for _, rename := range change.Fields.Rename {
+		names[rename.Old.Field] = rename.New.Field
+	}
+	rename := func(columns []string) []string {
+		renamed := make([]string, len(columns))
+		for i, column := range columns {
+			renamed[i] = column
+			if name, exist := names[column]; exist {
+				renamed[i] = name
+			}
+		}
+		return renamed
+	}
+
+	unchanged := make(map[string]bool)
+	for _, index := range change.Indexes.Drop {
+		index.ColumnName = rename(index.ColumnName)
+		parts := make([]IndexPart, len(index.Parts))
+		for i, part := range index.Parts {
+			parts[i] = part
+			if name, exist := names[part.Column]; exist {
+				parts[i].Column = name
+			}
+		}
+		index.Parts = parts
+		for _, add := range change.Indexes.Add {
+			if index.Equal(add) {
+				unchanged[index.KeyName] = true
+			}
+		}
+	}
+	if len(unchanged) > 0 {
+		drop := make([]Index, 0, len(change.Indexes.Drop))
+		for _, index := range change.Indexes.Drop {
+			if !unchanged[index.KeyName] {
+				drop = append(drop, index)
+			}
+		}
+		add := make([]Index, 0, len(change.Indexes.Add))
+		for _, index := range change.Indexes.Add {
+			if !unchanged[index.KeyName] {
+				add = append(add, index)
+			}
+		}
+		change.Indexes.Drop, change.Indexes.Add = drop, add
+	}
+
+	unchanged = make(map[string]bool)
+	for _, constraint := range change.Constraints.Drop {
+		constraint.Columns = rename(constraint.Columns)
+		for _, add := range change.Constraints.Add {
+			if constraint.Equal(add) {
+				unchanged[constraint.Name] = true
+			}
+		}
+	}
+	if len(unchanged) > 0 {
+		drop := make([]Constraint, 0, len(change.Constraints.Drop))
+		for _, constraint := range change.Constraints.Drop {
+			if !unchanged[constraint.Name] {
+				drop = append(drop, constraint)
+			}
+		}
+		add := make([]Constraint, 0, len(change.Constraints.Add))
+		for _, constraint := range change.Constraints.Add {
+			if !unchanged[constraint.Name] {
+				add = append(add, constraint)
+			}
+		}
+		change.Constraints.Drop, change.Constraints.Add = drop, add
+	}
+}
+
+// similar tells whether two names are close enough to be a rename, like user_name and username
+func similar(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if strings.Contains(a, b) || strings.Contains(b, a) {
+		return true
+	}
+	longest := len(a)
+	if len(b) > longest {
+		longest = len(b)
+	}
+	return float64(longest-levenshtein(a, b))/float64(longest) >= 0.5
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,180 @@
+package dbdiffer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompareRename(t *testing.T) {
+	old := &Schema{Tables: []Table{{
+		Name: "user",
+		Fields: ResultFields{Create: []Field{
+			{Field: "id", Type: "int(11)", Null: "NO"},
+			{Field: "username", Type: "varchar(32)", Null: "NO", Default: strptr("")},
+			{Field: "mail", Type: "varchar(128)", Null: "YES"},
+			{Field: "flag_a", Type: "int(11)", Null: "YES"},
+		}},
+		Indexes: ResultIndexes{Create: []Index{
+			{Table: "user", NonUnique: 1, KeyName: "idx_name", ColumnName: []string{"username"}},
+		}},
+	}}}
+	new := &Schema{Tables: []Table{{
+		Name: "user",
+		Fields: ResultFields{Create: []Field{
+			{Field: "id", Type: "int(11)", Null: "NO"},
+			{Field: "user_name", Type: "varchar(32)", Null: "NO", Default: strptr(""), Comment: "login"},
+			{Field: "contact", Type: "varchar(128)", Null: "YES"},
+			{Field: "flag_b", Type: "int(11)", Null: "YES"},
+		}},
+		Indexes: ResultIndexes{Create: []Index{
+			{Table: "user", NonUnique: 1, KeyName: "idx_name", ColumnName: []string{"user_name"}},
+		}},
+	}}}
+
+	res := Compare(old, new)
+	if len(res.Change) != 1 {
+		t.Fatalf("unexpected change %+v", res.Change)
+	}
+	fields := res.Change[0].Fields
+	// mail and contact are not similar, flag_a and flag_b are
+	if len(fields.Rename) != 2 || fields.Rename[0].Old.Field != "username" || fields.Rename[0].New.Field != "user_name" || fields.Rename[1].New.Field != "flag_b" {
+		t.Errorf("unexpected renames %+v", fields.Rename)
+	}
+	if len(fields.Drop) != 1 || fields.Drop[0].Field != "mail" || len(fields.Add) != 1 || fields.Add[0].Field != "contact" {
+		t.Errorf("unexpected fields %+v", fields)
+	}
+	if !res.Change[0].Indexes.IsEmpty() {
+		t.Errorf("index is renamed along with the column, got %+v", res.Change[0].Indexes)
+	}
+
+	renames, err := ReadRenames(strings.NewReader("# explicit renames\nuser.mail = user.contact\n\nuser.flag_a = user.flag_c\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := renames[:1].Apply(res); err != nil {
+		t.Fatal(err)
+	}
+	fields = res.Change[0].Fields
+	if len(fields.Rename) != 3 || fields.Rename[2].Old.Field != "mail" || len(fields.Drop) != 0 || len(fields.Add) != 0 {
+		t.Errorf("unexpected fields %+v", fields)
+	}
+
+	// flag_a is renamed to flag_b by detection, the mapping renames it to a column that is not added
+	if err := renames[1:].Apply(res); err == nil || !strings.Contains(err.Error(), "flag_c") {
+		t.Errorf("expect error on flag_c, got %v", err)
+	}
+}
+
+func TestCompareRenameAmbiguous(t *testing.T) {
+	old := &Schema{Tables: []Table{{
+		Name: "t",
+		Fields: ResultFields{Create: []Field{
+			{Field: "value", Type: "int", Null: "YES"},
+		}},
+	}}}
+	new := &Schema{Tables: []Table{{
+		Name: "t",
+		Fields: ResultFields{Create: []Field{
+			{Field: "value1", Type: "int", Null: "YES"},
+			{Field: "value2", Type: "int", Null: "YES"},
+		}},
+	}}}
+	// value1 has the same position, but value2 is also similar
+	res := Compare(old, new)
+	if fields := res.Change[0].Fields; len(fields.Rename) != 1 || fields.Rename[0].New.Field != "value1" {
+		t.Errorf("unexpected fields %+v", fields)
+	}
+
+	new.Tables[0].Fields.Create[0].Type = "bigint"
+	res = Compare(old, new)
+	if fields := res.Change[0].Fields; len(fields.Rename) != 0 || len(fields.Drop) != 1 || len(fields.Add) != 2 {
+		t.Errorf("unexpected fields %+v", fields)
+	}
+}
+
+func TestReadRenamesError(t *testing.T) {
+	for _, s := range []string{"user.a user.b", "a = user.b", "user.a = post.a", "a.b.c = a.b.d", "user. = user.a"} {
+		if _, err := ReadRenames(strings.NewReader(s)); err == nil || !strings.HasPrefix(err.Error(), "line 1") {
+			t.Errorf("%q: expect error on line 1, got %v", s, err)
+		}
+	}
+}
+
+func TestCompareTableRename(t *testing.T) {
+	fields := []Field{
+		{Field: "id", Type: "int(11)", Null: "NO"},
+		{Field: "name", Type: "varchar(32)", Null: "NO"},
+		{Field: "email", Type: "varchar(128)", Null: "YES"},
+		{Field: "age", Type: "int(11)", Null: "YES"},
+	}
+	old := &Schema{Tables: []Table{
+		{
+			Name:    "users",
+			Fields:  ResultFields{Create: fields},
+			Indexes: ResultIndexes{Create: []Index{{Table: "users", KeyName: "PRIMARY", ColumnName: []string{"id"}}}},
+		},
+		{Name: "log", Fields: ResultFields{Create: fields[:1]}},
+	}}
+	new := &Schema{Tables: []Table{
+		{
+			Name:    "user",
+			Fields:  ResultFields{Create: append(append([]Field{}, fields...), Field{Field: "phone", Type: "varchar(16)", Null: "YES"})},
+			Indexes: ResultIndexes{Create: []Index{{Table: "user", KeyName: "PRIMARY", ColumnName: []string{"id"}}}},
+		},
+		{Name: "audit", Fields: ResultFields{Create: fields[:1]}},
+		{Name: "history", Fields: ResultFields{Create: fields[:1]}},
+	}}
+
+	res := Compare(old, new)
+	// users and user share 5 of 6 fields and indexes, log is as much like audit as history
+	if len(res.Rename) != 1 || res.Rename[0].Old.Name != "users" || res.Rename[0].New.Name != "user" {
+		t.Fatalf("unexpected renames %+v", res.Rename)
+	}
+	if len(res.Change) != 1 || res.Change[0].Name != "user" || len(res.Change[0].Fields.Add) != 1 || !res.Change[0].Indexes.IsEmpty() {
+		t.Errorf("unexpected change %+v", res.Change)
+	}
+	if len(res.Drop) != 1 || len(res.Create) != 2 {
+		t.Errorf("unexpected drop %+v and create %+v", res.Drop, res.Create)
+	}
+
+	renames, err := ReadRenames(strings.NewReader("log = history\nusers = audit\nhistory.id = history.id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := renames[:1].Apply(res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rename) != 2 || res.Rename[1].New.Name != "history" || len(res.Drop) != 0 || len(res.Create) != 1 || res.Create[0].Name != "audit" {
+		t.Errorf("unexpected result %+v", res)
+	}
+	// users is renamed to user by detection, the mapping renames it to audit
+	if err := renames[1:].Apply(res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rename) != 2 || res.Rename[1].New.Name != "audit" || len(res.Change) != 1 || res.Change[0].Name != "audit" || len(res.Create) != 1 || res.Create[0].Name != "user" {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestCompareTableRenameName(t *testing.T) {
+	fields := []Field{
+		{Field: "id", Type: "int(11)", Null: "NO"},
+		{Field: "name", Type: "varchar(32)", Null: "NO"},
+	}
+	old := &Schema{Tables: []Table{{Name: "tag", Fields: ResultFields{Create: fields}}}}
+	new := &Schema{Tables: []Table{{Name: "category", Fields: ResultFields{Create: fields}}}}
+
+	// tables alike in all but their unrelated names are not taken as a rename
+	res := Compare(old, new)
+	if len(res.Rename) != 0 || len(res.Drop) != 1 || len(res.Create) != 1 {
+		t.Fatalf("unexpected renames %+v, drop %+v and create %+v", res.Rename, res.Drop, res.Create)
+	}
+
+	renames := Renames{{Old: "tag", New: "category"}}
+	if err := renames.Apply(res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rename) != 1 || len(res.Drop) != 0 || len(res.Create) != 0 {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
@@ -0,0 +1,221 @@
+package dbdiffer
+
+import "fmt"
+
+// Reverse returns the result undoing this one, which turns the new schema back into the old one,
+// along with warnings about what it cannot bring back. Dropped tables, columns and partitions
+// are created again from their old definitions, but the rows they held are gone, while tables
+// and columns the upgrade created are dropped along with the rows written to them since.
+// Changed tables need their Old definition, those without it are left as they are.
+func (r *Result) Reverse() (*Result, []string) {
+	warnings := make([]string, 0)
+	reverse := &Result{
+		Drop:     append([]Table{}, r.Create...),
+		Create:   append([]Table{}, r.Drop...),
+		Change:   []Table{},
+		Rename:   []TableRename{},
+		Views:    ResultViews{Drop: r.Views.Create, Create: r.Views.Drop, Change: r.Views.Old, Old: r.Views.Change},
+		Triggers: ResultTriggers{Drop: r.Triggers.Create, Create: r.Triggers.Drop, Change: r.Triggers.Old, Old: r.Triggers.Change},
+		Routines: ResultRoutines{Drop: r.Routines.Create, Create: r.Routines.Drop, Change: r.Routines.Old, Old: r.Routines.Change},
+		Events:   ResultEvents{Drop: r.Events.Create, Create: r.Events.Drop, Change: r.Events.Old, Old: r.Events.Change},
+	}
+	if len(reverse.Views.Change) != len(reverse.Views.Old) || len(reverse.Triggers.Change) != len(reverse.Triggers.Old) ||
+		len(reverse.Routines.Change) != len(reverse.Routines.Old) || len(reverse.Events.Change) != len(reverse.Events.Old) {
+		warnings = append(warnings, "old definitions of changed views, triggers, routines or events are unknown, they are not changed back")
+		reverse.Views.Change, reverse.Views.Old = nil, nil
+		reverse.Triggers.Change, reverse.Triggers.Old = nil, nil
+		reverse.Routines.Change, reverse.Routines.Old = nil, nil
+		reverse.Events.Change, reverse.Events.Old = nil, nil
+	}
+
+	for _, table := range r.Drop {
+		warnings = append(warnings, "table "+table.Name+" is created again without its rows"+rows(table.Rows))
+	}
+	for _, table := range r.Create {
+		warnings = append(warnings, "table "+table.Name+" is dropped along with its rows")
+	}
+	oldnames := make(map[string]string, len(r.Rename))
+	for _, rename := range r.Rename {
+		reverse.Rename = append(reverse.Rename, TableRename{Old: rename.New, New: rename.Old})
+		oldnames[rename.New.Name] = rename.Old.Name
+	}
+	for _, table := range r.Change {
+		name := table.Name
+		if oldname, exist := oldnames[name]; exist {
+			name = oldname
+		}
+		if table.Old == nil {
+			warnings = append(warnings, "old definition of table "+name+" is unknown, it is not changed back")
+			continue
+		}
+		change, tablewarnings := reversetable(table, name)
+		warnings = append(warnings, tablewarnings...)
+		if !change.IsEmpty() {
+			reverse.Change = append(reverse.Change, change)
+		}
+	}
+	return reverse, warnings
+}
+
+// Completer is implemented by differs that need more of the result to undo than Result.Reverse keeps,
+// like the whole old definitions of tables they rebuild
+type Completer interface {
+	Complete(result, down *Result)
+}
+
+// Down returns the result undoing the result with the differ, completed by it when it is a Completer,
+// along with warnings about what it cannot bring back, see Result.Reverse
+func Down(d Differ, result *Result) (*Result, []string) {
+	down, warnings := result.Reverse()
+	if completer, ok := d.(Completer); ok {
+		completer.Complete(result, down)
+	}
+	return down, warnings
+}
+
+// GenerateDown returns the statements of the differ undoing the result, see Down.
+// Warnings about what cannot be undone come first, as comments.
+func GenerateDown(d Differ, result *Result) ([]Statement, error) {
+	down, warnings := Down(d, result)
+	statements, err := d.Generate(down)
+	if err != nil {
+		return nil, err
+	}
+	return append(Warnings(warnings), statements...), nil
+}
+
+// reversetable returns the change undoing the change of a table, which is named name again afterwards
+func reversetable(table Table, name string) (Table, []string) {
+	warnings := make([]string, 0)
+	old := *table.Old
+	change := Table{
+		Name:       name,
+		Rows:       table.Rows,
+		DataLength: table.DataLength,
+	}
+	if table.OptionsChanged || table.Engine != "" || table.Version != "" || table.RowFormat != "" || table.Options != "" || table.Comment != "" || table.Collation != "" {
+		// table options are only set when they are changed
+		change.Engine, change.Version, change.RowFormat = old.Engine, old.Version, old.RowFormat
+		change.Options, change.Comment, change.Collation = old.Options, old.Comment, old.Collation
+		change.OptionsChanged = true
+		// the options are changed back from the ones of the change, the rest of that definition is not known
+		change.Old = &Table{
+			Name:      name,
+			Engine:    table.Engine,
+			Version:   table.Version,
+			RowFormat: table.RowFormat,
+			Options:   table.Options,
+			Comment:   table.Comment,
+			Collation: table.Collation,
+		}
+	}
+	if len(table.Fields.Create) > 0 {
+		// tables rebuilt with their whole new definition are rebuilt with the old one
+		change.Fields.Create = old.Fields.Create
+		change.Indexes.Create = old.Indexes.Create
+		change.SQL = old.SQL
+	}
+
+	change.Fields.Drop = table.Fields.Add
+	for _, field := range table.Fields.Drop {
+		change.Fields.Add = append(change.Fields.Add, field)
+		if field.Expression == "" {
+			warnings = append(warnings, "column "+name+"."+field.Field+" is added again without its values")
+		}
+	}
+	for _, field := range table.Fields.Add {
+		if field.Expression == "" {
+			warnings = append(warnings, "column "+name+"."+field.Field+" is dropped along with its values")
+		}
+	}
+	oldfields := make(map[string]string, len(table.Fields.Rename))
+	for _, rename := range table.Fields.Rename {
+		change.Fields.Rename = append(change.Fields.Rename, FieldChange{Old: rename.New, New: rename.Old})
+		oldfields[rename.New.Field] = rename.Old.Field
+	}
+	for _, field := range table.Fields.Change {
+		change.Fields.Change = append(change.Fields.Change, FieldChange{Old: field.New, New: field.Old})
+		if field.Old.Type != field.New.Type {
+			warnings = append(warnings, fmt.Sprintf("column %s.%s is changed back from %s to %s, values changed by the conversion are not restored", name, field.Old.Field, field.New.Type, field.Old.Type))
+		}
+	}
+	change.Fields.Move = reversemoves(old, table.Fields, oldfields)
+
+	change.Indexes.Drop = retableindexes(table.Indexes.Add, name)
+	change.Indexes.Add = retableindexes(table.Indexes.Drop, name)
+	change.Indexes.Engine = old.Engine
+	change.Constraints.Drop = retableconstraints(table.Constraints.Add, name)
+	change.Constraints.Add = retableconstraints(table.Constraints.Drop, name)
+
+	partitions := table.Partitions
+	switch {
+	case partitions.IsEmpty():
+	case old.Partitions.Create == nil:
+		change.Partitions.Remove = true
+	case partitions.Create != nil || partitions.Remove || len(partitions.Drop) > 0:
+		// dropped partitions cannot be added back in between, the table is partitioned again
+		change.Partitions.Create = old.Partitions.Create
+	default:
+		change.Partitions.Drop = partitions.Add
+		for _, reorganize := range partitions.Reorganize {
+			change.Partitions.Reorganize = append(change.Partitions.Reorganize, PartitionReorganize{Old: reorganize.New, New: reorganize.Old})
+		}
+	}
+	for _, partition := range partitions.Drop {
+		warnings = append(warnings, "rows of partition "+partition.Name+" of table "+name+" are not restored")
+	}
+	if partitions.Create == nil && !partitions.Remove {
+		for _, partition := range partitions.Add {
+			warnings = append(warnings, "rows in partition "+partition.Name+" of table "+name+" are deleted along with it")
+		}
+	}
+	return change, warnings
+}
+
+// reversemoves returns the columns to move back to their old positions, in the old order.
+// Columns added again after a moved one are moved as well, as they are added before columns are moved.
+func reversemoves(old Table, fields ResultFields, oldfields map[string]string) []Field {
+	if len(fields.Move) == 0 {
+		return nil
+	}
+	moved := make(map[string]bool, len(fields.Move))
+	for _, field := range fields.Move {
+		name := field.Field
+		if oldname, exist := oldfields[name]; exist {
+			name = oldname
+		}
+		moved[name] = true
+	}
+	dropped := make(map[string]bool, len(fields.Drop))
+	for _, field := range fields.Drop {
+		dropped[field.Field] = true
+	}
+	moves := make([]Field, 0, len(fields.Move))
+	previous := false
+	for _, field := range old.Fields.Create {
+		move := moved[field.Field] || (dropped[field.Field] && previous)
+		if move {
+			moves = append(moves, field)
+		}
+		previous = move
+	}
+	return moves
+}
+
+func retableindexes(indexes []Index, name string) []Index {
+	result := make([]Index, 0, len(indexes))
+	for _, index := range indexes {
+		index.Table = name
+		result = append(result, index)
+	}
+	return result
+}
+
+func retableconstraints(constraints []Constraint, name string) []Constraint {
+	result := make([]Constraint, 0, len(constraints))
+	for _, constraint := range constraints {
+		constraint.Table = name
+		result = append(result, constraint)
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package dbdiffer
+
+import "testing"
+
+func TestReverse(t *testing.T) {
+	old := &Schema{
+		Tables: []Table{{
+			Name:   "log",
+			Engine: "InnoDB",
+			Fields: ResultFields{Create: []Field{
+				{Field: "id", Type: "int", Null: "NO"},
+				{Field: "level", Type: "varchar(16)", Null: "YES", After: "id"},
+			}},
+			Partitions: ResultPartitions{Create: &Partition{Method: "RANGE", Expression: "id", Partitions: []PartitionDefinition{
+				{Name: "p0", Values: "LESS THAN (100)"},
+				{Name: "p1", Values: "LESS THAN (200)"},
+			}}},
+		}},
+		Views: []View{{Name: "recent", Definition: "select id from log"}},
+	}
+	new := &Schema{
+		Tables: []Table{{
+			Name:   "log",
+			Engine: "InnoDB",
+			Fields: ResultFields{Create: []Field{
+				{Field: "id", Type: "bigint", Null: "NO"},
+				{Field: "message", Type: "text", Null: "YES", After: "id"},
+				{Field: "size", Type: "int", Null: "YES", Expression: "length(message)", Extra: "VIRTUAL GENERATED", After: "message"},
+			}},
+			Partitions: ResultPartitions{Create: &Partition{Method: "RANGE", Expression: "id", Partitions: []PartitionDefinition{
+				{Name: "p1", Values: "LESS THAN (200)"},
+			}}},
+		}, {
+			Name:   "audit",
+			Engine: "InnoDB",
+			Fields: ResultFields{Create: []Field{{Field: "id", Type: "int", Null: "NO"}}},
+		}},
+		Views: []View{{Name: "recent", Definition: "select id from log where id > 100"}},
+	}
+
+	res := Compare(old, new)
+	reverse, warnings := res.Reverse()
+	if len(reverse.Change) != 1 {
+		t.Fatalf("unexpected changes %+v", reverse.Change)
+	}
+	change := reverse.Change[0]
+	if len(change.Fields.Add) != 1 || change.Fields.Add[0].Field != "level" || change.Fields.Add[0].After != "id" {
+		t.Errorf("dropped column is not added again, got %+v", change.Fields)
+	}
+	if len(change.Fields.Drop) != 2 || len(reverse.Drop) != 1 || reverse.Drop[0].Name != "audit" {
+		t.Errorf("created table and columns are not dropped, got %+v %+v", reverse.Drop, change.Fields.Drop)
+	}
+	if len(change.Fields.Change) != 1 || change.Fields.Change[0].New.Type != "int" || change.Fields.Change[0].Old.Type != "bigint" {
+		t.Errorf("column is not changed back, got %+v", change.Fields.Change)
+	}
+	// dropped range partitions can only come back by partitioning again
+	if change.Partitions.Create == nil || len(change.Partitions.Create.Partitions) != 2 {
+		t.Errorf("table is not partitioned again, got %+v", change.Partitions)
+	}
+	if len(reverse.Views.Change) != 1 || reverse.Views.Change[0].Definition != "select id from log" {
+		t.Errorf("view is not replaced with the old definition, got %+v", reverse.Views)
+	}
+	// the generated column holds no values of its own
+	expect := []string{
+		"table audit is dropped along with its rows",
+		"column log.level is added again without its values",
+		"column log.message is dropped along with its values",
+		"column log.id is changed back from bigint to int, values changed by the conversion are not restored",
+		"rows of partition p0 of table log are not restored",
+	}
+	if len(warnings) != len(expect) {
+		t.Fatalf("unexpected warnings %q", warnings)
+	}
+	for i := range expect {
+		if warnings[i] != expect[i] {
+			t.Errorf("unexpected warning %q, expect %q", warnings[i], expect[i])
+		}
+	}
+
+	// views keep both definitions, tables only the old one
+	twice, warnings := reverse.Reverse()
+	if len(twice.Change) != 0 || len(twice.Views.Change) != 1 || twice.Views.Change[0].Definition != new.Views[0].Definition {
+		t.Errorf("unexpected result reversed twice %+v", twice)
+	}
+	if len(warnings) != 2 || warnings[0] != "table audit is created again without its rows" || warnings[1] != "old definition of table log is unknown, it is not changed back" {
+		t.Errorf("unexpected warnings %q", warnings)
+	}
+}
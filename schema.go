@@ -0,0 +1,96 @@
+package dbdiffer
+
+import (
+	"io"
+	"strings"
+)
+
+// FilePrefix marks a DSN as a path to a file, like file://snapshot.json
+const FilePrefix string = "file://"
+
+// Inspector reads the structure of a database
+type Inspector interface {
+	Inspect(prefix string) (*Schema, error)
+}
+
+// OpenInspectors opens inspectors of the new and the old DSN with the open function of a driver,
+// the new inspector is closed again when the old one fails to open
+func OpenInspectors(open func(dsn string) (Inspector, error), newDsn, oldDsn string) (Inspector, Inspector, error) {
+	newInspector, err := open(newDsn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oldInspector, err := open(oldDsn)
+	if err != nil {
+		CloseInspectors(newInspector)
+		return nil, nil, err
+	}
+	return newInspector, oldInspector, nil
+}
+
+// CloseInspectors closes the inspectors implementing io.Closer and returns the first error
+func CloseInspectors(inspectors ...Inspector) error {
+	var err error
+	for _, inspector := range inspectors {
+		if closer, ok := inspector.(io.Closer); ok {
+			if closeerr := closer.Close(); closeerr != nil && err == nil {
+				err = closeerr
+			}
+		}
+	}
+	return err
+}
+
+// Schema is the structure of a database.
+// Each table holds its full definition in Fields.Create and Indexes.Create.
+type Schema struct {
+	Tables   []Table   `json:"tables"`
+	Views    []View    `json:"views,omitempty"`
+	Triggers []Trigger `json:"triggers,omitempty"`
+	Routines []Routine `json:"routines,omitempty"`
+	Events   []Event   `json:"events,omitempty"`
+}
+
+// Inspect returns tables with the prefix, so a Schema is an Inspector of itself
+func (s *Schema) Inspect(prefix string) (*Schema, error) {
+	schema := &Schema{
+		Tables: make([]Table, 0, len(s.Tables)),
+	}
+	for _, table := range s.Tables {
+		if strings.HasPrefix(table.Name, prefix) {
+			schema.Tables = append(schema.Tables, table)
+		}
+	}
+	for _, view := range s.Views {
+		if strings.HasPrefix(view.Name, prefix) {
+			schema.Views = append(schema.Views, view)
+		}
+	}
+	for _, trigger := range s.Triggers {
+		if strings.HasPrefix(trigger.Table, prefix) {
+			schema.Triggers = append(schema.Triggers, trigger)
+		}
+	}
+	for _, routine := range s.Routines {
+		if strings.HasPrefix(routine.Name, prefix) {
+			schema.Routines = append(schema.Routines, routine)
+		}
+	}
+	for _, event := range s.Events {
+		if strings.HasPrefix(event.Name, prefix) {
+			schema.Events = append(schema.Events, event)
+		}
+	}
+	return schema, nil
+}
+
+// Table finds a table by name
+func (s *Schema) Table(name string) (Table, bool) {
+	for _, table := range s.Tables {
+		if table.Name == name {
+			return table, true
+		}
+	}
+	return Table{}, false
+}
@@ -0,0 +1,106 @@
+package dbdiffer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// SnapshotVersion is the version of the snapshot format written by this package.
+// Snapshots of any version up to it can be read.
+const SnapshotVersion int = 1
+
+// Snapshot is the structure of a database saved as a JSON document.
+// It is an Inspector of the saved structure.
+type Snapshot struct {
+	Version int       `json:"version"`
+	Driver  string    `json:"driver"`
+	Created time.Time `json:"created"`
+	Schema
+}
+
+// NewSnapshot creates an empty snapshot of the current version
+func NewSnapshot(driver string) *Snapshot {
+	return &Snapshot{
+		Version: SnapshotVersion,
+		Driver:  driver,
+		Created: time.Now().UTC(),
+		Schema: Schema{
+			Tables: []Table{},
+		},
+	}
+}
+
+// TakeSnapshot reads the structure of tables with the given prefix into a snapshot of the driver
+func TakeSnapshot(inspector Inspector, driver, prefix string) (*Snapshot, error) {
+	schema, err := inspector.Inspect(prefix)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := NewSnapshot(driver)
+	snapshot.Schema = *schema
+	return snapshot, nil
+}
+
+// ReadSnapshot decodes a snapshot and checks its version
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	s := &Snapshot{}
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+	if s.Version <= 0 {
+		return nil, fmt.Errorf("invalid snapshot version %d", s.Version)
+	}
+	if s.Version > SnapshotVersion {
+		return nil, fmt.Errorf("snapshot version %d is newer than supported version %d", s.Version, SnapshotVersion)
+	}
+	return s, nil
+}
+
+// LoadSnapshot reads a snapshot from a file
+func LoadSnapshot(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := ReadSnapshot(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// LoadDriverSnapshot reads a snapshot from a file and checks it is taken from the driver
+func LoadDriverSnapshot(path, driver string) (*Snapshot, error) {
+	s, err := LoadSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+	if s.Driver != driver {
+		return nil, fmt.Errorf("%s: snapshot is taken from %s, not %s", path, s.Driver, driver)
+	}
+	return s, nil
+}
+
+// Write encodes the snapshot as indented JSON
+func (s *Snapshot) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// Save writes the snapshot to a file
+func (s *Snapshot) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := s.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
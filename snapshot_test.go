@@ -0,0 +1,50 @@
+package dbdiffer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	def := "0"
+	s := NewSnapshot("mysql")
+	s.Tables = append(s.Tables, Table{
+		Name:   "user",
+		Engine: "InnoDB",
+		Fields: ResultFields{Create: []Field{{Field: "id", Type: "int(11)", Null: "NO", Default: &def}}},
+	})
+	var buf bytes.Buffer
+	if err := s.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Version != SnapshotVersion || r.Driver != "mysql" || len(r.Tables) != 1 || !r.Tables[0].Fields.Create[0].Equal(s.Tables[0].Fields.Create[0]) {
+		t.Fatalf("unexpected snapshot %+v", r)
+	}
+}
+
+func TestReadSnapshotVersion(t *testing.T) {
+	for _, doc := range []string{
+		`{"driver": "mysql", "tables": []}`,
+		`{"version": 99, "driver": "mysql", "tables": []}`,
+	} {
+		if _, err := ReadSnapshot(strings.NewReader(doc)); err == nil {
+			t.Errorf("expect error reading %s", doc)
+		}
+	}
+}
+
+func TestTakeSnapshot(t *testing.T) {
+	schema := &Schema{Tables: []Table{{Name: "app_user"}, {Name: "log"}}}
+	s, err := TakeSnapshot(schema, "sqlite", "app_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Version != SnapshotVersion || s.Driver != "sqlite" || len(s.Tables) != 1 || s.Tables[0].Name != "app_user" {
+		t.Fatalf("unexpected snapshot %+v", s)
+	}
+}
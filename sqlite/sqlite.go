@@ -0,0 +1,670 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/sillydong/dbdiffer"
+)
+
+const SQLite string = "sqlite"
+
+func init() {
+	dbdiffer.DriverList = append(dbdiffer.DriverList, SQLite)
+}
+
+type Driver struct {
+	new dbdiffer.Inspector
+	old dbdiffer.Inspector
+}
+
+// New creates a new Driver driver.
+// The DSN is a file name or an URI, documented here: https://github.com/mattn/go-sqlite3#connection-string
+// Either DSN can also be a snapshot prefixed with file://
+func New(newDsn, oldDsn string) (dbdiffer.Differ, error) {
+	newInspector, oldInspector, err := dbdiffer.OpenInspectors(Open, newDsn, oldDsn)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromInspectors(newInspector, oldInspector), nil
+}
+
+// Open returns an inspector of the DSN, which accepts the same values as New
+func Open(dsn string) (dbdiffer.Inspector, error) {
+	if strings.HasPrefix(dsn, dbdiffer.FilePrefix) && strings.HasSuffix(strings.ToLower(dsn), ".json") {
+		// file:// without .json is a sqlite URI
+		return dbdiffer.LoadDriverSnapshot(strings.TrimPrefix(dsn, dbdiffer.FilePrefix), SQLite)
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	return &inspector{db: db}, nil
+}
+
+// NewFromDB returns a sqlite driver from a sql.DB
+func NewFromDB(newDb, oldDb *sql.DB) (dbdiffer.Differ, error) {
+	if _, ok := newDb.Driver().(*sqlite3.SQLiteDriver); !ok {
+		return nil, errors.New("new database instance is not using the SQLite driver")
+	}
+	if _, ok := oldDb.Driver().(*sqlite3.SQLiteDriver); !ok {
+		return nil, errors.New("old database instance is not using the SQLite driver")
+	}
+
+	if err := newDb.Ping(); err != nil {
+		return nil, err
+	}
+
+	if err := oldDb.Ping(); err != nil {
+		return nil, err
+	}
+
+	return NewFromInspectors(NewInspector(newDb), NewInspector(oldDb)), nil
+}
+
+// NewFromInspectors returns a sqlite driver comparing structures from any inspectors,
+// inspectors implementing io.Closer are closed with the driver.
+func NewFromInspectors(newInspector, oldInspector dbdiffer.Inspector) dbdiffer.Differ {
+	return &Driver{
+		new: newInspector,
+		old: oldInspector,
+	}
+}
+
+// Close closes the database files.
+func (d *Driver) Close() error {
+	return dbdiffer.CloseInspectors(d.new, d.old)
+}
+
+func (d *Driver) Diff(prefix string) (diff *dbdiffer.Result, err error) {
+	//retrive new database structure
+	newschema, err := d.new.Inspect(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	//retrive old database structure
+	oldschema, err := d.old.Inspect(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	result := dbdiffer.Compare(oldschema, newschema)
+	for pos, change := range result.Change {
+		olddetail, exist := oldschema.Table(change.Name)
+		if !exist {
+			// renamed table, see Generate
+			continue
+		}
+		newdetail, _ := newschema.Table(change.Name)
+		if rebuild(olddetail, newdetail, change) {
+			// the whole new definition is needed to rebuild the table
+			result.Change[pos].Fields.Create = newdetail.Fields.Create
+			result.Change[pos].Indexes.Create = newdetail.Indexes.Create
+			result.Change[pos].SQL = newdetail.SQL
+		}
+	}
+	return result, nil
+}
+
+// Snapshot takes a snapshot of tables with the given prefix, see dbdiffer.TakeSnapshot.
+// The DSN accepts the same values as New.
+func Snapshot(dsn, prefix string) (*dbdiffer.Snapshot, error) {
+	inspector, err := Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer dbdiffer.CloseInspectors(inspector)
+	return dbdiffer.TakeSnapshot(inspector, SQLite, prefix)
+}
+
+func (d *Driver) Generate(result *dbdiffer.Result) ([]dbdiffer.Statement, error) {
+	statements := make([]dbdiffer.Statement, 0)
+	if result.IsEmpty() {
+		return statements, nil
+	}
+	for _, rename := range result.Rename {
+		statements = append(statements, dbdiffer.NewStatement("ALTER TABLE "+quote(rename.Old.Name)+" RENAME TO "+quote(rename.New.Name)+";", dbdiffer.RenameTable, rename.New.Name, rename.Old.Name+" to "+rename.New.Name))
+	}
+	plan := dbdiffer.NewPlan(result)
+	if len(plan.Drop) > 0 {
+		for _, table := range plan.Drop {
+			statement := dbdiffer.NewStatement("DROP TABLE IF EXISTS "+quote(table.Name)+";", dbdiffer.DropTable, table.Name, table.Name)
+			statement.Destructive = true
+			statements = append(statements, statement)
+		}
+	}
+	if len(plan.Create) > 0 {
+		for _, table := range plan.Create {
+			if len(table.SQL) > 0 {
+				create, recreate := definition(table, table.Name)
+				statements = append(statements, dbdiffer.NewStatement(create, dbdiffer.CreateTable, table.Name, table.Name))
+				statements = append(statements, recreate...)
+				continue
+			}
+			statements = append(statements, dbdiffer.NewStatement(createtable(table.Name, table)+";", dbdiffer.CreateTable, table.Name, table.Name))
+			for _, index := range table.Indexes.Create {
+				if index.IndexType == "c" {
+					statements = append(statements, dbdiffer.NewStatement(createindex(index), dbdiffer.AddIndex, table.Name, table.Name+"."+index.KeyName))
+				}
+			}
+		}
+	}
+	renamed := make(map[string]dbdiffer.TableRename, len(result.Rename))
+	for _, rename := range result.Rename {
+		renamed[rename.New.Name] = rename
+	}
+	rebuilt := false
+	if len(result.Change) > 0 {
+		for _, table := range result.Change {
+			if rename, exist := renamed[table.Name]; exist && len(table.Fields.Create) == 0 && rebuild(rename.Old, rename.New, table) {
+				// the whole new definition is needed to rebuild the table
+				table.Fields.Create = rename.New.Fields.Create
+				table.Indexes.Create = rename.New.Indexes.Create
+				table.SQL = rename.New.SQL
+			}
+			if len(table.Fields.Create) > 0 {
+				// sqlite can not alter the table in place, rebuild it and copy the data over,
+				// see https://www.sqlite.org/lang_altertable.html#otheralter
+				rebuilt = true
+				tmp := table.Name + "__dbdiffer_tmp"
+				added := make(map[string]struct{}, len(table.Fields.Add))
+				for _, field := range table.Fields.Add {
+					added[field.Field] = struct{}{}
+				}
+				renamed := make(map[string]string, len(table.Fields.Rename))
+				for _, rename := range table.Fields.Rename {
+					renamed[rename.New.Field] = rename.Old.Field
+				}
+				columns := make([]string, 0, len(table.Fields.Create))
+				values := make([]string, 0, len(table.Fields.Create))
+				for _, field := range table.Fields.Create {
+					if _, exist := added[field.Field]; !exist {
+						columns = append(columns, quote(field.Field))
+						if old, exist := renamed[field.Field]; exist {
+							values = append(values, quote(old))
+						} else {
+							values = append(values, quote(field.Field))
+						}
+					}
+				}
+				rebuild := func(sql string) dbdiffer.Statement {
+					statement := dbdiffer.NewStatement(sql, dbdiffer.RebuildTable, table.Name, table.Name)
+					statement.RebuildsTable = true
+					return statement
+				}
+				// the new definition read from sqlite_master keeps the foreign keys, checks, collations and triggers
+				create, recreate := createtable(tmp, table)+";", make([]dbdiffer.Statement, 0)
+				if len(table.SQL) > 0 {
+					create, recreate = definition(table, tmp)
+				} else {
+					for _, index := range table.Indexes.Create {
+						if index.IndexType == "c" {
+							recreate = append(recreate, dbdiffer.NewStatement(createindex(index), dbdiffer.AddIndex, table.Name, table.Name+"."+index.KeyName))
+						}
+					}
+				}
+				statements = append(statements, rebuild(create))
+				if len(columns) > 0 {
+					statements = append(statements, rebuild("INSERT INTO "+quote(tmp)+" ("+strings.Join(columns, ", ")+") SELECT "+strings.Join(values, ", ")+" FROM "+quote(table.Name)+";"))
+				}
+				// values of columns that are not copied, or do not fit in the new columns, are lost with the old table
+				drop := rebuild("DROP TABLE " + quote(table.Name) + ";")
+				drop.Destructive = len(table.Fields.Drop) > 0
+				for _, change := range table.Fields.Change {
+					drop.Destructive = drop.Destructive || dbdiffer.LossyChange(change.Old, change.New) != ""
+				}
+				statements = append(statements, drop)
+				// views and triggers still refer to the dropped table, which the legacy rename does not check
+				statements = append(statements, rebuild("PRAGMA legacy_alter_table=ON;"))
+				statements = append(statements, rebuild("ALTER TABLE "+quote(tmp)+" RENAME TO "+quote(table.Name)+";"))
+				statements = append(statements, rebuild("PRAGMA legacy_alter_table=OFF;"))
+				statements = append(statements, recreate...)
+				continue
+			}
+			if len(table.Indexes.Drop) > 0 {
+				for _, index := range table.Indexes.Drop {
+					statements = append(statements, dbdiffer.NewStatement("DROP INDEX IF EXISTS "+quote(index.KeyName)+";", dbdiffer.DropIndex, table.Name, table.Name+"."+index.KeyName))
+				}
+			}
+			for _, rename := range table.Fields.Rename {
+				statements = append(statements, dbdiffer.NewStatement("ALTER TABLE "+quote(table.Name)+" RENAME COLUMN "+quote(rename.Old.Field)+" TO "+quote(rename.New.Field)+";", dbdiffer.RenameColumn, table.Name, table.Name+"."+rename.Old.Field+" to "+rename.New.Field))
+			}
+			if len(table.Fields.Add) > 0 {
+				for _, field := range table.Fields.Add {
+					statements = append(statements, dbdiffer.NewStatement("ALTER TABLE "+quote(table.Name)+" ADD COLUMN "+column(field, false)+";", dbdiffer.AddColumn, table.Name, table.Name+"."+field.Field))
+				}
+			}
+			if len(table.Indexes.Add) > 0 {
+				for _, index := range table.Indexes.Add {
+					statements = append(statements, dbdiffer.NewStatement(createindex(index), dbdiffer.AddIndex, table.Name, table.Name+"."+index.KeyName))
+				}
+			}
+		}
+	}
+	if rebuilt {
+		// dropping a table must not delete the rows referring to it, foreign keys are checked once the tables are rebuilt
+		transaction := func(sql, description string) dbdiffer.Statement {
+			return dbdiffer.Statement{SQL: sql, Kind: dbdiffer.Transaction, Description: description}
+		}
+		statements = append([]dbdiffer.Statement{
+			transaction("PRAGMA foreign_keys=OFF;", "turn off foreign keys"),
+			transaction("BEGIN;", "begin transaction"),
+		}, statements...)
+		statements = append(statements,
+			transaction("PRAGMA foreign_key_check;", "check foreign keys"),
+			transaction("COMMIT;", "commit transaction"),
+		)
+	}
+
+	return statements, nil
+}
+
+// GenerateDown returns the statements undoing the result, see dbdiffer.GenerateDown
+func (d *Driver) GenerateDown(result *dbdiffer.Result) ([]dbdiffer.Statement, error) {
+	return dbdiffer.GenerateDown(d, result)
+}
+
+// Complete gives tables that are rebuilt to undo the result their old definitions, see dbdiffer.Completer
+func (d *Driver) Complete(result, down *dbdiffer.Result) {
+	renamed := make(map[string]string, len(down.Rename))
+	for _, rename := range down.Rename {
+		renamed[rename.New.Name] = rename.Old.Name
+	}
+	for pos, table := range down.Change {
+		if _, exist := renamed[table.Name]; exist || len(table.Fields.Create) > 0 || !rebuild(dbdiffer.Table{}, dbdiffer.Table{}, table) {
+			// renamed tables are rebuilt from the definitions of the rename
+			continue
+		}
+		// columns are dropped by rebuilding the table, from the old definition
+		for _, change := range result.Change {
+			if change.Name == table.Name && change.Old != nil {
+				down.Change[pos].Fields.Create = change.Old.Fields.Create
+				down.Change[pos].Indexes.Create = change.Old.Indexes.Create
+				down.Change[pos].SQL = change.Old.SQL
+			}
+		}
+	}
+}
+
+// inspector reads the structure from a live database
+type inspector struct {
+	db *sql.DB
+}
+
+// NewInspector returns an inspector reading the structure from the database
+func NewInspector(db *sql.DB) dbdiffer.Inspector {
+	return &inspector{db: db}
+}
+
+func (i *inspector) Close() error {
+	return i.db.Close()
+}
+
+func (i *inspector) Inspect(prefix string) (*dbdiffer.Schema, error) {
+	tables, _, err := tables(i.db, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for pos, table := range tables {
+		tables[pos].Fields.Create, _, err = fields(i.db, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		tables[pos].Indexes.Create, _, err = indexes(i.db, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		tables[pos].SQL, err = definitions(i.db, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		// sqlite keeps no estimate, rows are counted
+		if err := i.db.QueryRow("SELECT count(*) FROM " + quote(table.Name) + ";").Scan(&tables[pos].Rows); err != nil {
+			return nil, err
+		}
+	}
+	return &dbdiffer.Schema{Tables: tables}, nil
+}
+
+func tables(db *sql.DB, prefix string) ([]dbdiffer.Table, map[string]int, error) {
+	resultrows, err := db.Query("SELECT name, sql FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite\\_%' ESCAPE '\\' AND name LIKE ? ORDER BY name;", prefix+"%")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultrows.Close()
+	tablespos := make(map[string]int)
+	tables := make([]dbdiffer.Table, 0)
+	for resultrows.Next() {
+		var (
+			name   string
+			create string
+		)
+		if err := resultrows.Scan(&name, &create); err != nil {
+			return nil, nil, err
+		}
+		tables = append(tables, dbdiffer.Table{
+			Name:    name,
+			Options: options(create),
+		})
+		tablespos[name] = len(tables) - 1
+	}
+	return tables, tablespos, resultrows.Err()
+}
+
+func fields(db *sql.DB, table string) ([]dbdiffer.Field, map[string]int, error) {
+	var create string
+	if err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?;", table).Scan(&create); err != nil {
+		return nil, nil, err
+	}
+	autoincrement := strings.Contains(strings.ToUpper(create), "AUTOINCREMENT")
+
+	resultrows, err := db.Query("PRAGMA table_info(" + quote(table) + ");")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultrows.Close()
+	fieldspos := make(map[string]int)
+	fields := make([]dbdiffer.Field, 0)
+	lastfield := ""
+	pks := 0
+	for resultrows.Next() {
+		var (
+			cid     int
+			field   string
+			typ     string
+			notnull bool
+			def     *string
+			pk      int
+		)
+		if err := resultrows.Scan(&cid, &field, &typ, &notnull, &def, &pk); err != nil {
+			return nil, nil, err
+		}
+		null := "YES"
+		if notnull {
+			null = "NO"
+		}
+		key := ""
+		if pk > 0 {
+			key = "PRI"
+			pks++
+		}
+		fields = append(fields, dbdiffer.Field{
+			Field:   field,
+			Type:    typ,
+			Null:    null,
+			Key:     key,
+			Default: def,
+			After:   lastfield,
+		})
+		fieldspos[field] = len(fields) - 1
+		lastfield = field
+	}
+	if err := resultrows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if autoincrement && pks == 1 {
+		// AUTOINCREMENT is only allowed on a single INTEGER PRIMARY KEY column
+		for i := range fields {
+			if fields[i].Key == "PRI" && strings.EqualFold(fields[i].Type, "INTEGER") {
+				fields[i].Extra = "AUTOINCREMENT"
+			}
+		}
+	}
+	return fields, fieldspos, nil
+}
+
+func indexes(db *sql.DB, table string) ([]dbdiffer.Index, map[string]int, error) {
+	indexes := make([]dbdiffer.Index, 0)
+	indexpos := make(map[string]int)
+
+	// the primary key is not always backed by an index, read it from the columns
+	pkrows, err := db.Query("SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk;", table)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer pkrows.Close()
+	primary := dbdiffer.Index{
+		Table:     table,
+		NonUnique: 0,
+		KeyName:   "PRIMARY",
+		IndexType: "pk",
+	}
+	for pkrows.Next() {
+		var column_name string
+		if err := pkrows.Scan(&column_name); err != nil {
+			return nil, nil, err
+		}
+		primary.ColumnName = append(primary.ColumnName, column_name)
+	}
+	if err := pkrows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(primary.ColumnName) > 0 {
+		indexes = append(indexes, primary)
+		indexpos[primary.KeyName] = len(indexes) - 1
+	}
+
+	resultrows, err := db.Query("SELECT name, \"unique\", origin FROM pragma_index_list(?) WHERE origin <> 'pk' ORDER BY name;", table)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resultrows.Close()
+	for resultrows.Next() {
+		var (
+			key_name string
+			unique   bool
+			origin   string
+		)
+		if err := resultrows.Scan(&key_name, &unique, &origin); err != nil {
+			return nil, nil, err
+		}
+		non_unique := 1
+		if unique {
+			non_unique = 0
+		}
+		indexes = append(indexes, dbdiffer.Index{
+			Table:     table,
+			NonUnique: non_unique,
+			KeyName:   key_name,
+			IndexType: origin,
+		})
+		indexpos[key_name] = len(indexes) - 1
+	}
+	if err := resultrows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	for i := range indexes {
+		if indexes[i].KeyName == "PRIMARY" {
+			continue
+		}
+		columnrows, err := db.Query("SELECT name FROM pragma_index_info(?) ORDER BY seqno;", indexes[i].KeyName)
+		if err != nil {
+			return nil, nil, err
+		}
+		for columnrows.Next() {
+			var column_name *string
+			if err := columnrows.Scan(&column_name); err != nil {
+				columnrows.Close()
+				return nil, nil, err
+			}
+			if column_name == nil {
+				columnrows.Close()
+				return nil, nil, errors.New("index " + indexes[i].KeyName + " on expressions is not supported")
+			}
+			indexes[i].ColumnName = append(indexes[i].ColumnName, *column_name)
+		}
+		columnrows.Close()
+		if err := columnrows.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return indexes, indexpos, nil
+}
+
+// definitions reads the statements creating the table, its indexes and triggers,
+// indexes made for PRIMARY KEY and UNIQUE constraints are part of the table
+func definitions(db *sql.DB, table string) ([]string, error) {
+	resultrows, err := db.Query("SELECT sql FROM sqlite_master WHERE tbl_name = ? AND type IN ('table', 'index', 'trigger') AND sql IS NOT NULL ORDER BY CASE type WHEN 'table' THEN 0 WHEN 'index' THEN 1 ELSE 2 END, name;", table)
+	if err != nil {
+		return nil, err
+	}
+	defer resultrows.Close()
+	definitions := make([]string, 0)
+	for resultrows.Next() {
+		var sql string
+		if err := resultrows.Scan(&sql); err != nil {
+			return nil, err
+		}
+		definitions = append(definitions, sql)
+	}
+	return definitions, resultrows.Err()
+}
+
+// rebuild tells whether the change can not be applied with ALTER TABLE and the table has to be recreated
+func rebuild(olddetail, newdetail, change dbdiffer.Table) bool {
+	if olddetail.Options != newdetail.Options || len(change.Fields.Drop) > 0 || len(change.Fields.Change) > 0 {
+		return true
+	}
+	for _, field := range change.Fields.Add {
+		if !addable(field) {
+			return true
+		}
+	}
+	for _, rename := range change.Fields.Rename {
+		// RENAME COLUMN only renames, any other change of the column needs a rebuild
+		old := rename.Old
+		old.Field = rename.New.Field
+		if !old.Equal(rename.New) {
+			return true
+		}
+	}
+	for _, index := range change.Indexes.Drop {
+		if index.IndexType != "c" {
+			return true
+		}
+	}
+	for _, index := range change.Indexes.Add {
+		if index.IndexType != "c" {
+			return true
+		}
+	}
+	return false
+}
+
+// addable follows the restrictions of ALTER TABLE ADD COLUMN, see https://www.sqlite.org/lang_altertable.html
+func addable(field dbdiffer.Field) bool {
+	if field.Key == "PRI" {
+		return false
+	}
+	if field.Default == nil {
+		return field.Null != "NO"
+	}
+	def := strings.ToUpper(*field.Default)
+	if strings.HasPrefix(def, "(") || strings.HasPrefix(def, "CURRENT_") {
+		return false
+	}
+	return !(field.Null == "NO" && def == "NULL")
+}
+
+func createtable(name string, table dbdiffer.Table) string {
+	defs := make([]string, 0)
+	inlinepk := false
+	for _, field := range table.Fields.Create {
+		if field.Extra == "AUTOINCREMENT" {
+			inlinepk = true
+		}
+		defs = append(defs, column(field, true))
+	}
+	for _, index := range table.Indexes.Create {
+		switch index.IndexType {
+		case "pk":
+			if !inlinepk {
+				defs = append(defs, "PRIMARY KEY ("+columns(index.ColumnName)+")")
+			}
+		case "u":
+			defs = append(defs, "UNIQUE ("+columns(index.ColumnName)+")")
+		}
+	}
+	sql := "CREATE TABLE " + quote(name) + " (" + strings.Join(defs, ", ") + ")"
+	if table.Options != "" {
+		sql += " " + table.Options
+	}
+	return sql
+}
+
+// definition returns the CREATE TABLE statement read from sqlite_master with the table named name,
+// and the statements creating its indexes and triggers.
+// sqlite_master starts the statements with the upper case keywords, see https://www.sqlite.org/schematab.html
+func definition(table dbdiffer.Table, name string) (string, []dbdiffer.Statement) {
+	create := "CREATE TABLE " + quote(name) + " " + table.SQL[0][strings.Index(table.SQL[0], "("):] + ";"
+	statements := make([]dbdiffer.Statement, 0, len(table.SQL)-1)
+	for _, sql := range table.SQL[1:] {
+		kind, rest := dbdiffer.AddIndex, strings.TrimPrefix(strings.TrimPrefix(sql, "CREATE UNIQUE INDEX "), "CREATE INDEX ")
+		if strings.HasPrefix(sql, "CREATE TRIGGER ") {
+			kind, rest = dbdiffer.CreateTrigger, strings.TrimPrefix(sql, "CREATE TRIGGER ")
+		}
+		object := strings.Trim(strings.Fields(rest)[0], "\"`[]")
+		if kind == dbdiffer.AddIndex {
+			object = table.Name + "." + object
+		}
+		statements = append(statements, dbdiffer.NewStatement(sql+";", kind, table.Name, object))
+	}
+	return create, statements
+}
+
+func createindex(index dbdiffer.Index) string {
+	sql := "CREATE "
+	if index.NonUnique == 0 {
+		sql += "UNIQUE "
+	}
+	return sql + "INDEX IF NOT EXISTS " + quote(index.KeyName) + " ON " + quote(index.Table) + " (" + columns(index.ColumnName) + ");"
+}
+
+func column(field dbdiffer.Field, create bool) string {
+	sql := quote(field.Field)
+	if field.Type != "" {
+		sql += " " + field.Type
+	}
+	if create && field.Extra == "AUTOINCREMENT" {
+		sql += " PRIMARY KEY AUTOINCREMENT"
+	}
+	if field.Null == "NO" {
+		sql += " NOT NULL"
+	}
+	if field.Default != nil {
+		sql += " DEFAULT " + *field.Default
+	}
+	return sql
+}
+
+func options(create string) string {
+	opts := make([]string, 0)
+	tail := strings.ToUpper(create[strings.LastIndex(create, ")")+1:])
+	if strings.Contains(tail, "WITHOUT ROWID") {
+		opts = append(opts, "WITHOUT ROWID")
+	}
+	if strings.Contains(tail, "STRICT") {
+		opts = append(opts, "STRICT")
+	}
+	return strings.Join(opts, ", ")
+}
+
+func columns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quote(column)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func quote(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
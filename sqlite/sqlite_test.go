@@ -0,0 +1,421 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sillydong/dbdiffer"
+)
+
+const newschema = `
+CREATE TABLE user (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name VARCHAR(64) NOT NULL DEFAULT '',
+	email VARCHAR(128) NOT NULL UNIQUE,
+	age INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_user_name ON user (name, age);
+CREATE TABLE tag (
+	id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	PRIMARY KEY (id)
+);
+CREATE TABLE post (
+	id INTEGER PRIMARY KEY,
+	title TEXT NOT NULL,
+	note TEXT
+);
+`
+
+const oldschema = `
+CREATE TABLE user (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL DEFAULT '',
+	email VARCHAR(128) NOT NULL UNIQUE,
+	legacy TEXT
+);
+CREATE INDEX idx_user_legacy ON user (legacy);
+CREATE TABLE post (
+	id INTEGER PRIMARY KEY,
+	title TEXT NOT NULL
+);
+CREATE TABLE obsolete (
+	id INTEGER PRIMARY KEY
+);
+INSERT INTO user (name, email, legacy) VALUES ('alice', 'alice@example.com', 'x');
+INSERT INTO post (title) VALUES ('hello');
+`
+
+func open(t *testing.T, name, schema string) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestTables(t *testing.T) {
+	db := open(t, "new.db", newschema)
+	defer db.Close()
+	tb, tbp, err := tables(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tb) != 3 {
+		t.Fatalf("expect 3 tables, got %+v", tb)
+	}
+	t.Logf("%+v\n", tb)
+	t.Logf("%+v\n", tbp)
+}
+
+func TestFields(t *testing.T) {
+	db := open(t, "new.db", newschema)
+	defer db.Close()
+	fids, fidsp, err := fields(db, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fids) != 5 || fids[0].Extra != "AUTOINCREMENT" {
+		t.Fatalf("unexpected fields %+v", fids)
+	}
+	t.Logf("%+v\n", fids)
+	t.Logf("%+v\n", fidsp)
+}
+
+func TestIndexes(t *testing.T) {
+	db := open(t, "new.db", newschema)
+	defer db.Close()
+	idxs, idxsp, err := indexes(db, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idxs) != 3 || idxs[0].KeyName != "PRIMARY" {
+		t.Fatalf("unexpected indexes %+v", idxs)
+	}
+	t.Logf("%+v\n", idxs)
+	t.Logf("%+v", idxsp)
+}
+
+func TestDiff(t *testing.T) {
+	newDb := open(t, "new.db", newschema)
+	oldDb := open(t, "old.db", oldschema)
+	differ, err := NewFromDB(newDb, oldDb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer differ.Close()
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sres, _ := json.MarshalIndent(res, "", "  ")
+	t.Logf("%+v", string(sres))
+	losses := make([]string, 0)
+	for _, loss := range dbdiffer.Losses(res) {
+		losses = append(losses, loss.String())
+	}
+	if strings.Join(losses, "\n") != "table obsolete: table is dropped\ncolumn user.legacy: column is dropped (about 1 rows)\ncolumn user.name: type is narrowed from TEXT to VARCHAR(64) (about 1 rows)" {
+		t.Errorf("unexpected losses %q", losses)
+	}
+
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	for _, s := range gen {
+		t.Log(s)
+		if _, err := oldDb.Exec(s); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+
+	res, err = differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsEmpty() {
+		sres, _ := json.MarshalIndent(res, "", "  ")
+		t.Fatalf("databases still differ after upgrade: %s", sres)
+	}
+
+	var name string
+	if err := oldDb.QueryRow("SELECT name FROM user WHERE email = 'alice@example.com';").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "alice" {
+		t.Fatalf("data is lost while rebuilding table, got %q", name)
+	}
+}
+
+func TestDiffRename(t *testing.T) {
+	newDb := open(t, "new.db", `
+CREATE TABLE item (id INTEGER PRIMARY KEY, item_name TEXT NOT NULL DEFAULT '');
+CREATE INDEX idx_item_name ON item (item_name);
+CREATE TABLE account (id INTEGER PRIMARY KEY, contact VARCHAR(255));
+`)
+	oldDb := open(t, "old.db", `
+CREATE TABLE item (id INTEGER PRIMARY KEY, itemname TEXT NOT NULL DEFAULT '');
+CREATE INDEX idx_item_name ON item (itemname);
+CREATE TABLE account (id INTEGER PRIMARY KEY, mail TEXT);
+INSERT INTO item (itemname) VALUES ('book');
+INSERT INTO account (mail) VALUES ('alice@example.com');
+`)
+	differ, err := NewFromDB(newDb, oldDb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer differ.Close()
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	renames := dbdiffer.Renames{{Table: "account", Old: "mail", New: "contact"}}
+	if err := renames.Apply(res); err != nil {
+		t.Fatal(err)
+	}
+
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	for _, s := range gen {
+		t.Log(s)
+		if _, err := oldDb.Exec(s); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+
+	res, err = differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsEmpty() {
+		sres, _ := json.MarshalIndent(res, "", "  ")
+		t.Fatalf("databases still differ after upgrade: %s", sres)
+	}
+
+	var name, contact string
+	if err := oldDb.QueryRow("SELECT item_name FROM item;").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if err := oldDb.QueryRow("SELECT contact FROM account;").Scan(&contact); err != nil {
+		t.Fatal(err)
+	}
+	if name != "book" || contact != "alice@example.com" {
+		t.Fatalf("data is lost while renaming columns, got %q and %q", name, contact)
+	}
+}
+
+func TestDiffTableRename(t *testing.T) {
+	newDb := open(t, "new.db", `
+CREATE TABLE user (id INTEGER PRIMARY KEY, name TEXT NOT NULL, email TEXT, age INTEGER, note TEXT NOT NULL DEFAULT '');
+CREATE TABLE audit (id INTEGER PRIMARY KEY, message TEXT);
+`)
+	oldDb := open(t, "old.db", `
+CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, email TEXT, age INTEGER, legacy TEXT);
+CREATE TABLE log (id INTEGER PRIMARY KEY, text TEXT);
+INSERT INTO users (name) VALUES ('alice');
+INSERT INTO log (text) VALUES ('started');
+`)
+	differ, err := NewFromDB(newDb, oldDb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer differ.Close()
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rename) != 1 || res.Rename[0].Old.Name != "users" {
+		t.Fatalf("unexpected renames %+v", res.Rename)
+	}
+	renames := dbdiffer.Renames{{Old: "log", New: "audit"}, {Table: "audit", Old: "text", New: "message"}}
+	if err := renames.Apply(res); err != nil {
+		t.Fatal(err)
+	}
+
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	for _, s := range gen {
+		t.Log(s)
+		if _, err := oldDb.Exec(s); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+
+	res, err = differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsEmpty() {
+		sres, _ := json.MarshalIndent(res, "", "  ")
+		t.Fatalf("databases still differ after upgrade: %s", sres)
+	}
+
+	var name, message string
+	if err := oldDb.QueryRow("SELECT name FROM user;").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if err := oldDb.QueryRow("SELECT message FROM audit;").Scan(&message); err != nil {
+		t.Fatal(err)
+	}
+	if name != "alice" || message != "started" {
+		t.Fatalf("data is lost while renaming tables, got %q and %q", name, message)
+	}
+}
+
+func TestDiffDown(t *testing.T) {
+	newDb := open(t, "new.db", newschema)
+	oldDb := open(t, "old.db", oldschema)
+	origDb := open(t, "orig.db", oldschema)
+	differ, err := NewFromDB(newDb, oldDb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer differ.Close()
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	down, err := differ.GenerateDown(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range dbdiffer.Strings(append(up, down...)) {
+		t.Log(s)
+		if _, err := oldDb.Exec(s); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+
+	// the old database is back to where it was
+	check, err := NewFromDB(origDb, oldDb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer check.Close()
+	res, err = check.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsEmpty() {
+		sres, _ := json.MarshalIndent(res, "", "  ")
+		t.Fatalf("databases still differ after downgrade: %s", sres)
+	}
+	// the dropped column and table are back without their data, the added ones are dropped with theirs
+	warnings := []string{
+		"-- WARNING: table obsolete is created again without its rows",
+		"-- WARNING: table tag is dropped along with its rows",
+		"-- WARNING: column post.note is dropped along with its values",
+		"-- WARNING: column user.legacy is added again without its values",
+		"-- WARNING: column user.age is dropped along with its values",
+		"-- WARNING: column user.created_at is dropped along with its values",
+	}
+	for i, warning := range warnings {
+		if down[i].SQL != warning {
+			t.Errorf("expect %q, got %q", warning, down[i].SQL)
+		}
+	}
+}
+
+func TestDiffRebuild(t *testing.T) {
+	newDb := open(t, "new.db", `
+CREATE TABLE author (id INTEGER PRIMARY KEY, name VARCHAR(64) NOT NULL CHECK (name <> ''));
+CREATE TABLE book (id INTEGER PRIMARY KEY, author_id INTEGER REFERENCES author (id) ON DELETE CASCADE, title TEXT COLLATE NOCASE CHECK (title <> ''));
+CREATE INDEX idx_book_title ON book (title);
+CREATE TABLE log (message TEXT);
+CREATE TRIGGER book_log AFTER INSERT ON book BEGIN INSERT INTO log VALUES (new.title); END;
+CREATE VIEW book_author AS SELECT book.title, author.name FROM book JOIN author ON author.id = book.author_id;
+`)
+	// foreign keys are on for every connection, dropping author would delete the books
+	oldDb := open(t, "old.db?_foreign_keys=1", `
+CREATE TABLE author (id INTEGER PRIMARY KEY, name TEXT NOT NULL CHECK (name <> ''));
+CREATE TABLE book (id INTEGER PRIMARY KEY, author_id INTEGER REFERENCES author (id) ON DELETE CASCADE, title TEXT COLLATE NOCASE CHECK (title <> ''), legacy TEXT);
+CREATE INDEX idx_book_title ON book (title);
+CREATE TABLE log (message TEXT);
+CREATE TRIGGER book_log AFTER INSERT ON book BEGIN INSERT INTO log VALUES (new.title); END;
+CREATE VIEW book_author AS SELECT book.title, author.name FROM book JOIN author ON author.id = book.author_id;
+INSERT INTO author (id, name) VALUES (1, 'alice');
+INSERT INTO book (author_id, title, legacy) VALUES (1, 'Hello', 'x');
+`)
+	differ, err := NewFromDB(newDb, oldDb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer differ.Close()
+	res, err := differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := differ.Generate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := dbdiffer.Strings(statements)
+	if gen[0] != "PRAGMA foreign_keys=OFF;" || gen[1] != "BEGIN;" || gen[len(gen)-2] != "PRAGMA foreign_key_check;" || gen[len(gen)-1] != "COMMIT;" {
+		t.Fatalf("rebuild is not wrapped in a transaction without foreign keys: %q", gen)
+	}
+	for _, s := range gen {
+		t.Log(s)
+		if _, err := oldDb.Exec(s); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+
+	res, err = differ.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.IsEmpty() {
+		sres, _ := json.MarshalIndent(res, "", "  ")
+		t.Fatalf("databases still differ after upgrade: %s", sres)
+	}
+
+	var books, logs int
+	if err := oldDb.QueryRow("SELECT count(*) FROM book_author WHERE title = 'HELLO';").Scan(&books); err != nil {
+		t.Fatal(err)
+	}
+	if books != 1 {
+		t.Fatalf("books are lost or no longer compared without case while rebuilding author and book, got %d", books)
+	}
+	if _, err := oldDb.Exec("INSERT INTO book (author_id, title) VALUES (1, '');"); err == nil {
+		t.Fatal("check of book.title is lost while rebuilding book")
+	}
+	if _, err := oldDb.Exec("INSERT INTO book (author_id, title) VALUES (1, 'World');"); err != nil {
+		t.Fatal(err)
+	}
+	if err := oldDb.QueryRow("SELECT count(*) FROM log;").Scan(&logs); err != nil {
+		t.Fatal(err)
+	}
+	if logs != 2 {
+		t.Fatalf("trigger book_log is lost while rebuilding book, got %d logs", logs)
+	}
+	if _, err := oldDb.Exec("PRAGMA foreign_keys=ON;"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := oldDb.Exec("DELETE FROM author;"); err != nil {
+		t.Fatal(err)
+	}
+	if err := oldDb.QueryRow("SELECT count(*) FROM book;").Scan(&books); err != nil {
+		t.Fatal(err)
+	}
+	if books != 0 {
+		t.Fatalf("foreign key of book is lost while rebuilding book, got %d books", books)
+	}
+}
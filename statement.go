@@ -0,0 +1,67 @@
+package dbdiffer
+
+// Kinds of statements
+const (
+	CreateTable         string = "create table"
+	DropTable           string = "drop table"
+	RenameTable         string = "rename table"
+	AlterTable          string = "alter table" // changes table options, or several things of a table at once
+	RebuildTable        string = "rebuild table"
+	AddColumn           string = "add column"
+	DropColumn          string = "drop column"
+	ChangeColumn        string = "change column"
+	RenameColumn        string = "rename column"
+	MoveColumn          string = "move column"
+	AddIndex            string = "add index"
+	DropIndex           string = "drop index"
+	AddConstraint       string = "add constraint"
+	DropConstraint      string = "drop constraint"
+	PartitionTable      string = "partition table" // partitions a table again, or removes its partitioning
+	AddPartition        string = "add partition"
+	DropPartition       string = "drop partition"
+	ReorganizePartition string = "reorganize partition"
+	CreateView          string = "create view" // creates or replaces a view
+	DropView            string = "drop view"
+	CreateTrigger       string = "create trigger"
+	DropTrigger         string = "drop trigger"
+	CreateRoutine       string = "create routine"
+	DropRoutine         string = "drop routine"
+	CreateEvent         string = "create event"
+	AlterEvent          string = "alter event"
+	DropEvent           string = "drop event"
+	Transaction         string = "transaction" // begins or ends a transaction, or sets how foreign keys are checked in it
+	Warning             string = "warning"     // a comment about what a script cannot do
+)
+
+// Statement is a generated statement, along with what it does
+type Statement struct {
+	SQL           string
+	Table         string // the table the statement changes, or the view, routine or event
+	Kind          string
+	Destructive   bool   // rows or values are lost
+	RebuildsTable bool   // the table is copied, which takes long and may lock large tables
+	Description   string // what the statement does, like drop column user.email
+}
+
+// NewStatement returns a statement of the kind on the table, described by its kind and the name of what it changes
+func NewStatement(sql, kind, table, name string) Statement {
+	return Statement{SQL: sql, Table: table, Kind: kind, Description: kind + " " + name}
+}
+
+// Strings returns the SQL of the statements
+func Strings(statements []Statement) []string {
+	sqls := make([]string, 0, len(statements))
+	for _, statement := range statements {
+		sqls = append(sqls, statement.SQL)
+	}
+	return sqls
+}
+
+// Warnings returns the warnings as comments, to start a script with
+func Warnings(warnings []string) []Statement {
+	statements := make([]Statement, 0, len(warnings))
+	for _, warning := range warnings {
+		statements = append(statements, Statement{SQL: "-- WARNING: " + warning, Kind: Warning, Description: warning})
+	}
+	return statements
+}